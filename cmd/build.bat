@@ -1 +1,2 @@
-go build .\src\main.go
\ No newline at end of file
+for /f %%i in ('git rev-parse --short HEAD') do set COMMIT=%%i
+go build -ldflags "-X main.gitCommit=%COMMIT%" -o main.exe .\src
\ No newline at end of file
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// 不输出访问日志的路径，由 -quiet-paths 配置，用于健康检查等高频探测
+var quietPaths = []string{"/healthz", "/readyz", "/metrics"}
+
+// 当前路由前缀，由 newMux 设置，静默名单按去掉前缀后的路径匹配
+var routePrefix string
+
+// parsePathList 解析逗号分隔的路径列表，缺少的前导 "/" 会被补上
+func parsePathList(list string) []string {
+	var paths []string
+	for _, p := range strings.Split(list, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, "/"+strings.TrimPrefix(p, "/"))
+		}
+	}
+	return paths
+}
+
+// isQuietPath 判断请求路径是否在静默名单中，去掉路由前缀后按完整路径匹配
+func isQuietPath(path string) bool {
+	rel, ok := strings.CutPrefix(path, routePrefix)
+	if !ok {
+		return false
+	}
+	for _, p := range quietPaths {
+		if rel == p {
+			return true
+		}
+	}
+	return false
+}
+
+// logRequest 输出访问日志，静默名单中的路径不输出
+func logRequest(r *http.Request, ip, port string) {
+	if isQuietPath(r.URL.Path) {
+		return
+	}
+	logAt(slog.LevelInfo, nil, "Request %s has been processed from IP: %s, Port: %s", r.URL.Path, ip, port)
+}
+
+// healthzHandler 供负载均衡和监控探测服务是否存活
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	ip, port, err := splitRemoteAddr(r.RemoteAddr)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Cannot resolve client address")
+		return
+	}
+	logRequest(r, ip, port)
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
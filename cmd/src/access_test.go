@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+// TestQuietPaths 静默名单中的路径不输出访问日志，其他路径照常输出；名单可配置
+func TestQuietPaths(t *testing.T) {
+	defaults := quietPaths
+	t.Cleanup(func() { quietPaths = defaults })
+	srv := startTestServer(t)
+	logs := captureLogs(t, "info")
+	get := func(path string) {
+		t.Helper()
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("get %s: %v", path, err)
+		}
+		resp.Body.Close()
+	}
+	logged := func(path string) bool { return logLine(logs, "Request "+path+" has been processed") != "" }
+
+	get("/healthz")
+	get("/metrics")
+	get("/clients")
+	if logged("/healthz") || logged("/metrics") || !logged("/clients") {
+		t.Fatalf("default quiet paths: want only /clients logged, got:\n%s", logs)
+	}
+	// 只匹配完整路径，以静默路径结尾的其他路径照常输出
+	if isQuietPath("/results/healthz") {
+		t.Error("/results/healthz treated as quiet")
+	}
+
+	quietPaths = parsePathList(" clients ,,/stats")
+	logs = captureLogs(t, "info")
+	get("/healthz")
+	get("/clients")
+	if !logged("/healthz") || logged("/clients") {
+		t.Fatalf("quiet paths %v: want only /healthz logged, got:\n%s", quietPaths, logs)
+	}
+	// 挂在路由前缀下的路径按去掉前缀后的部分匹配
+	startTestServerAt(t, "/review")
+	if !isQuietPath("/review/clients") || isQuietPath("/review/tasks") || isQuietPath("/other/clients") {
+		t.Error("quiet paths not matched under a base path")
+	}
+}
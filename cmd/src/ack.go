@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// 任务 id 的格式，与 newTaskID 生成的 16 位十六进制一致
+var taskIDPattern = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+// 单条确认消息最多携带的任务 id 数
+const maxAckIDs = 1024
+
+// parseAck 解析确认消息的 data：
+//
+//	{"ack_ids": ["9f2c...", "41ab...", ...]}
+//
+// 任一 id 格式不合法时整条消息都被拒绝
+func parseAck(data map[string]interface{}) ([]string, error) {
+	raw, ok := data["ack_ids"]
+	if !ok {
+		return nil, fmt.Errorf("missing ack_ids field")
+	}
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("ack_ids must be an array, got %T", raw)
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("ack_ids is empty")
+	}
+	if len(list) > maxAckIDs {
+		return nil, fmt.Errorf("ack_ids has %d ids, limit is %d", len(list), maxAckIDs)
+	}
+	ids := make([]string, 0, len(list))
+	for i, item := range list {
+		id, ok := item.(string)
+		if !ok || !taskIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("ack_ids[%d] is not a valid task id", i)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// ack 在一次加锁中将一批任务标记为已确认，已完成的任务保持原状态。返回未知（未登记或已淘汰）的任务 id
+func (s *taskStore) ack(ids []string, reviewer string, now time.Time) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var unknown []string
+	for _, id := range ids {
+		record, ok := s.records[id]
+		if !ok {
+			unknown = append(unknown, id)
+			continue
+		}
+		if record.Status == taskPending {
+			record.Status = taskAcknowledged
+			record.AckedAt = &now
+			record.Reviewer = reviewer
+		}
+	}
+	return unknown
+}
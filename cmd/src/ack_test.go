@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestAckBatch 一条确认消息将三个任务同时标记为已确认；未知的 id 记录警告，格式不合法的 id 使整条消息被拒绝
+func TestAckBatch(t *testing.T) {
+	srv := startTestServer(t)
+	logs := captureLogs(t, "warn")
+	client := dialTestClient(t, srv, "client_id=acker")
+	waitClients(t, 1)
+
+	ids := []string{postTask(t, srv, "m1"), postTask(t, srv, "m1"), postTask(t, srv, "m1")}
+	client.Send(protocolAck, map[string]any{"ack_ids": []string{ids[0], ids[1], ids[2], "0123456789abcdef"}})
+	for _, id := range ids {
+		waitFor(t, func() bool {
+			record, ok := tasks.get(id)
+			return ok && record.Status == taskAcknowledged && record.Reviewer == "acker" && record.AckedAt != nil
+		})
+	}
+	waitFor(t, func() bool { return logLine(logs, "Ack from acker for 1 unknown tasks: 0123456789abcdef") != "" })
+
+	pending := postTask(t, srv, "m1")
+	client.Send(protocolAck, map[string]any{"ack_ids": []string{pending, "NOT-A-TASK-ID"}})
+	if env := client.RecvProtocol(protocolError); !strings.Contains(env.Data["error"].(string), "ack_ids[1]") {
+		t.Fatalf("error reply %v, want ack_ids[1] reported", env.Data)
+	}
+	if record, _ := tasks.get(pending); record.Status != taskPending {
+		t.Errorf("task %s is %s after a rejected ack, want pending", pending, record.Status)
+	}
+}
+
+// TestParseAck 缺少、为空、不是数组或超过上限的 ack_ids 被拒绝
+func TestParseAck(t *testing.T) {
+	tooMany := make([]any, maxAckIDs+1)
+	for i := range tooMany {
+		tooMany[i] = "0123456789abcdef"
+	}
+	for name, data := range map[string]map[string]any{
+		"missing":   {},
+		"empty":     {"ack_ids": []any{}},
+		"not array": {"ack_ids": "0123456789abcdef"},
+		"not str":   {"ack_ids": []any{1}},
+		"too many":  {"ack_ids": tooMany},
+	} {
+		if _, err := parseAck(data); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ageRange 按连接时长筛选广播的接收者，min 和 max 为 0 表示不限制该端。
+// 用于灰度下发新格式的任务：只有较晚连接（可能已运行新版本）的客户端收到
+type ageRange struct {
+	min time.Duration
+	max time.Duration
+}
+
+// matches 判断在 now 时刻连接时长是否落在范围内
+func (a ageRange) matches(connectedAt, now time.Time) bool {
+	age := now.Sub(connectedAt)
+	return (a.min == 0 || age >= a.min) && (a.max == 0 || age <= a.max)
+}
+
+// parseAgeParams 解析 /tasks 可选的 min_age 和 max_age 参数，格式如 30s、10m，
+// 只发给连接时长不少于 min_age、不超过 max_age 的客户端
+func parseAgeParams(r *http.Request) (ageRange, error) {
+	var age ageRange
+	for _, p := range []struct {
+		name string
+		dst  *time.Duration
+	}{{"min_age", &age.min}, {"max_age", &age.max}} {
+		param := r.URL.Query().Get(p.name)
+		if param == "" {
+			continue
+		}
+		d, err := time.ParseDuration(param)
+		if err != nil || d <= 0 {
+			return age, fmt.Errorf("%s must be a positive duration such as 30s or 10m", p.name)
+		}
+		*p.dst = d
+	}
+	if age.min > 0 && age.max > 0 && age.min > age.max {
+		return age, fmt.Errorf("min_age must not exceed max_age")
+	}
+	return age, nil
+}
+
+// accepts 判断客户端是否应收到该广播：订阅、能力声明和连接时长都需匹配
+func (m broadcastMeta) accepts(client *Client, now time.Time) bool {
+	return client.wants(m.tasks) && m.age.matches(client.connectedAt, now)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestAgeFilter 带 max_age 的任务只发给较晚连接的客户端，带 min_age 的只发给较早连接的客户端；参数不合法返回 400
+func TestAgeFilter(t *testing.T) {
+	srv := startTestServer(t)
+	old := dialTestClient(t, srv, "client_id=old")
+	waitClients(t, 1)
+	time.Sleep(800 * time.Millisecond)
+	young := dialTestClient(t, srv, "client_id=young")
+	waitClients(t, 2)
+
+	post := func(query string) int {
+		t.Helper()
+		resp, err := http.Post(srv.URL+"/tasks?address=/img/1.jpg&version=v1&"+query, "", nil)
+		if err != nil {
+			t.Fatalf("post task: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	post("model=canary&max_age=400ms")
+	post("model=legacy&min_age=400ms")
+	post("model=all")
+	expectTasks(t, old, taskKey{"legacy", "v1"}, taskKey{"all", "v1"})
+	expectTasks(t, young, taskKey{"canary", "v1"}, taskKey{"all", "v1"})
+
+	for _, query := range []string{"model=m&min_age=soon", "model=m&max_age=-1s", "model=m&min_age=2m&max_age=1m"} {
+		if status := post(query); status != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", query, status)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// announcement 是 POST /announce 的请求体，也是下发给客户端的 data
+type announcement struct {
+	Message string `json:"message"`
+	// 距离维护开始的分钟数，可选
+	Minutes int `json:"minutes,omitempty"`
+}
+
+// announceHandler 向所有客户端广播服务公告（protocol_id = protocolAnnounce），
+// 如维护前的停机通知，复判端应将其展示给用户。公告以高优先级投递，先于积压的任务写出
+func announceHandler(w http.ResponseWriter, r *http.Request) {
+	ip, port, err := splitRemoteAddr(r.RemoteAddr)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Cannot resolve client address")
+		return
+	}
+	logRequest(r, ip, port)
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	var a announcement
+	if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid announcement JSON: "+err.Error())
+		return
+	}
+	if a.Message == "" {
+		writeError(w, http.StatusBadRequest, "message is required")
+		return
+	}
+	if a.Minutes < 0 {
+		writeError(w, http.StatusBadRequest, "minutes must not be negative")
+		return
+	}
+
+	envelope := map[string]interface{}{
+		"protocol_id": protocolAnnounce,
+		"data":        a,
+		"timestamp":   time.Now().UnixMilli(),
+	}
+	jsonMsg, err := encodeSigned(envelope)
+	if err != nil {
+		errorf("JSON marshaling error: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+	infof("Announcing to clients: %s", a.Message)
+	delivered, err := hub.submit(jsonMsg, priorityHigh)
+	if err != nil {
+		writeSubmitError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":    "ok",
+		"delivered": delivered,
+	})
+}
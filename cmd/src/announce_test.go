@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestAnnounce 公告经管理令牌鉴权后广播给所有客户端
+func TestAnnounce(t *testing.T) {
+	srv := startTestServer(t)
+	clients := []*testClient{dialTestClient(t, srv, ""), dialTestClient(t, srv, "")}
+	waitClients(t, len(clients))
+
+	status, body := adminRequestBody(t, srv, http.MethodPost, "/announce", `{"message":"maintenance","minutes":10}`)
+	if status != http.StatusOK {
+		t.Fatalf("announce: status %d: %s", status, body)
+	}
+	for _, client := range clients {
+		got := client.RecvProtocol(protocolAnnounce)
+		if got.Data["message"] != "maintenance" || fmt.Sprint(got.Data["minutes"]) != "10" {
+			t.Fatalf("received %v, want message maintenance, minutes 10", got.Data)
+		}
+	}
+
+	for _, tc := range []struct {
+		name, method, body string
+		want               int
+	}{
+		{"empty message", http.MethodPost, `{"message":""}`, http.StatusBadRequest},
+		{"negative minutes", http.MethodPost, `{"message":"x","minutes":-1}`, http.StatusBadRequest},
+		{"get", http.MethodGet, "", http.StatusMethodNotAllowed},
+	} {
+		if status, body := adminRequestBody(t, srv, tc.method, "/announce", tc.body); status != tc.want {
+			t.Errorf("%s: status %d, want %d: %s", tc.name, status, tc.want, body)
+		}
+	}
+
+	// 未携带令牌时拒绝
+	prev := access.Load()
+	access.Store(&accessControl{adminToken: testAdminToken})
+	defer access.Store(prev)
+	resp, err := http.Post(srv.URL+"/announce", "application/json", strings.NewReader(`{"message":"x"}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("without token: status %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+}
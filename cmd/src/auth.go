@@ -0,0 +1,27 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// requireAdmin 要求请求携带 Authorization: Bearer <adminToken>，否则返回 401。
+// 管理接口的访问令牌由 -admin-token 配置，可通过 /reload 或 SIGHUP 重新加载，为空时管理接口不可用
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		adminToken := currentAccess().adminToken
+		if adminToken == "" {
+			writeError(w, http.StatusForbidden, "Admin endpoints are disabled, set -admin-token to enable")
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			warnf("Unauthorized request %s from %s", r.URL.Path, r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// /tasks/batch 请求体的最大长度
+const maxBatchBody = 1 << 20
+
+// /tasks/batch 一批最多包含的任务数
+const maxBatchTasks = 1000
+
+// batchTask 是 /tasks/batch 请求体数组中的单个任务，字段含义与 /tasks 的查询参数一致
+type batchTask struct {
+	Address string `json:"address"`
+	Model   string `json:"model"`
+	Version string `json:"version"`
+}
+
+// tasksBatchHandler 接收 POST 的任务数组，并作为一条广播整体下发：
+//
+//	{
+//	   "protocol_id": 1,
+//	   "data": { "tasks": [ {"task_id": ..., "host": ..., "target": ..., "model": ..., "version": ..., "source": ...}, ... ] },
+//	   "timestamp": number
+//	}
+//
+// 与其他协议一致 data 为对象，任务数组放在 tasks 字段中，复判端按数组顺序逐个处理。
+// 只要有一个任务不合法，整批都不会广播，并返回 400 及该任务的下标。
+// 请求体超过 maxBatchBody 返回 413，任务数超过 maxBatchTasks 返回 400。
+// 与 /tasks 一样复判异步完成，返回 202 及每个任务结果的查询地址
+func tasksBatchHandler(w http.ResponseWriter, r *http.Request) {
+	ip, port, err := splitRemoteAddr(r.RemoteAddr)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Cannot resolve client address")
+		return
+	}
+	logRequest(r, ip, port)
+	if rejectIfNotReady(w) || rejectIfDraining(w) || rejectIfPaused(w) {
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	ttl, err := parseTTLParam(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	source, err := inspectorSource(r, ip)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var rawTasks []json.RawMessage
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatchBody)).Decode(&rawTasks); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, "Request body too large: "+err.Error())
+			return
+		}
+		writeError(w, http.StatusBadRequest, "Request body must be a JSON array of tasks: "+err.Error())
+		return
+	}
+	if len(rawTasks) == 0 {
+		writeError(w, http.StatusBadRequest, "Task batch is empty")
+		return
+	}
+	if len(rawTasks) > maxBatchTasks {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Task batch has %d tasks, at most %d allowed", len(rawTasks), maxBatchTasks))
+		return
+	}
+
+	data := make([]InspectorResult, 0, len(rawTasks))
+	taskIDs := make([]string, 0, len(rawTasks))
+	for i, raw := range rawTasks {
+		var task batchTask
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&task); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid task at index %d: %v", i, err))
+			return
+		}
+		if task.Address == "" {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid task at index %d: address is required", i))
+			return
+		}
+		if err := validateTask(map[string]string{
+			"address": task.Address,
+			"model":   task.Model,
+			"version": task.Version,
+		}); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid task at index %d: %v", i, err))
+			return
+		}
+		taskIDs = append(taskIDs, newTaskID())
+		data = append(data, InspectorResult{
+			TaskID:  taskIDs[i],
+			Host:    ip,
+			Target:  strings.TrimPrefix(task.Address, resultPrefix),
+			Model:   task.Model,
+			Version: task.Version,
+			Source:  source,
+		})
+	}
+	stats.totalTasks.Add(int64(len(data)))
+
+	jsonMsg, err := encodeSigned(TaskBatchMessage{
+		ProtocolID: 1,
+		Data:       TaskBatch{Tasks: data},
+		Timestamp:  time.Now().UnixMilli(),
+		TTL:        ttl,
+	})
+	if err != nil {
+		errorf("JSON marshaling error: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	infof("////////Review_2:Start_batch_broadcast////////%s tasks=%d", ip, len(data))
+	now := time.Now()
+	for _, id := range taskIDs {
+		tasks.add(id, now)
+	}
+	delivered, err := hub.submit(jsonMsg, priorityNormal)
+	if err != nil {
+		tasks.remove(taskIDs...)
+		writeSubmitError(w, err)
+		return
+	}
+
+	writeBatchResult(w, r, taskIDs, delivered)
+}
+
+// writeBatchResult 写出批量广播的 202 响应。一批有多个任务，结果地址不放在 Location 头中，
+// 而是在 JSON 的 locations 中与 task_ids 一一对应，纯文本响应则逐行列出
+func writeBatchResult(w http.ResponseWriter, r *http.Request, taskIDs []string, delivered int) {
+	locations := make([]string, len(taskIDs))
+	for i, id := range taskIDs {
+		locations[i] = taskLocation(r, id)
+	}
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusAccepted, map[string]interface{}{
+			"status":      "ok",
+			"broadcasted": len(taskIDs),
+			"delivered":   delivered,
+			"task_ids":    taskIDs,
+			"locations":   locations,
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(w, "Request /tasks/batch processed and %d tasks broadcasted to websocket clients.\n", len(taskIDs))
+	if delivered == 0 {
+		fmt.Fprintln(w, "No websocket clients received it.")
+	}
+	for _, location := range locations {
+		fmt.Fprintln(w, location)
+	}
+}
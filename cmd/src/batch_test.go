@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// postBatch 以 JSON 请求 POST /tasks/batch，返回状态码和解码后的响应
+func postBatch(t *testing.T, srv *httptest.Server, body string) (int, map[string]any) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/tasks/batch", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("post /tasks/batch: %v", err)
+	}
+	defer resp.Body.Close()
+	var result map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("decode /tasks/batch: %v", err)
+	}
+	return resp.StatusCode, result
+}
+
+// TestTasksBatch 含非法任务的批次整体拒绝并指出下标，合法的批次作为一条广播按顺序下发
+func TestTasksBatch(t *testing.T) {
+	srv := startTestServer(t)
+	client := dialTestClient(t, srv, "")
+	waitClients(t, 1)
+
+	for body, index := range map[string]string{
+		`[{"address":"/img/1.jpg","model":"m1","version":"v1"},{"model":"m1"}]`:                                                                               "index 1",
+		`[{"address":"/img/1.jpg","model":"m1","version":"v1"},{"address":"/img/2.jpg","model":"m1","version":"v1"},{"address":"/img/3.jpg","colour":"red"}]`: "index 2",
+	} {
+		before := stats.totalTasks.Load()
+		status, result := postBatch(t, srv, body)
+		if msg, _ := result["error"].(string); status != http.StatusBadRequest || !strings.Contains(msg, index) {
+			t.Errorf("batch %s = %d %v, want 400 naming %s", body, status, result, index)
+		}
+		if n := stats.totalTasks.Load(); n != before {
+			t.Errorf("rejected batch counted %d tasks", n-before)
+		}
+	}
+	for _, body := range []string{`[]`, `{"address":"/img/1.jpg"}`} {
+		if status, _ := postBatch(t, srv, body); status != http.StatusBadRequest {
+			t.Errorf("batch %s = %d, want 400", body, status)
+		}
+	}
+
+	status, result := postBatch(t, srv, `[{"address":"/img/1.jpg","model":"m1","version":"v1"},{"address":"/img/2.jpg","model":"m2","version":"v1"}]`)
+	ids, _ := result["task_ids"].([]any)
+	locations, _ := result["locations"].([]any)
+	if status != http.StatusAccepted || len(ids) != 2 || len(locations) != 2 || result["delivered"] != float64(1) {
+		t.Fatalf("valid batch = %d %v, want 202 with 2 task ids delivered to 1 client", status, result)
+	}
+	for i, location := range locations {
+		if location != "/results/"+ids[i].(string) {
+			t.Errorf("location %d = %v, want /results/%v", i, location, ids[i])
+		}
+	}
+	// 拒绝的批次没有下发，收到的第一条任务广播就是这一批
+	env := client.RecvProtocol(1)
+	batch, _ := env.Data["tasks"].([]any)
+	if len(batch) != 2 {
+		t.Fatalf("broadcast data %v, want 2 tasks", env.Data)
+	}
+	for i, target := range []string{"/img/1.jpg", "/img/2.jpg"} {
+		task, _ := batch[i].(map[string]any)
+		if task["task_id"] != ids[i] || task["target"] != target {
+			t.Errorf("task %d = %v, want task_id %v and target %s", i, task, ids[i], target)
+		}
+	}
+}
+
+// TestTasksBatchLimits 超过任务数上限的批次返回 400，超过请求体上限的返回 413，均不计入任务数
+func TestTasksBatchLimits(t *testing.T) {
+	srv := startTestServer(t)
+	task := `{"address":"/img/1.jpg","model":"m1","version":"v1"}`
+	before := stats.totalTasks.Load()
+
+	if status, result := postBatch(t, srv, "["+strings.Repeat(task+",", maxBatchTasks)+task+"]"); status != http.StatusBadRequest {
+		t.Errorf("batch of %d tasks = %d %v, want 400", maxBatchTasks+1, status, result)
+	}
+	padding := `{"address":"/img/1.jpg","model":"` + strings.Repeat("m", maxBatchBody) + `"}`
+	if status, result := postBatch(t, srv, "["+padding+"]"); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized batch = %d %v, want 413", status, result)
+	}
+	if n := stats.totalTasks.Load(); n != before {
+		t.Errorf("rejected batches counted %d tasks", n-before)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+)
+
+// 无客户端在线时是否将广播保留给之后第一个连接的客户端，由 -buffer-when-empty 配置
+var bufferWhenEmpty = true
+
+// 无客户端队列长度的默认值，小于客户端的发送缓冲，第一个连接的客户端可以一次收下
+const defaultOrphanQueue = 128
+
+// 无客户端在线时最多保留的广播条数，由 -orphan-queue 配置。与重放缓冲分开，不会被之后的广播挤掉；
+// 队列已满时提交方收到 errOrphanQueueFull，/tasks 等接口返回 503，而不是接受后再丢弃
+var orphanQueueSize = defaultOrphanQueue
+
+var errOrphanQueueFull = errors.New("no clients connected and the orphan queue is full")
+
+// priority 是消息的投递优先级，客户端积压时高优先级消息先于普通任务写出
+type priority int
+
+const (
+	priorityNormal priority = iota
+	// 公告、探测等需要插队的消息
+	priorityHigh
+)
+
+// 客户端高优先级发送缓冲的容量
+const highPrioritySendBuffer = 64
+
+// /broadcast/binary 请求体的最大长度
+const maxBinaryBroadcast = 1 << 20
+
+// broadcastRequest 是提交给 Hub 的一条广播，delivered 用于回传收到广播的客户端数
+type broadcastRequest struct {
+	// WebSocket 帧类型，websocket.TextMessage 或 websocket.BinaryMessage
+	msgType  int
+	data     []byte
+	priority priority
+	// 只发给连接时长在此范围内的客户端，零值表示不限制
+	age       ageRange
+	delivered chan broadcastResult
+}
+
+// broadcastResult 是一条广播的分发结果：放入发送缓冲的客户端数，或广播未被接受的原因
+type broadcastResult struct {
+	n   int
+	err error
+}
+
+// reply 回传分发结果，delivered 带缓冲，不会阻塞 run()
+func (req broadcastRequest) reply(n int, err error) {
+	if req.delivered != nil {
+		req.delivered <- broadcastResult{n: n, err: err}
+	}
+}
+
+// binaryBroadcastHandler 将请求体作为二进制帧原样广播给所有客户端，用于转发预先编码好的数据
+func binaryBroadcastHandler(w http.ResponseWriter, r *http.Request) {
+	ip, port, err := splitRemoteAddr(r.RemoteAddr)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Cannot resolve client address")
+		return
+	}
+	logRequest(r, ip, port)
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBinaryBroadcast))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, "Request body too large: "+err.Error())
+		return
+	}
+	if len(payload) == 0 {
+		writeError(w, http.StatusBadRequest, "Request body is empty")
+		return
+	}
+	delivered, err := hub.submitFrame(websocket.BinaryMessage, payload, priorityNormal)
+	if err != nil {
+		writeSubmitError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":    "ok",
+		"delivered": delivered,
+	})
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestBroadcastNoClients 无客户端时广播进入无客户端队列，第一个连接的客户端收到；队列已满时返回错误
+func TestBroadcastNoClients(t *testing.T) {
+	orphanQueueSize = 2
+	defer func() { orphanQueueSize = defaultOrphanQueue }()
+	srv := startTestServer(t)
+
+	first := postTask(t, srv, "m1")
+	second := postTask(t, srv, "m1")
+	resp, err := http.Post(srv.URL+"/tasks?address=/img/3.jpg&model=m1&version=v1", "", nil)
+	if err != nil {
+		t.Fatalf("post task: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("status %d with a full orphan queue, want 503", resp.StatusCode)
+	}
+
+	client := dialTestClient(t, srv, "")
+	for _, id := range []string{first, second} {
+		var task InspectorResult
+		if err := client.RecvProtocol(1).decodeData(&task); err != nil || task.TaskID != id {
+			t.Fatalf("received task %+v (%v), want %s", task, err, id)
+		}
+	}
+	// 补发后队列已空，再次断开时可以继续缓冲
+	hub.query(func() {
+		if len(hub.orphans) != 0 {
+			t.Errorf("%d orphans left after delivery", len(hub.orphans))
+		}
+	})
+}
+
+// TestBroadcastNoClientsUnbuffered 关闭缓冲时无客户端的广播不分发，之后连接的客户端也收不到
+func TestBroadcastNoClientsUnbuffered(t *testing.T) {
+	bufferWhenEmpty = false
+	defer func() { bufferWhenEmpty = true }()
+	startTestServer(t)
+	if delivered, err := hub.submit([]byte(`{"protocol_id":1,"data":{}}`), priorityNormal); err != nil || delivered != 0 {
+		t.Fatalf("delivered %d, %v, want 0 and no error", delivered, err)
+	}
+	hub.query(func() {
+		if len(hub.orphans) != 0 {
+			t.Errorf("broadcast buffered with -buffer-when-empty=false")
+		}
+	})
+}
+
+// TestOrphansKeptWhenSendBufferFull 新客户端的发送缓冲放不下时，剩余的广播留给下一个客户端
+func TestOrphansKeptWhenSendBufferFull(t *testing.T) {
+	startTestServer(t)
+	for i := 0; i < 3; i++ {
+		if _, err := hub.submit([]byte(`{"protocol_id":1,"data":{}}`), priorityNormal); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+	// 欢迎消息和续传令牌之后只能再放下一条
+	client := &Client{hub: hub, id: "small", send: make(chan outMessage, 3), sendHigh: make(chan outMessage, 1), closing: make(chan struct{})}
+	hub.join(client)
+	hub.query(func() {
+		if len(hub.orphans) != 2 {
+			t.Errorf("%d orphans kept, want 2", len(hub.orphans))
+		}
+	})
+}
+
+// TestClientSendTimeout 发送缓冲已满的客户端在 -client-send-timeout 内腾出空间时不会被移除，超时仍满才被移除
+func TestClientSendTimeout(t *testing.T) {
+	clientSendTimeout = 500 * time.Millisecond
+	t.Cleanup(func() { clientSendTimeout = 0 })
+	startTestServer(t)
+	client := fakeClient("slow")
+	hub.join(client)
+	waitFor(t, func() bool { return len(client.send) == cap(client.send) })
+
+	// 缓冲已被欢迎消息和续传令牌占满，客户端稍后才取走一条
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		<-client.send
+	}()
+	start := time.Now()
+	if delivered, err := hub.submit([]byte(`{"protocol_id":1,"data":{}}`), priorityNormal); err != nil || delivered != 1 {
+		t.Fatalf("delivered to %d clients, %v; want the slow client to catch up", delivered, err)
+	}
+	if waited := time.Since(start); waited < 50*time.Millisecond || waited >= clientSendTimeout {
+		t.Errorf("broadcast took %v, want between the drain delay and the timeout", waited)
+	}
+	waitClients(t, 1)
+
+	// 超时仍未腾出空间的客户端被移除
+	start = time.Now()
+	if delivered, _ := hub.submit([]byte(`{"protocol_id":1,"data":{}}`), priorityNormal); delivered != 0 {
+		t.Fatalf("delivered to %d clients, want the stalled client dropped", delivered)
+	}
+	if waited := time.Since(start); waited < clientSendTimeout {
+		t.Errorf("stalled client dropped after %v, before the %v timeout", waited, clientSendTimeout)
+	}
+	waitClients(t, 0)
+	if client.dropped.Load() != 1 {
+		t.Errorf("dropped %d messages, want 1", client.dropped.Load())
+	}
+}
+
+// TestPriorityOrder 客户端写入受阻时，后提交的高优先级消息先于排队的普通消息写出
+func TestPriorityOrder(t *testing.T) {
+	srv := startTestServer(t)
+	client, ws := dialFaulty(t, srv)
+
+	ws.hold.Lock()
+	postTask(t, srv, "first")
+	waitFor(t, func() bool { return ws.waiting.Load() == 1 })
+	for _, model := range []string{"low1", "low2", "low3"} {
+		postTask(t, srv, model)
+	}
+	if _, err := hub.submit([]byte(`{"protocol_id":200,"data":{"message":"urgent"}}`), priorityHigh); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	ws.hold.Unlock()
+
+	if env := client.RecvProtocol(1); env.Data["model"] != "first" {
+		t.Fatalf("received %v, want first", env.Data)
+	}
+	var order []string
+	for len(order) < 4 {
+		switch env := client.Recv(); env.ProtocolID {
+		case 1:
+			order = append(order, env.Data["model"].(string))
+		case protocolAnnounce:
+			order = append(order, env.Data["message"].(string))
+		}
+	}
+	if want := []string{"urgent", "low1", "low2", "low3"}; fmt.Sprint(order) != fmt.Sprint(want) {
+		t.Fatalf("delivery order %v, want %v", order, want)
+	}
+}
+
+// TestDropCounters 发送缓冲已满被移除的客户端计入一条丢弃的消息，/stats 的 dropped_messages 随之增加，断开日志带有丢弃数
+func TestDropCounters(t *testing.T) {
+	srv := startTestServer(t)
+	logs := captureLogs(t, "warn")
+	var before StatsSnapshot
+	getJSON(t, srv, "/stats", &before)
+
+	client := fakeClient("full")
+	hub.join(client)
+	if _, err := hub.submit([]byte(`{"protocol_id":1,"data":{"model":"m1"}}`), priorityNormal); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	waitClients(t, 0)
+	if client.dropped.Load() != 1 {
+		t.Errorf("client dropped %d messages, want 1", client.dropped.Load())
+	}
+	var after StatsSnapshot
+	getJSON(t, srv, "/stats", &after)
+	if n := after.DroppedMessages - before.DroppedMessages; n != 1 {
+		t.Errorf("dropped_messages +%d, want +1", n)
+	}
+	if logLine(logs, "Client dropped, send buffer full: full, dropped messages: 1") == "" {
+		t.Errorf("no drop line in logs:\n%s", logs)
+	}
+}
+
+// TestBinaryBroadcast /broadcast/binary 的请求体以二进制帧原样下发，之后的文本广播仍为文本帧；空请求体返回 400
+func TestBinaryBroadcast(t *testing.T) {
+	srv := startTestServer(t)
+	clients := []*testClient{dialTestClient(t, srv, ""), dialTestClient(t, srv, "")}
+	waitClients(t, len(clients))
+
+	payload := "\x00\x01binary\xff\xfe"
+	if status, body := adminRequestBody(t, srv, http.MethodPost, "/broadcast/binary", payload); status != http.StatusOK {
+		t.Fatalf("binary broadcast: status %d: %s", status, body)
+	}
+	postTask(t, srv, "after")
+	for _, client := range clients {
+		for {
+			client.conn.SetReadDeadline(time.Now().Add(testRecvTimeout))
+			messageType, frame, err := client.conn.ReadMessage()
+			if err != nil {
+				t.Fatalf("recv: %v", err)
+			}
+			if messageType == websocket.BinaryMessage {
+				if string(frame) != payload {
+					t.Fatalf("binary frame %q, want %q", frame, payload)
+				}
+				break
+			}
+		}
+		if env := client.RecvProtocol(1); env.Data["model"] != "after" {
+			t.Errorf("received %v, want the task as a text frame", env.Data)
+		}
+	}
+
+	if status, _ := adminRequestBody(t, srv, http.MethodPost, "/broadcast/binary", ""); status != http.StatusBadRequest {
+		t.Errorf("empty body: status %d, want %d", status, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// parseCapabilities 解析能力声明消息的 data：
+//
+//	{"capabilities": [{"model": "A", "version": "1.0"}, {"model": "B"}]}
+//
+// version 为空表示该型号的所有版本；空数组表示可处理所有任务
+func parseCapabilities(data map[string]interface{}) ([]taskKey, error) {
+	raw, ok := data["capabilities"]
+	if !ok {
+		return nil, fmt.Errorf("missing capabilities field")
+	}
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("capabilities must be an array, got %T", raw)
+	}
+	caps := make([]taskKey, 0, len(list))
+	for i, item := range list {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("capabilities[%d] must be an object", i)
+		}
+		model, _ := obj["model"].(string)
+		if model == "" {
+			return nil, fmt.Errorf("capabilities[%d].model must be a non-empty string", i)
+		}
+		version, ok := obj["version"].(string)
+		if _, present := obj["version"]; present && !ok {
+			return nil, fmt.Errorf("capabilities[%d].version must be a string", i)
+		}
+		caps = append(caps, taskKey{Model: model, Version: version})
+	}
+	return caps, nil
+}
+
+// setCapabilities 更新客户端的能力声明，经由 run() 执行以避免与广播并发访问
+func (h *Hub) setCapabilities(client *Client, caps []taskKey) {
+	h.query(func() {
+		client.capabilities = caps
+	})
+}
+
+// matches 判断能力声明是否覆盖指定任务
+func (capability taskKey) matches(task taskKey) bool {
+	return capability.Model == task.Model && (capability.Version == "" || capability.Version == task.Version)
+}
+
+// capableOf 判断客户端能否处理任一任务，未声明能力的客户端视为通配
+func (c *Client) capableOf(tasks []taskKey) bool {
+	if len(c.capabilities) == 0 {
+		return true
+	}
+	for _, task := range tasks {
+		for _, capability := range c.capabilities {
+			if capability.matches(task) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReviewerInfo 是 /reviewers 接口中单个可处理任务的复判端
+type ReviewerInfo struct {
+	ID     string `json:"id"`
+	ConnID string `json:"conn_id"`
+	// 声明的能力，为空表示未声明、可处理所有任务
+	Capabilities []taskKey `json:"capabilities"`
+}
+
+// listReviewers 返回会收到该任务广播的客户端，即订阅和能力声明都匹配的客户端，按 id 排序
+func (h *Hub) listReviewers(task taskKey) []ReviewerInfo {
+	infos := []ReviewerInfo{}
+	for _, member := range h.members() {
+		member.query(func() {
+			for client := range member.clients {
+				if client.wants([]taskKey{task}) {
+					infos = append(infos, ReviewerInfo{
+						ID:           client.id,
+						ConnID:       client.connID,
+						Capabilities: append([]taskKey{}, client.capabilities...),
+					})
+				}
+			}
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// reviewersHandler 供检测端在下发任务前查询是否有可处理该型号和版本的复判端在线，
+// 没有匹配时返回空数组
+func reviewersHandler(w http.ResponseWriter, r *http.Request) {
+	ip, port, err := splitRemoteAddr(r.RemoteAddr)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Cannot resolve client address")
+		return
+	}
+	logRequest(r, ip, port)
+
+	task := taskKey{
+		Model:   r.URL.Query().Get("model"),
+		Version: r.URL.Query().Get("version"),
+	}
+	if task.Model == "" {
+		writeError(w, http.StatusBadRequest, "Missing model parameter")
+		return
+	}
+	writeJSON(w, http.StatusOK, hub.listReviewers(task))
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// postModelTask 以 /tasks 广播指定型号和版本的任务
+func postModelTask(t *testing.T, srv *httptest.Server, model, version string) {
+	t.Helper()
+	resp, err := http.Post(srv.URL+"/tasks?address=/img/1.jpg&model="+model+"&version="+version, "", nil)
+	if err != nil {
+		t.Fatalf("post task: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("post %s/%s: status %d", model, version, resp.StatusCode)
+	}
+}
+
+// expectTasks 依次收取任务广播，检查型号和版本
+func expectTasks(t *testing.T, client *testClient, keys ...taskKey) {
+	t.Helper()
+	for _, key := range keys {
+		env := client.RecvProtocol(1)
+		if env.Data["model"] != key.Model || env.Data["version"] != key.Version {
+			t.Fatalf("received %v, want %s/%s", env.Data, key.Model, key.Version)
+		}
+	}
+}
+
+// TestCapabilities 声明了能力的复判端只收到匹配型号和版本的任务，未声明版本时匹配该型号的所有版本，
+// 未声明能力的复判端收到全部任务
+func TestCapabilities(t *testing.T) {
+	srv := startTestServer(t)
+	exact := dialTestClient(t, srv, "client_id=exact")
+	anyVersion := dialTestClient(t, srv, "client_id=any-version")
+	wildcard := dialTestClient(t, srv, "client_id=wildcard")
+	exact.Send(protocolCapabilities, map[string]any{"capabilities": []map[string]string{{"model": "m1", "version": "v1"}}})
+	anyVersion.Send(protocolCapabilities, map[string]any{"capabilities": []map[string]string{{"model": "m2"}}})
+	waitFor(t, func() bool {
+		return len(hub.listReviewers(taskKey{Model: "m1", Version: "v1"})) == 2 && len(hub.listReviewers(taskKey{Model: "m2", Version: "v9"})) == 2
+	})
+
+	sent := []taskKey{{"m1", "v1"}, {"m2", "v1"}, {"m1", "v2"}, {"m3", "v1"}, {"m2", "v9"}, {"m1", "v1"}}
+	for _, key := range sent {
+		postModelTask(t, srv, key.Model, key.Version)
+	}
+	expectTasks(t, wildcard, sent...)
+	expectTasks(t, exact, taskKey{"m1", "v1"}, taskKey{"m1", "v1"})
+	expectTasks(t, anyVersion, taskKey{"m2", "v1"}, taskKey{"m2", "v9"})
+
+	// 不合法的能力声明回复错误消息，原有声明保持不变
+	exact.SendRaw(map[string]any{"protocol_id": protocolCapabilities, "id": "caps-2", "data": map[string]any{"capabilities": []map[string]string{{"version": "v1"}}}})
+	if env := exact.RecvProtocol(protocolError); env.ID != "caps-2" || env.Data["error"] != "capabilities[0].model must be a non-empty string" {
+		t.Fatalf("unexpected error reply %+v", env)
+	}
+	postModelTask(t, srv, "m3", "v1")
+	postModelTask(t, srv, "m1", "v1")
+	expectTasks(t, exact, taskKey{"m1", "v1"})
+}
+
+// TestReviewers /reviewers 只列出能力声明匹配型号和版本的复判端，没有匹配时返回空数组
+func TestReviewers(t *testing.T) {
+	srv := startTestServer(t)
+	exact := dialTestClient(t, srv, "client_id=exact")
+	otherVersion := dialTestClient(t, srv, "client_id=other-version")
+	anyVersion := dialTestClient(t, srv, "client_id=any-version")
+	exact.Send(protocolCapabilities, map[string]any{"capabilities": []map[string]string{{"model": "m1", "version": "v1"}}})
+	otherVersion.Send(protocolCapabilities, map[string]any{"capabilities": []map[string]string{{"model": "m1", "version": "v2"}}})
+	anyVersion.Send(protocolCapabilities, map[string]any{"capabilities": []map[string]string{{"model": "m1"}}})
+	waitFor(t, func() bool {
+		return len(hub.listReviewers(taskKey{Model: "m1", Version: "v3"})) == 1 && len(hub.listReviewers(taskKey{Model: "m1", Version: "v1"})) == 2 &&
+			len(hub.listReviewers(taskKey{Model: "m1", Version: "v2"})) == 2
+	})
+
+	for _, tc := range []struct {
+		query string
+		want  []string
+	}{
+		{"model=m1&version=v1", []string{"any-version", "exact"}},
+		{"model=m1&version=v2", []string{"any-version", "other-version"}},
+		{"model=m1&version=v3", []string{"any-version"}},
+		{"model=m2&version=v1", []string{}},
+	} {
+		var reviewers []ReviewerInfo
+		if status := getJSON(t, srv, "/reviewers?"+tc.query, &reviewers); status != http.StatusOK {
+			t.Fatalf("%s: status %d", tc.query, status)
+		}
+		if reviewers == nil {
+			t.Fatalf("%s: got null, want an array", tc.query)
+		}
+		ids := []string{}
+		for _, r := range reviewers {
+			ids = append(ids, r.ID)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(tc.want) {
+			t.Errorf("%s: reviewers %v, want %v", tc.query, ids, tc.want)
+		}
+	}
+
+	var body map[string]any
+	if status := getJSON(t, srv, "/reviewers?version=v1", &body); status != http.StatusBadRequest {
+		t.Errorf("missing model: status %d, want %d", status, http.StatusBadRequest)
+	}
+}
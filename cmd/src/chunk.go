@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 分片结果的默认上限
+const (
+	// 单个结果重组后的最大长度（字节）
+	defaultMaxChunkedResult = 1 << 20
+	// 每个客户端同时进行中的重组数
+	maxPendingChunkedResults = 8
+	// 单个结果最多的分片数
+	maxChunkParts = 256
+	// 每一片在长度上限中额外计入的字节数，对应保存分片的开销，避免大量很小的分片绕过长度上限
+	chunkPartOverhead = 64
+	// 未收齐的分片在最后一片到达后保留的时间
+	defaultChunkTimeout = 30 * time.Second
+)
+
+var (
+	// 由 -max-chunked-result 配置
+	maxChunkedResult = defaultMaxChunkedResult
+	// 由 -chunk-timeout 配置
+	chunkTimeout = defaultChunkTimeout
+)
+
+// resultChunk 是分片结果消息（protocol_id = protocolResultChunk）的 data：
+//
+//	{"id": "r1", "seq": 0, "total": 3, "final": false, "payload": "..."}
+//
+// 同一 id 的 total 片 payload 按 seq（从 0 开始）拼接后是一条完整的 protocol_id=2 消息。
+// total 必填且各片一致；final 可省略，给出时须与 seq 是否为最后一片一致
+type resultChunk struct {
+	id      string
+	seq     int
+	total   int
+	payload string
+}
+
+// parseResultChunk 解析并校验分片消息的 data
+func parseResultChunk(data map[string]interface{}) (resultChunk, error) {
+	var chunk resultChunk
+	chunk.id, _ = data["id"].(string)
+	if chunk.id == "" {
+		return chunk, fmt.Errorf("id must be a non-empty string")
+	}
+	var err error
+	if chunk.total, err = parseChunkIndex(data["total"], "total", 1, maxChunkParts); err != nil {
+		return chunk, err
+	}
+	if chunk.seq, err = parseChunkIndex(data["seq"], "seq", 0, chunk.total-1); err != nil {
+		return chunk, err
+	}
+	if raw, ok := data["final"]; ok {
+		final, ok := raw.(bool)
+		if !ok {
+			return chunk, fmt.Errorf("final must be a boolean")
+		}
+		if final != (chunk.seq == chunk.total-1) {
+			return chunk, fmt.Errorf("final is %t but seq %d of total %d", final, chunk.seq, chunk.total)
+		}
+	}
+	var ok bool
+	if chunk.payload, ok = data["payload"].(string); !ok {
+		return chunk, fmt.Errorf("payload must be a string")
+	}
+	if chunk.payload == "" {
+		return chunk, fmt.Errorf("payload must not be empty")
+	}
+	return chunk, nil
+}
+
+// parseChunkIndex 将 seq、total 等字段解析为 [min, max] 内的整数，只接受十进制整数写法，
+// 不接受 1.0、1e2 这类写法
+func parseChunkIndex(v interface{}, name string, min, max int) (int, error) {
+	num, ok := v.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("%s must be an integer", name)
+	}
+	n, err := strconv.Atoi(num.String())
+	if err != nil || n < min || n > max {
+		return 0, fmt.Errorf("%s must be an integer between %d and %d", name, min, max)
+	}
+	return n, nil
+}
+
+// chunkAssembly 是一个正在重组的分片结果
+type chunkAssembly struct {
+	parts []string
+	// 已收到的分片数
+	received int
+	// 已收到的 payload 长度加上每片的额外开销
+	size    int
+	updated time.Time
+}
+
+// chunkAssembler 按 id 重组同一客户端发来的分片结果，只在该客户端的 readPump 中使用
+type chunkAssembler struct {
+	pending map[string]*chunkAssembly
+}
+
+func newChunkAssembler() *chunkAssembler {
+	return &chunkAssembler{pending: make(map[string]*chunkAssembly)}
+}
+
+// add 加入一片，收齐时返回拼接后的完整消息。超过长度上限、total 与先前的分片不一致时丢弃该 id 并返回错误，
+// 重组数已达上限时拒绝新的 id
+func (a *chunkAssembler) add(chunk resultChunk, now time.Time) ([]byte, error) {
+	// 清理长时间未收齐的重组
+	for id, p := range a.pending {
+		if now.Sub(p.updated) > chunkTimeout {
+			delete(a.pending, id)
+		}
+	}
+	p, ok := a.pending[chunk.id]
+	if !ok {
+		if len(a.pending) >= maxPendingChunkedResults {
+			return nil, fmt.Errorf("too many chunked results in progress")
+		}
+		p = &chunkAssembly{parts: make([]string, chunk.total)}
+		a.pending[chunk.id] = p
+	}
+	if len(p.parts) != chunk.total {
+		delete(a.pending, chunk.id)
+		return nil, fmt.Errorf("chunk %d for %s has total %d, earlier chunks had %d", chunk.seq, chunk.id, chunk.total, len(p.parts))
+	}
+	if p.parts[chunk.seq] != "" {
+		return nil, fmt.Errorf("duplicate chunk %d for %s", chunk.seq, chunk.id)
+	}
+	if p.size+len(chunk.payload)+chunkPartOverhead > maxChunkedResult {
+		delete(a.pending, chunk.id)
+		return nil, fmt.Errorf("chunked result %s exceeds %d bytes", chunk.id, maxChunkedResult)
+	}
+	p.parts[chunk.seq] = chunk.payload
+	p.received++
+	p.size += len(chunk.payload) + chunkPartOverhead
+	p.updated = now
+
+	if p.received < len(p.parts) {
+		return nil, nil
+	}
+	delete(a.pending, chunk.id)
+	return []byte(strings.Join(p.parts, "")), nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestChunkedResult 超过单条消息上限的结果分三片乱序发送，重组后按 protocol_id=2 处理，任务变为完成
+func TestChunkedResult(t *testing.T) {
+	srv := startTestServer(t)
+	client := dialTestClient(t, srv, "client_id=reviewer-1")
+	waitClients(t, 1)
+
+	id := postTask(t, srv, "m1")
+	client.RecvProtocol(1)
+	diff := strings.Repeat("d", 2*maxMessageSize)
+	result, err := json.Marshal(map[string]any{
+		"protocol_id": 2,
+		"data":        map[string]any{"host": "10.0.0.1", "target": "/img/1.jpg", "model": "m1", "version": "v1", "task_id": id, "diff": diff},
+	})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	third := len(result) / 3
+	parts := []string{string(result[:third]), string(result[third : 2*third]), string(result[2*third:])}
+	for _, seq := range []int{2, 0, 1} {
+		client.Send(protocolResultChunk, map[string]any{"id": "r1", "seq": seq, "total": 3, "final": seq == 2, "payload": parts[seq]})
+	}
+
+	waitFor(t, func() bool {
+		record, ok := tasks.get(id)
+		return ok && record.Status == taskCompleted
+	})
+	record, _ := tasks.get(id)
+	if record.Reviewer != "reviewer-1" || !strings.Contains(string(record.Result), diff) {
+		t.Fatalf("completed by %q with %d byte result, want reviewer-1 with the reassembled diff", record.Reviewer, len(record.Result))
+	}
+}
+
+// TestParseResultChunk total 必填且有上限，seq 只接受 total 以内的十进制整数，final 须与 seq 一致，payload 不能为空
+func TestParseResultChunk(t *testing.T) {
+	valid := func() map[string]any {
+		return map[string]any{"id": "r1", "seq": json.Number("1"), "total": json.Number("3"), "payload": "x"}
+	}
+	if chunk, err := parseResultChunk(valid()); err != nil || chunk.seq != 1 || chunk.total != 3 {
+		t.Fatalf("valid chunk: %+v, %v", chunk, err)
+	}
+	for name, change := range map[string]func(map[string]any){
+		"missing total":    func(d map[string]any) { delete(d, "total") },
+		"zero total":       func(d map[string]any) { d["total"] = json.Number("0") },
+		"too many parts":   func(d map[string]any) { d["total"] = json.Number(strconv.Itoa(maxChunkParts + 1)) },
+		"seq past total":   func(d map[string]any) { d["seq"] = json.Number("3") },
+		"negative seq":     func(d map[string]any) { d["seq"] = json.Number("-1") },
+		"fractional seq":   func(d map[string]any) { d["seq"] = json.Number("1.0") },
+		"exponent seq":     func(d map[string]any) { d["seq"] = json.Number("1e0") },
+		"string seq":       func(d map[string]any) { d["seq"] = "1" },
+		"empty payload":    func(d map[string]any) { d["payload"] = "" },
+		"final mismatch":   func(d map[string]any) { d["final"] = true },
+		"final not a bool": func(d map[string]any) { d["final"] = "yes" },
+	} {
+		data := valid()
+		change(data)
+		if chunk, err := parseResultChunk(data); err == nil {
+			t.Errorf("%s: accepted as %+v", name, chunk)
+		}
+	}
+}
+
+// TestChunkAssembler 重复、total 不一致、超长、重组数过多的分片被拒绝，每片的开销计入长度上限，超时未收齐的重组被清理
+func TestChunkAssembler(t *testing.T) {
+	now := time.Now()
+	a := newChunkAssembler()
+	if out, err := a.add(resultChunk{id: "a", seq: 0, total: 2, payload: "x"}, now); out != nil || err != nil {
+		t.Fatalf("first chunk: %q, %v; want pending", out, err)
+	}
+	if _, err := a.add(resultChunk{id: "a", seq: 0, total: 2, payload: "x"}, now); err == nil {
+		t.Error("duplicate chunk accepted")
+	}
+	if out, err := a.add(resultChunk{id: "a", seq: 1, total: 2, payload: "y"}, now); string(out) != "xy" || err != nil {
+		t.Errorf("last chunk: %q, %v; want xy", out, err)
+	}
+	a.add(resultChunk{id: "b", seq: 0, total: 2, payload: "x"}, now)
+	if _, err := a.add(resultChunk{id: "b", seq: 2, total: 3, payload: "x"}, now); err == nil {
+		t.Error("chunk with a different total accepted")
+	}
+	if _, err := a.add(resultChunk{id: "c", seq: 0, total: 1, payload: strings.Repeat("x", maxChunkedResult)}, now); err == nil {
+		t.Error("oversized chunked result accepted")
+	}
+
+	// 很小的分片也按每片开销计入长度上限
+	defer func(saved int) { maxChunkedResult = saved }(maxChunkedResult)
+	maxChunkedResult = 4 * chunkPartOverhead
+	a = newChunkAssembler()
+	for seq := 0; seq < 3; seq++ {
+		if _, err := a.add(resultChunk{id: "d", seq: seq, total: maxChunkParts, payload: "x"}, now); err != nil {
+			t.Fatalf("chunk %d: %v", seq, err)
+		}
+	}
+	if _, err := a.add(resultChunk{id: "d", seq: 3, total: maxChunkParts, payload: "x"}, now); err == nil {
+		t.Error("tiny chunks accepted past the size limit")
+	}
+	maxChunkedResult = defaultMaxChunkedResult
+
+	a = newChunkAssembler()
+	for i := 0; i < maxPendingChunkedResults; i++ {
+		a.add(resultChunk{id: string(rune('a' + i)), seq: 0, total: 2, payload: "x"}, now)
+	}
+	if _, err := a.add(resultChunk{id: "z", seq: 0, total: 2, payload: "x"}, now); err == nil {
+		t.Error("chunk accepted beyond the pending limit")
+	}
+	// 超时的重组被清理后可以开始新的重组
+	if _, err := a.add(resultChunk{id: "z", seq: 0, total: 2, payload: "x"}, now.Add(chunkTimeout+time.Second)); err != nil {
+		t.Errorf("chunk after timeout: %v", err)
+	}
+	if len(a.pending) != 1 {
+		t.Errorf("%d pending after timeout, want 1", len(a.pending))
+	}
+}
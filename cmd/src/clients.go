@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// ClientInfo 是 /clients 接口中单个客户端的描述
+type ClientInfo struct {
+	ID     string `json:"id"`
+	ConnID string `json:"conn_id"`
+	// 握手时是否协商了压缩，便于排查未压缩客户端带来的带宽问题
+	Compression bool `json:"compression"`
+	// 升级请求中按名单记录的请求头
+	Headers map[string]string `json:"headers,omitempty"`
+	// 已写给该客户端的字节数，包括帧头
+	BytesSent int64 `json:"bytes_sent"`
+	// 实际写入连接的字节数，启用压缩时为压缩后的大小
+	WireBytes int64 `json:"wire_bytes"`
+	// WireBytes 与 BytesSent 之比，小于 1 说明压缩有效
+	CompressionRatio float64 `json:"compression_ratio"`
+	// 连接建立的时间，长轮询客户端为首次轮询的时间
+	ConnectedAt *time.Time `json:"connected_at,omitempty"`
+}
+
+// newConnID 生成 8 位十六进制的连接关联 ID，便于按连接 grep 日志
+func newConnID() string {
+	return randomHex(4)
+}
+
+// randomHex 生成 n 字节随机数的十六进制表示
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		errorf("Generate random id error: %v", err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// query 将 fn 交给 run() 执行并等待其完成，用于无竞争地读取 clients。
+// Hub 已停止时 fn 不会被执行
+func (h *Hub) query(fn func()) {
+	done := make(chan struct{})
+	select {
+	case h.queries <- func() {
+		fn()
+		close(done)
+	}:
+	case <-h.done:
+		return
+	}
+	<-done
+}
+
+// listClients 返回当前所有客户端的快照，按 id 排序，分片时汇总各分片
+func (h *Hub) listClients() []ClientInfo {
+	infos := []ClientInfo{}
+	for _, member := range h.members() {
+		member.query(func() {
+			for client := range member.clients {
+				info := ClientInfo{
+					ID:          client.id,
+					ConnID:      client.connID,
+					Compression: client.compression,
+					Headers:     client.headers,
+					BytesSent:   client.bytesSent.Load(),
+				}
+				if client.wireBytes != nil {
+					info.WireBytes = client.wireBytes.Load()
+					info.CompressionRatio = compressionRatio(info.WireBytes, info.BytesSent)
+				}
+				if !client.connectedAt.IsZero() {
+					connectedAt := client.connectedAt
+					info.ConnectedAt = &connectedAt
+				}
+				infos = append(infos, info)
+			}
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// ClientBufferInfo 描述单个客户端 send 缓冲的占用情况
+type ClientBufferInfo struct {
+	ID       string `json:"id"`
+	ConnID   string `json:"conn_id"`
+	Buffered int    `json:"buffered"`
+	Capacity int    `json:"capacity"`
+	// 未能送达该客户端的消息数
+	Dropped int64 `json:"dropped"`
+}
+
+// listClientBuffers 返回所有客户端的 send 缓冲占用，按占用量降序排列，便于找出最慢的消费者
+func (h *Hub) listClientBuffers() []ClientBufferInfo {
+	infos := []ClientBufferInfo{}
+	for _, member := range h.members() {
+		member.query(func() {
+			for client := range member.clients {
+				infos = append(infos, ClientBufferInfo{
+					ID:       client.id,
+					ConnID:   client.connID,
+					Buffered: len(client.send) + len(client.sendHigh),
+					Capacity: cap(client.send) + cap(client.sendHigh),
+					Dropped:  client.dropped.Load(),
+				})
+			}
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Buffered != infos[j].Buffered {
+			return infos[i].Buffered > infos[j].Buffered
+		}
+		return infos[i].ID < infos[j].ID
+	})
+	return infos
+}
+
+// findClient 在 id 所在的分片中查找在线的客户端，不在线时返回 nil
+func (h *Hub) findClient(id string) *Client {
+	shard := h.shardFor(id)
+	var found *Client
+	shard.query(func() {
+		for client := range shard.clients {
+			if client.id == id {
+				found = client
+				return
+			}
+		}
+	})
+	return found
+}
+
+// hasClient 判断指定 id 的客户端当前是否在线
+func (h *Hub) hasClient(id string) bool {
+	return h.findClient(id) != nil
+}
+
+func clientsHandler(w http.ResponseWriter, r *http.Request) {
+	ip, port, err := splitRemoteAddr(r.RemoteAddr)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Cannot resolve client address")
+		return
+	}
+	logRequest(r, ip, port)
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(hub.listClients()); err != nil {
+		errorf("JSON encoding error: %v", err)
+	}
+}
+
+func wsStatsHandler(w http.ResponseWriter, r *http.Request) {
+	ip, port, err := splitRemoteAddr(r.RemoteAddr)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Cannot resolve client address")
+		return
+	}
+	logRequest(r, ip, port)
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(hub.listClientBuffers()); err != nil {
+		errorf("JSON encoding error: %v", err)
+	}
+}
+
+func clientExistsHandler(w http.ResponseWriter, r *http.Request) {
+	ip, port, err := splitRemoteAddr(r.RemoteAddr)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Cannot resolve client address")
+		return
+	}
+	logRequest(r, ip, port)
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeError(w, http.StatusBadRequest, "Missing id parameter")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(map[string]bool{"connected": hub.hasClient(id)}); err != nil {
+		errorf("JSON encoding error: %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestConnIDLogged 同一连接的注册、注销日志带有相同的关联 ID，与欢迎消息和 /clients 中的 conn_id 一致
+func TestConnIDLogged(t *testing.T) {
+	srv := startTestServer(t)
+	logs := captureLogs(t, "info")
+	client := dialTestClient(t, srv, "")
+	welcome := client.RecvProtocol(protocolWelcome)
+	connID, _ := welcome.Data["conn_id"].(string)
+	if len(connID) != 8 {
+		t.Fatalf("welcome conn_id %q, want 8 hex digits", connID)
+	}
+
+	var infos []ClientInfo
+	getJSON(t, srv, "/clients", &infos)
+	if len(infos) != 1 || infos[0].ConnID != connID {
+		t.Errorf("/clients = %+v, want conn_id %s", infos, connID)
+	}
+
+	client.conn.Close()
+	waitClients(t, 0)
+	attr := "conn=" + connID
+	waitFor(t, func() bool { return logLine(logs, "Client unregistered", attr) != "" })
+	if logLine(logs, "Client registered", attr) == "" {
+		t.Errorf("no register line with %s in logs:\n%s", attr, logs)
+	}
+}
+
+// TestWSStats /ws-stats 按发送缓冲占用降序列出客户端，缓冲被填满的客户端排在最前
+func TestWSStats(t *testing.T) {
+	srv := startTestServer(t)
+	dialTestClient(t, srv, "client_id=live")
+	waitClients(t, 1)
+	slow := &Client{hub: hub, id: "slow", send: make(chan outMessage, 8), sendHigh: make(chan outMessage, 1), closing: make(chan struct{})}
+	for _, client := range []*Client{fakeClient("a"), slow, fakeClient("b")} {
+		if !hub.join(client) {
+			t.Fatalf("join %s failed", client.id)
+		}
+	}
+	// 欢迎消息和续传令牌之外再填满 slow 的普通缓冲，模拟不读取的客户端
+	for len(slow.send) < cap(slow.send) {
+		slow.send <- outMessage{data: []byte(`{}`)}
+	}
+
+	var infos []ClientBufferInfo
+	getJSON(t, srv, "/ws-stats", &infos)
+	var order []string
+	for _, info := range infos {
+		order = append(order, info.ID)
+	}
+	if strings.Join(order, ",") != "slow,a,b,live" {
+		t.Fatalf("/ws-stats order %v, want [slow a b live]", order)
+	}
+	if infos[0].Buffered != 8 || infos[0].Capacity != 9 || infos[1].Buffered != 2 {
+		t.Errorf("/ws-stats = %+v, want slow 8/9 and a 2", infos)
+	}
+}
+
+// TestClientExists /clients/exists 对在线和不在线的 id 分别返回 true 和 false，缺少 id 返回 400
+func TestClientExists(t *testing.T) {
+	srv := startTestServer(t)
+	client := dialTestClient(t, srv, "client_id=reviewer-1")
+	waitClients(t, 1)
+
+	for id, want := range map[string]bool{"reviewer-1": true, "reviewer-2": false} {
+		var result map[string]bool
+		if status := getJSON(t, srv, "/clients/exists?id="+id, &result); status != http.StatusOK || result["connected"] != want {
+			t.Errorf("exists %s = %d %v, want 200 connected=%t", id, status, result, want)
+		}
+	}
+	client.conn.Close()
+	waitClients(t, 0)
+	var result map[string]bool
+	if getJSON(t, srv, "/clients/exists?id=reviewer-1", &result); result["connected"] {
+		t.Error("disconnected client still reported as connected")
+	}
+
+	resp, err := http.Get(srv.URL + "/clients/exists")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("missing id = %d, want 400", resp.StatusCode)
+	}
+}
+
+// TestBytesSent /clients 的 bytes_sent 等于该客户端收到的各帧负载与帧头长度之和，/stats 的总数随之增加
+func TestBytesSent(t *testing.T) {
+	srv := startTestServer(t)
+	var before StatsSnapshot
+	getJSON(t, srv, "/stats", &before)
+	client := dialTestClient(t, srv, "client_id=bytes")
+	waitClients(t, 1)
+
+	for _, size := range []int{10, 1000, 70000} {
+		message := fmt.Sprintf(`{"protocol_id":1,"data":{"msg":%q}}`, strings.Repeat("b", size))
+		if _, err := hub.submit([]byte(message), priorityNormal); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+	// 服务端帧不带掩码，帧头为 2 字节，负载超过 125 字节时加 2 字节，超过 65535 字节时加 8 字节
+	var want int64
+	for received := 0; received < 3; {
+		client.conn.SetReadDeadline(time.Now().Add(testRecvTimeout))
+		_, frame, err := client.conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("recv: %v", err)
+		}
+		want += int64(len(frame)) + 2
+		if len(frame) > 0xFFFF {
+			want += 8
+		} else if len(frame) > 125 {
+			want += 2
+		}
+		received += strings.Count(string(frame), `"protocol_id":1,`)
+	}
+
+	waitFor(t, func() bool {
+		var infos []ClientInfo
+		getJSON(t, srv, "/clients", &infos)
+		return len(infos) == 1 && infos[0].BytesSent == want
+	})
+	var after StatsSnapshot
+	getJSON(t, srv, "/stats", &after)
+	if after.BytesSent-before.BytesSent < want {
+		t.Errorf("bytes_sent in /stats +%d, want at least %d", after.BytesSent-before.BytesSent, want)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// closeFrom 以 code 发送关闭帧后断开连接，等待服务端注销该客户端
+func closeFrom(t *testing.T, client *testClient, code int) {
+	t.Helper()
+	msg := websocket.FormatCloseMessage(code, "bye")
+	if err := client.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(testRecvTimeout)); err != nil {
+		t.Fatalf("write close: %v", err)
+	}
+	client.conn.Close()
+	waitClients(t, 0)
+}
+
+// TestNormalClose 客户端正常关闭记为 debug 日志和 normal_closes，意外的关闭码记为错误和 unexpected_closes
+func TestNormalClose(t *testing.T) {
+	srv := startTestServer(t)
+	logs := captureLogs(t, "debug")
+
+	for _, code := range []int{websocket.CloseNormalClosure, websocket.CloseGoingAway} {
+		normal, unexpected := stats.normalCloses.Load(), stats.unexpectedCloses.Load()
+		client := dialTestClient(t, srv, "")
+		connID, _ := client.RecvProtocol(protocolWelcome).Data["conn_id"].(string)
+		closeFrom(t, client, code)
+		if line := logLine(logs, "Client closed normally", "conn="+connID); line == "" || !strings.Contains(line, "level=DEBUG") {
+			t.Errorf("close %d: no debug normal-close line for conn %s in logs:\n%s", code, connID, logs)
+		}
+		if n := stats.normalCloses.Load(); n != normal+1 || stats.unexpectedCloses.Load() != unexpected {
+			t.Errorf("close %d: normal_closes +%d, unexpected_closes +%d; want +1 and +0", code, n-normal, stats.unexpectedCloses.Load()-unexpected)
+		}
+	}
+
+	normal, unexpected := stats.normalCloses.Load(), stats.unexpectedCloses.Load()
+	client := dialTestClient(t, srv, "")
+	connID, _ := client.RecvProtocol(protocolWelcome).Data["conn_id"].(string)
+	closeFrom(t, client, websocket.CloseInternalServerErr)
+	if line := logLine(logs, "Unexpected close error", "conn="+connID); !strings.Contains(line, "level=ERROR") {
+		t.Errorf("no error line for conn %s in logs:\n%s", connID, logs)
+	}
+	if stats.normalCloses.Load() != normal || stats.unexpectedCloses.Load() != unexpected+1 {
+		t.Errorf("close 1011: normal_closes +%d, unexpected_closes +%d; want +0 and +1", stats.normalCloses.Load()-normal, stats.unexpectedCloses.Load()-unexpected)
+	}
+}
+
+// TestCloseCodeStats /stats 的 close_codes 按关闭码统计断开次数，没有关闭帧的断开计为 1006
+func TestCloseCodeStats(t *testing.T) {
+	srv := startTestServer(t)
+	var before StatsSnapshot
+	getJSON(t, srv, "/stats", &before)
+
+	codes := []int{websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseGoingAway, websocket.ClosePolicyViolation}
+	for _, code := range codes {
+		client := dialTestClient(t, srv, "")
+		waitClients(t, 1)
+		closeFrom(t, client, code)
+	}
+	// 直接断开 TCP 连接，不发送关闭帧
+	client := dialTestClient(t, srv, "")
+	waitClients(t, 1)
+	client.conn.Close()
+	waitClients(t, 0)
+
+	var after StatsSnapshot
+	getJSON(t, srv, "/stats", &after)
+	want := map[string]int64{"1000": 1, "1001": 2, "1008": 1, "1006": 1}
+	for code, n := range want {
+		if got := after.CloseCodes[code] - before.CloseCodes[code]; got != n {
+			t.Errorf("close_codes[%s] +%d, want +%d", code, got, n)
+		}
+	}
+
+	// /metrics 以 Prometheus 文本格式输出相同的计数
+	resp, err := http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("get metrics: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Fatalf("metrics: status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	for code := range want {
+		line := fmt.Sprintf("wsserver_close_codes_total{code=%q} %d\n", code, after.CloseCodes[code])
+		if !strings.Contains(string(body), line) {
+			t.Errorf("metrics missing %q:\n%s", line, body)
+		}
+	}
+}
+
+// TestInvalidUTF8 文本帧不是合法的 UTF-8 时服务端以 1007 关闭连接
+func TestInvalidUTF8(t *testing.T) {
+	srv := startTestServer(t)
+	client := dialTestClient(t, srv, "")
+	waitClients(t, 1)
+
+	if err := client.conn.WriteMessage(websocket.TextMessage, []byte("{\"protocol_id\":1,\"data\":{\"msg\":\"\xff\xfe\"}}")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	for {
+		client.conn.SetReadDeadline(time.Now().Add(testRecvTimeout))
+		_, _, err := client.conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, websocket.CloseInvalidFramePayloadData) {
+			t.Fatalf("read error %v, want close 1007", err)
+		}
+		break
+	}
+	waitClients(t, 0)
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// compressionNegotiated 判断本次握手是否协商了 permessage-deflate。
+// 与 gorilla/websocket 的判断一致：服务端启用压缩且客户端在 Sec-WebSocket-Extensions 中提出了该扩展
+func compressionNegotiated(r *http.Request) bool {
+	if !upgrader.EnableCompression {
+		return false
+	}
+	for _, header := range r.Header.Values("Sec-WebSocket-Extensions") {
+		for _, ext := range strings.Split(header, ",") {
+			name, _, _ := strings.Cut(ext, ";")
+			if strings.EqualFold(strings.TrimSpace(name), "permessage-deflate") {
+				return true
+			}
+		}
+	}
+	return false
+}
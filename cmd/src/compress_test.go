@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestCompressionRecorded 每个客户端是否协商了压缩记录在欢迎消息、注册日志和 /clients 中
+func TestCompressionRecorded(t *testing.T) {
+	upgrader.EnableCompression = true
+	t.Cleanup(func() { upgrader.EnableCompression = false })
+	srv := startTestServer(t)
+	logs := captureLogs(t, "info")
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws?client_id="
+	for id, compression := range map[string]bool{"deflate": true, "plain": false} {
+		dialer := websocket.Dialer{EnableCompression: compression}
+		conn, _, err := dialer.Dial(url+id, nil)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		welcome := (&testClient{t: t, conn: conn}).RecvProtocol(protocolWelcome)
+		if welcome.Data["compression"] != compression {
+			t.Errorf("%s: welcome compression %v, want %t", id, welcome.Data["compression"], compression)
+		}
+		if logLine(logs, fmt.Sprintf("Client registered: %s, compression: %t", id, compression)) == "" {
+			t.Errorf("%s: register line without compression %t:\n%s", id, compression, logs)
+		}
+	}
+
+	var infos []ClientInfo
+	getJSON(t, srv, "/clients", &infos)
+	got := make(map[string]bool)
+	for _, info := range infos {
+		got[info.ID] = info.Compression
+	}
+	if len(got) != 2 || !got["deflate"] || got["plain"] {
+		t.Errorf("/clients compression %v, want deflate true and plain false", got)
+	}
+}
+
+// TestCompressionRatio 高度可压缩的广播使压缩连接的 compression_ratio 明显小于 1，未压缩的连接约为 1，/stats 的总体比值小于 1
+func TestCompressionRatio(t *testing.T) {
+	upgrader.EnableCompression = true
+	t.Cleanup(func() { upgrader.EnableCompression = false })
+	srv := startTestServer(t)
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws?client_id="
+	clients := make(map[string]*testClient)
+	for id, compression := range map[string]bool{"deflate": true, "plain": false} {
+		dialer := websocket.Dialer{EnableCompression: compression}
+		conn, _, err := dialer.Dial(url+id, nil)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		clients[id] = &testClient{t: t, conn: conn}
+	}
+	waitClients(t, 2)
+
+	msg := strings.Repeat("aaaaaaaa", 2048)
+	for i := 0; i < 5; i++ {
+		if _, err := hub.submit([]byte(`{"protocol_id":1,"data":{"msg":"`+msg+`"}}`), priorityNormal); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+	for _, client := range clients {
+		for i := 0; i < 5; i++ {
+			client.RecvProtocol(1)
+		}
+	}
+
+	ratios := make(map[string]float64)
+	waitFor(t, func() bool {
+		var infos []ClientInfo
+		getJSON(t, srv, "/clients", &infos)
+		for _, info := range infos {
+			ratios[info.ID] = info.CompressionRatio
+		}
+		return ratios["deflate"] > 0 && ratios["deflate"] < 0.1 && ratios["plain"] >= 1
+	})
+	var snap StatsSnapshot
+	getJSON(t, srv, "/stats", &snap)
+	if snap.CompressionRatio <= 0 || snap.CompressionRatio >= 1 {
+		t.Errorf("/stats compression_ratio %v, want between 0 and 1", snap.CompressionRatio)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// 命令行中显式给出的参数，读取配置文件前记录，重新加载时这些参数保持不变
+var cmdlineFlags = make(map[string]bool)
+
+// applyConfigFile 从 JSON 配置文件读取参数，键为命令行参数名（不含 "-"），如：
+//
+//	{"addr": ":8194", "log-level": "debug", "resume-ttl": "5m", "max-coalesce": 16}
+//
+// 命令行中显式给出的参数优先于配置文件。未知的键或无法解析的值会返回错误
+func applyConfigFile(path string) error {
+	values, err := readConfigFile(path)
+	if err != nil {
+		return err
+	}
+	flag.Visit(func(f *flag.Flag) { cmdlineFlags[f.Name] = true })
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if cmdlineFlags[name] {
+			continue
+		}
+		if err := flag.Set(name, values[name]); err != nil {
+			return fmt.Errorf("%s: invalid value %q for %q: %v", path, values[name], name, err)
+		}
+	}
+	return nil
+}
+
+// readConfigFile 读取 JSON 配置文件，返回参数名到字符串形式取值的映射，未知的键或不支持的取值类型返回错误
+func readConfigFile(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.UseNumber()
+	var raw map[string]interface{}
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	names := make([]string, 0, len(raw))
+	for name := range raw {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	values := make(map[string]string, len(raw))
+	for _, name := range names {
+		if name == "config" || flag.Lookup(name) == nil {
+			return nil, fmt.Errorf("%s: unknown setting %q", path, name)
+		}
+		switch v := raw[name].(type) {
+		case string:
+			values[name] = v
+		case json.Number:
+			values[name] = v.String()
+		case bool:
+			values[name] = fmt.Sprint(v)
+		default:
+			return nil, fmt.Errorf("%s: setting %q must be a string, number or boolean", path, name)
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 已注册的测试参数组数，每次运行使用新的参数名，避免上一次运行设置过的参数被视为命令行参数
+var configTestRuns int
+
+// registerConfigFlags 在全局 FlagSet 上注册一组测试参数，返回参数名前缀
+func registerConfigFlags() string {
+	configTestRuns++
+	prefix := fmt.Sprintf("cfgtest%d-", configTestRuns)
+	flag.String(prefix+"addr", ":8194", "")
+	flag.Int(prefix+"size", 256, "")
+	flag.Bool(prefix+"debug", false, "")
+	flag.Duration(prefix+"wait", time.Second, "")
+	flag.String(prefix+"override", "default", "")
+	return prefix
+}
+
+// writeConfig 将 content 写入临时配置文件，返回其路径
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestConfigFile 配置文件中的字符串、数字、布尔值和时长都能写入对应参数，命令行给出的参数优先
+func TestConfigFile(t *testing.T) {
+	p := registerConfigFlags()
+	// 模拟命令行中显式给出的参数
+	if err := flag.Set(p+"override", "cmdline"); err != nil {
+		t.Fatal(err)
+	}
+	path := writeConfig(t, fmt.Sprintf(`{"%[1]saddr": ":9000", "%[1]ssize": 16, "%[1]sdebug": true, "%[1]swait": "5m", "%[1]soverride": "file"}`, p))
+	if err := applyConfigFile(path); err != nil {
+		t.Fatalf("apply config: %v", err)
+	}
+	for name, want := range map[string]string{"addr": ":9000", "size": "16", "debug": "true", "wait": "5m0s", "override": "cmdline"} {
+		if got := flag.Lookup(p + name).Value.String(); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+// TestConfigFileInvalid 未知的键、无法解析的值和不支持的类型都会返回指明文件和键的错误
+func TestConfigFileInvalid(t *testing.T) {
+	p := registerConfigFlags()
+	for content, want := range map[string]string{
+		`{"no-such-flag": 1}`:             `unknown setting "no-such-flag"`,
+		`{"config": "other.json"}`:        `unknown setting "config"`,
+		`{"` + p + `size": "big"}`:        `invalid value "big" for "` + p + `size"`,
+		`{"` + p + `wait": 30}`:           `invalid value "30" for "` + p + `wait"`,
+		`{"` + p + `addr": [":1", ":2"]}`: `setting "` + p + `addr" must be a string, number or boolean`,
+		`{"` + p + `addr": ":1",`:         "unexpected EOF",
+	} {
+		path := writeConfig(t, content)
+		err := applyConfigFile(path)
+		if err == nil || !strings.HasPrefix(err.Error(), path+": ") || !strings.Contains(err.Error(), want) {
+			t.Errorf("config %s: error %v, want %q prefixed with the path", content, err, want)
+		}
+	}
+	if err := applyConfigFile(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("missing config file accepted")
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// 同一 id 重复注册时的处理方式
+const (
+	// 关闭旧连接，由新连接接管
+	duplicateTakeover = "takeover"
+	// 保留旧连接，拒绝新连接
+	duplicateReject = "reject"
+)
+
+// 当前的重复 id 处理方式，可通过 -duplicate-id 配置
+var duplicatePolicy = duplicateTakeover
+
+// 客户端自报 id 允许的字符和长度
+var clientIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+// parseDuplicatePolicy 校验 -duplicate-id 参数
+func parseDuplicatePolicy(policy string) (string, error) {
+	switch policy {
+	case duplicateTakeover, duplicateReject:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid duplicate id policy %q, expected %s or %s", policy, duplicateTakeover, duplicateReject)
+}
+
+// addClient 将新客户端加入 Hub，只能在 run() 中调用。
+// 已有同 id 的客户端时按 duplicatePolicy 接管或拒绝，返回新客户端是否被接受
+func (h *Hub) addClient(client *Client) bool {
+	for existing := range h.clients {
+		if existing.id != client.id {
+			continue
+		}
+		if duplicatePolicy == duplicateReject {
+			client.warnf("Client rejected, id %s already connected", client.id)
+			client.closeSend()
+			return false
+		}
+		existing.infof("Client taken over by conn %s: %s", client.connID, existing.id)
+		// 与其他移除一样经 closeSend 通知旧连接的 writePump 在 drainTimeout 内排空已排队的消息后发送关闭帧；
+		// 此后旧的 readPump 只处理结果等 acceptedAfterRemoval 允许的消息
+		h.removeClient(existing)
+		break
+	}
+	h.clients[client] = true
+	h.order = append(h.order, client)
+	stats.totalConnections.Add(1)
+	stats.currentConnections.Add(1)
+	client.infof("Client registered: %s, compression: %t", client.id, client.compression)
+	h.publish(Event{Kind: EventConnect, ClientID: client.id, ConnID: client.connID})
+	if len(client.headers) > 0 {
+		client.infof("Client %s headers: %v", client.id, client.headers)
+	}
+	h.sendWelcome(client)
+	// 计入客户端数、记下注册时的序号和绑定会话在同一次加锁中完成，与协调者记录广播互斥
+	state := h.root()
+	state.mu.Lock()
+	state.registered++
+	client.joinedSeq = state.seq
+	h.attachSession(client)
+	state.mu.Unlock()
+	return true
+}
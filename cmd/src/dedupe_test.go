@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestTakeover 同一 id 重连时新连接接管，Hub 中只保留一个客户端；旧连接先收到已排队的广播，再收到关闭帧
+func TestTakeover(t *testing.T) {
+	srv := startTestServer(t)
+	old := dialTestClient(t, srv, "client_id=reviewer-1")
+	waitClients(t, 1)
+	first := hubClient(t)
+	id := postTask(t, srv, "m1")
+
+	current := dialTestClient(t, srv, "client_id=reviewer-1")
+	waitFor(t, func() bool { return hubClient(t) != first })
+	waitClients(t, 1)
+
+	var task InspectorResult
+	if err := old.RecvProtocol(1).decodeData(&task); err != nil || task.TaskID != id {
+		t.Fatalf("old connection received %+v (%v), want task %s", task, err, id)
+	}
+	old.conn.SetReadDeadline(time.Now().Add(testRecvTimeout))
+	for {
+		_, _, err := old.conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if closeErr, ok := err.(*websocket.CloseError); !ok || closeErr.Code == websocket.CloseAbnormalClosure {
+			t.Fatalf("old connection read %v, want a close frame", err)
+		}
+		break
+	}
+	current.Send(1, map[string]any{"msg": "still here"})
+	if reply := current.RecvProtocol(2); reply.Data["msg"] != "still here"+echoSuffix {
+		t.Fatalf("unexpected echo %+v", reply)
+	}
+}
+
+// TestTakeoverWhileSending 旧连接持续发送需要回复的消息时被接管，不会 panic
+func TestTakeoverWhileSending(t *testing.T) {
+	srv := startTestServer(t)
+	old := dialTestClient(t, srv, "client_id=reviewer-1")
+	waitClients(t, 1)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if err := old.conn.WriteJSON(map[string]any{"protocol_id": 1, "data": map[string]any{"msg": "spam"}}); err != nil {
+				return
+			}
+		}
+	}()
+	time.Sleep(20 * time.Millisecond)
+	for i := 0; i < 5; i++ {
+		dialTestClient(t, srv, "client_id=reviewer-1")
+	}
+	waitClients(t, 1)
+	<-done
+}
+
+// TestDuplicateReject 配置为拒绝时同一 id 的第二个连接无法建立
+func TestDuplicateReject(t *testing.T) {
+	duplicatePolicy = duplicateReject
+	defer func() { duplicatePolicy = duplicateTakeover }()
+	srv := startTestServer(t)
+	dialTestClient(t, srv, "client_id=reviewer-1")
+	waitClients(t, 1)
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws?client_id=reviewer-1"
+	if _, resp, err := websocket.DefaultDialer.Dial(url, nil); err == nil || resp == nil || resp.StatusCode != http.StatusConflict {
+		t.Fatalf("second connection not rejected: %v", err)
+	}
+	waitClients(t, 1)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// 客户端被移除后继续写出已排队消息的默认时间
+const defaultDrainTimeout = 5 * time.Second
+
+// 客户端被移除或服务关闭时，writePump 在发送关闭帧前写出已排队消息的最长时间，
+// 0 表示直接丢弃已排队的消息，由 -drain-timeout 配置
+var drainTimeout = defaultDrainTimeout
+
+// closeSend 关闭客户端的 send 通道并通知 writePump 开始排空，只能在 run() 中调用，重复调用无影响。
+// run() 之外的发送方须经 reply 放入，不能直接向 send 发送
+func (c *Client) closeSend() {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	close(c.closing)
+	close(c.send)
+}
+
+// reply 将 readPump 产生的回复放入客户端的发送缓冲。send 通道只在 run() 中关闭，readPump 直接发送
+// 可能恰好与接管、超时或迁移等移除操作并发而 panic，因此交给 run() 在确认客户端未被移除后放入。
+// 客户端已被移除、Hub 已停止或缓冲已满时丢弃回复并返回 false，不阻塞 readPump
+func (c *Client) reply(out outMessage) bool {
+	sent := false
+	c.hub.query(func() {
+		if c.closed {
+			return
+		}
+		select {
+		case c.send <- out:
+			sent = true
+		default:
+		}
+	})
+	return sent
+}
+
+// removed 判断客户端是否已被 Hub 移除，移除后 writePump 正在排空或即将关闭连接
+func (c *Client) removed() bool {
+	select {
+	case <-c.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+// acceptedAfterRemoval 判断客户端被移除、连接尚未关闭期间是否仍处理该协议的消息。
+// 只接受结果、分片、确认和进度，避免正在处理的任务丢失；订阅、转发、回显等会改变 Hub 状态或需要回复的消息一律忽略
+func acceptedAfterRemoval(protocolID int64) bool {
+	switch protocolID {
+	case 2, protocolResultChunk, protocolAck, protocolProgress:
+		return true
+	}
+	return false
+}
+
+// drainExpired 判断 Hub 移除客户端后排空期限是否已过，首次发现被移除时开始计时
+func (c *Client) drainExpired(deadline *time.Time) bool {
+	if deadline.IsZero() {
+		select {
+		case <-c.closing:
+			*deadline = time.Now().Add(drainTimeout)
+		default:
+			return false
+		}
+	}
+	return !time.Now().Before(*deadline)
+}
+
+// finishDrain 在 send 已关闭或排空超时后写出剩余的高优先级消息（截止 deadline），
+// 未写出的消息计为丢弃，最后发送关闭帧
+func (c *Client) finishDrain(deadline time.Time) {
+	for len(c.sendHigh) > 0 && time.Now().Before(deadline) {
+		message := c.encode(<-c.sendHigh)
+		c.conn.SetWriteDeadline(deadline)
+		if err := c.writeStandalone(message); err != nil {
+			return
+		}
+	}
+	if dropped := len(c.sendHigh) + len(c.send); dropped > 0 {
+		for i := 0; i < dropped; i++ {
+			c.countDrop()
+		}
+		c.warnf("Dropped %d queued messages for %s when closing", dropped, c.id)
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	c.conn.WriteMessage(websocket.CloseMessage, c.closeMessage())
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// hubClient 返回 Hub 中唯一的客户端
+func hubClient(t testing.TB) *Client {
+	t.Helper()
+	var found *Client
+	hub.query(func() {
+		for client := range hub.clients {
+			found = client
+		}
+	})
+	if found == nil {
+		t.Fatal("no client registered")
+	}
+	return found
+}
+
+// TestDropThenUnregister 客户端因缓冲满被移除后再次注销，send 通道只关闭一次
+func TestDropThenUnregister(t *testing.T) {
+	startTestServer(t)
+	client := &Client{hub: hub, id: "slow", send: make(chan outMessage, 2), sendHigh: make(chan outMessage, 1), closing: make(chan struct{})}
+	if !hub.join(client) {
+		t.Fatal("join failed")
+	}
+	// 欢迎消息和续传令牌占满缓冲，下一条广播使其被移除
+	if delivered, _ := hub.submit([]byte(`{"protocol_id":1,"data":{}}`), priorityNormal); delivered != 0 {
+		t.Fatalf("delivered to %d clients, want 0", delivered)
+	}
+	waitClients(t, 0)
+	hub.leave(client)
+	hub.leave(client)
+	if !client.closed {
+		t.Fatal("send channel not closed")
+	}
+}
+
+// TestReplyAfterRemove readPump 在客户端被移除后继续回复也不会向已关闭的 send 通道发送
+func TestReplyAfterRemove(t *testing.T) {
+	srv := startTestServer(t)
+	conn := dialTestClient(t, srv, "client_id=spammer")
+	waitClients(t, 1)
+	client := hubClient(t)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err := conn.conn.WriteJSON(map[string]any{"protocol_id": 1, "data": map[string]any{"msg": "spam"}}); err != nil {
+				return
+			}
+		}
+	}()
+	time.Sleep(20 * time.Millisecond)
+	hub.query(func() { hub.removeClient(client) })
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+	<-done
+}
+
+// TestDrainBeforeClose 移除客户端前已排队的消息在关闭帧之前全部写出，期间客户端持续发送也不会 panic
+func TestDrainBeforeClose(t *testing.T) {
+	srv := startTestServer(t)
+	conn := dialTestClient(t, srv, "")
+	waitClients(t, 1)
+	client := hubClient(t)
+	conn.RecvProtocol(protocolSession)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if err := conn.conn.WriteJSON(map[string]any{"protocol_id": protocolRelay, "data": map[string]any{}}); err != nil {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	const queued = 5
+	hub.query(func() {
+		for i := 0; i < queued; i++ {
+			client.send <- outMessage{data: []byte(fmt.Sprintf(`{"protocol_id":1,"data":{"n":%d}}`, i))}
+		}
+		hub.removeClient(client)
+	})
+	for i := 0; i < queued; i++ {
+		env := conn.RecvProtocol(1)
+		if n := fmt.Sprint(env.Data["n"]); n != fmt.Sprint(i) {
+			t.Fatalf("message %d has n=%s", i, n)
+		}
+	}
+	_, _, err := conn.conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) {
+		t.Fatalf("expected close frame after queued messages, got %v", err)
+	}
+	<-done
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Envelope 是解析后的客户端消息
+type Envelope struct {
+	ProtocolID int64
+	// 协议版本，未携带时为 defaultEnvelopeVersion
+	Version int64
+	// 所有协议的 data 都必须是 JSON 对象
+	Data map[string]interface{}
+	// data 的原始 JSON，可通过 decodeData 解码为协议对应的类型化结构
+	RawData json.RawMessage
+	// 客户端附带的请求 id，为字符串或 json.Number，未携带时为 nil。
+	// 服务端对该消息的回复原样带回，便于客户端在同一连接上匹配请求与响应
+	ID interface{}
+	// 消息已被转发的次数，未携带时为 0。服务端回显或转发时加一，超过 maxHops 的消息不再处理
+	Hops int64
+}
+
+// data 为 null 时返回的错误
+var errNullData = errors.New("data must not be null")
+
+// parseEnvelope 解析客户端发来的消息，要求格式如下：
+//
+//	{
+//	   "protocol_id": number,  // 也可写作 protocolId
+//	   "version": number,  // 可选，默认为 1
+//	   "id": string | number,  // 可选，回复中原样带回
+//	   "hops": number,  // 可选，已被转发的次数
+//	   "data": { ... }
+//	}
+//
+// null、字符串、数组等非对象的 data 一律拒绝。任意输入都只返回合法的信封或错误，不会 panic；
+// 出错时返回的信封中已解析出的字段（如 ProtocolID、ID）仍可用于错误回复
+func parseEnvelope(message []byte) (Envelope, error) {
+	var env Envelope
+	msgData, err := decodeMessage(message)
+	if err != nil {
+		return env, fmt.Errorf("invalid JSON: %v", err)
+	}
+	// 顶层为 null 时 msgData 为 nil
+	if msgData == nil {
+		return env, fmt.Errorf("message must be a JSON object")
+	}
+	// 最先读取 id，之后的校验失败时错误回复也能带回 id
+	if id, ok := msgData["id"]; ok {
+		switch id.(type) {
+		case string, json.Number:
+			env.ID = id
+		default:
+			return env, fmt.Errorf("id must be a string or number, got %T", id)
+		}
+	}
+	if strictEnvelope {
+		if err := checkEnvelopeFields(message); err != nil {
+			return env, fmt.Errorf("strict mode: %v", err)
+		}
+	}
+
+	// 接受 protocol_id 和 protocolId 两种写法，但不能同时出现
+	protocol, ok := msgData[protocolIDSnake]
+	if camel, hasCamel := msgData[protocolIDCamel]; hasCamel {
+		if ok {
+			return env, fmt.Errorf("both protocol_id and protocolId present")
+		}
+		protocol, ok = camel, true
+	}
+	if !ok {
+		return env, fmt.Errorf("missing protocol_id")
+	}
+	// protocol_id 以 json.Number 形式解码，必须为整数
+	if env.ProtocolID, err = parseProtocolID(protocol); err != nil {
+		return env, fmt.Errorf("invalid protocol_id: %v", err)
+	}
+	// version 缺省为 1，各协议按版本解码 data，不支持的版本直接拒绝
+	if env.Version, err = parseEnvelopeVersion(msgData, env.ProtocolID); err != nil {
+		return env, err
+	}
+
+	if raw, ok := msgData["hops"]; ok {
+		num, ok := raw.(json.Number)
+		if !ok {
+			return env, fmt.Errorf("hops must be a number, got %T", raw)
+		}
+		if env.Hops, err = num.Int64(); err != nil || env.Hops < 0 {
+			return env, fmt.Errorf("hops %s must be a non-negative integer", num)
+		}
+	}
+
+	dataField, ok := msgData["data"]
+	if !ok {
+		return env, fmt.Errorf("missing data field")
+	}
+	if dataField == nil {
+		return env, errNullData
+	}
+	if env.Data, ok = dataField.(map[string]interface{}); !ok {
+		return env, fmt.Errorf("invalid data field: expected JSON object, got %T", dataField)
+	}
+	var raw struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(message, &raw); err != nil {
+		return env, fmt.Errorf("invalid JSON: %v", err)
+	}
+	env.RawData = raw.Data
+	return env, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestParseEnvelope 覆盖合法信封和已知的拒绝情形
+func TestParseEnvelope(t *testing.T) {
+	env, err := parseEnvelope([]byte(`{"protocol_id":2,"id":"r1","hops":1,"data":{"task_id":"t"}}`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if env.ProtocolID != 2 || env.ID != "r1" || env.Hops != 1 || env.Data["task_id"] != "t" || string(env.RawData) != `{"task_id":"t"}` {
+		t.Fatalf("unexpected envelope %+v", env)
+	}
+	if env, err := parseEnvelope([]byte(`{"protocolId":1,"data":{}}`)); err != nil || env.ProtocolID != 1 {
+		t.Fatalf("camel case protocolId: %+v, %v", env, err)
+	}
+
+	for _, message := range []string{
+		``,
+		`null`,
+		`[]`,
+		`{"data":{}}`,
+		`{"protocol_id":"1","data":{}}`,
+		`{"protocol_id":1.5,"data":{}}`,
+		`{"protocol_id":1e400,"data":{}}`,
+		`{"protocol_id":1,"protocolId":1,"data":{}}`,
+		`{"protocol_id":1}`,
+		`{"protocol_id":1,"data":[]}`,
+		`{"protocol_id":1,"data":"x"}`,
+		`{"protocol_id":1,"id":{},"data":{}}`,
+		`{"protocol_id":1,"hops":-1,"data":{}}`,
+	} {
+		if _, err := parseEnvelope([]byte(message)); err == nil {
+			t.Errorf("parseEnvelope(%q) accepted", message)
+		}
+	}
+	if env, err := parseEnvelope([]byte(`{"protocol_id":1,"id":7,"data":null}`)); !errors.Is(err, errNullData) || env.ProtocolID != 1 || env.ID == nil {
+		t.Fatalf("null data: %+v, %v; want errNullData with protocol_id and id", env, err)
+	}
+}
+
+// FuzzParseEnvelope 任意输入都不会 panic，且只返回带有 JSON 对象 data 的信封或错误
+func FuzzParseEnvelope(f *testing.F) {
+	for _, seed := range []string{
+		`{"protocol_id":1,"data":{"msg":"hi"}}`,
+		`{"protocolId":2,"version":1,"id":"a","hops":3,"data":{"task_id":"x"}}`,
+		`{"protocol_id":3,"data":{"models":["a","b"]}}`,
+		`{"protocol_id":1e2,"data":{}}`,
+		`{"protocol_id":1,"data":null}`,
+		`{"protocol_id":9,"data":{"ack_ids":[1,2]}}`,
+		`[]`,
+		`"x"`,
+		``,
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, message []byte) {
+		env, err := parseEnvelope(message)
+		if err != nil {
+			return
+		}
+		if env.Data == nil || len(env.RawData) == 0 {
+			t.Fatalf("accepted %q without a data object: %+v", message, env)
+		}
+		if env.Hops < 0 {
+			t.Fatalf("accepted %q with negative hops %d", message, env.Hops)
+		}
+	})
+}
+
+// TestEnvelopeVersion 未携带 version 时为默认版本 1；显式的版本只在不超过该协议登记的最高版本时接受
+func TestEnvelopeVersion(t *testing.T) {
+	for message, want := range map[string]int64{
+		`{"protocol_id":1,"data":{}}`:             1,
+		`{"protocol_id":1,"version":1,"data":{}}`: 1,
+		// 进度消息登记了版本 2
+		`{"protocol_id":5,"version":2,"data":{"task_id":"0123456789abcdef","done":1,"total":2}}`: 2,
+	} {
+		if env, err := parseEnvelope([]byte(message)); err != nil || env.Version != want {
+			t.Errorf("parseEnvelope(%s) = version %d, %v; want %d", message, env.Version, err, want)
+		}
+	}
+	for _, message := range []string{
+		`{"protocol_id":1,"version":0,"data":{}}`,
+		`{"protocol_id":1,"version":"2","data":{}}`,
+		`{"protocol_id":1,"version":1.5,"data":{}}`,
+		`{"protocol_id":1,"version":2,"data":{}}`,
+		`{"protocol_id":5,"version":3,"data":{}}`,
+		`{"protocol_id":42,"version":2,"data":{}}`,
+	} {
+		if _, err := parseEnvelope([]byte(message)); err == nil {
+			t.Errorf("parseEnvelope(%s) accepted", message)
+		}
+	}
+}
+
+// TestStrictEnvelope 默认忽略未知的顶层字段；-strict-envelope 下带有未知字段的消息被拒绝，已知字段照常接受
+func TestStrictEnvelope(t *testing.T) {
+	extra := []byte(`{"protocol_id":1,"data":{"msg":"x"},"debug":true}`)
+	known := []byte(`{"protocol_id":2,"version":1,"id":"r1","hops":0,"data":{},"timestamp":1,"traceparent":"t","signature":"s"}`)
+	if _, err := parseEnvelope(extra); err != nil {
+		t.Fatalf("lenient mode rejected an unknown field: %v", err)
+	}
+
+	t.Cleanup(func() { strictEnvelope = false })
+	strictEnvelope = true
+	if _, err := parseEnvelope(extra); err == nil || !strings.Contains(err.Error(), "debug") {
+		t.Errorf("strict mode: error %v, want the unknown field reported", err)
+	}
+	if _, err := parseEnvelope(known); err != nil {
+		t.Errorf("strict mode rejected known fields: %v", err)
+	}
+
+	// 被拒绝的消息不回显而是回复错误，带回请求 id，后续合法消息照常处理
+	srv := startTestServer(t)
+	client := dialTestClient(t, srv, "")
+	client.SendRaw(map[string]any{"protocol_id": 1, "id": "strict-1", "data": map[string]any{"msg": "extra"}, "debug": true})
+	if env := client.RecvProtocol(protocolError); env.ID != "strict-1" || !strings.Contains(fmt.Sprint(env.Data["error"]), "debug") {
+		t.Fatalf("error reply %+v, want the unknown field reported for strict-1", env)
+	}
+	client.Send(1, map[string]any{"msg": "plain"})
+	if env := client.RecvProtocol(2); env.Data["msg"] != "plain"+echoSuffix {
+		t.Fatalf("echo %v, want only the plain message echoed", env.Data)
+	}
+}
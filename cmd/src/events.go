@@ -0,0 +1,94 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// 观察者事件的类型
+const (
+	EventConnect    = "connect"
+	EventDisconnect = "disconnect"
+	EventBroadcast  = "broadcast"
+	EventReceive    = "receive"
+)
+
+// 每个观察者待处理事件的缓冲大小，处理不及时时新事件被丢弃，不会拖慢 Hub
+const observerBuffer = 256
+
+// Event 是发布给观察者的一条消息流事件，Data 与 Hub 内部共享，观察者不能修改
+type Event struct {
+	Kind     string
+	Time     time.Time
+	ClientID string
+	ConnID   string
+	// 广播的序号，仅 broadcast 事件有效
+	Seq uint64
+	// 收到消息的协议号，仅 receive 事件有效
+	ProtocolID int64
+	// 广播或收到的原始消息
+	Data []byte
+}
+
+// observer 是一个已注册的观察者，事件经由 events 通道交给独立的 goroutine 处理
+type observer struct {
+	events  chan Event
+	dropped int64
+}
+
+// observers 保存 Hub 的观察者，Subscribe 可在任意 goroutine 中调用，因此单独加锁
+type observers struct {
+	mu   sync.Mutex
+	list []*observer
+}
+
+// Subscribe 注册观察者，fn 在独立的 goroutine 中按发生顺序被调用，不会阻塞 Hub。
+// 用于接入统计分析或调试工具；返回的函数用于取消注册。分片时观察者登记在协调者上，收到所有分片的事件
+func (h *Hub) Subscribe(fn func(Event)) (unsubscribe func()) {
+	h = h.root()
+	o := &observer{events: make(chan Event, observerBuffer)}
+	h.observers.mu.Lock()
+	h.observers.list = append(h.observers.list, o)
+	h.observers.mu.Unlock()
+	go func() {
+		for e := range o.events {
+			fn(e)
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			h.observers.mu.Lock()
+			defer h.observers.mu.Unlock()
+			list := make([]*observer, 0, len(h.observers.list))
+			for _, other := range h.observers.list {
+				if other != o {
+					list = append(list, other)
+				}
+			}
+			h.observers.list = list
+			close(o.events)
+		})
+	}
+}
+
+// publish 将事件交给所有观察者，观察者的缓冲已满时丢弃该事件
+func (h *Hub) publish(e Event) {
+	h = h.root()
+	h.observers.mu.Lock()
+	defer h.observers.mu.Unlock()
+	if len(h.observers.list) == 0 {
+		return
+	}
+	e.Time = time.Now()
+	for _, o := range h.observers.list {
+		select {
+		case o.events <- e:
+		default:
+			o.dropped++
+			if o.dropped == 1 || o.dropped%1000 == 0 {
+				warnf("Observer is too slow, %d events dropped", o.dropped)
+			}
+		}
+	}
+}
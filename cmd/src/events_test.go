@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// nextEvent 返回 events 中下一个指定类型的事件，跳过其他类型
+func nextEvent(t *testing.T, events <-chan Event, kind string) Event {
+	t.Helper()
+	timeout := time.After(testRecvTimeout)
+	for {
+		select {
+		case e := <-events:
+			if e.Kind == kind {
+				return e
+			}
+		case <-timeout:
+			t.Fatalf("no %s event within %v", kind, testRecvTimeout)
+		}
+	}
+}
+
+// TestObserver 观察者依次收到连接、收到消息、广播和断开事件，取消注册后不再收到事件
+func TestObserver(t *testing.T) {
+	srv := startTestServer(t)
+	events := make(chan Event, observerBuffer)
+	unsubscribe := hub.Subscribe(func(e Event) { events <- e })
+
+	client := dialTestClient(t, srv, "client_id=watched")
+	if e := nextEvent(t, events, EventConnect); e.ClientID != "watched" || e.ConnID == "" || e.Time.IsZero() {
+		t.Errorf("connect event %+v", e)
+	}
+	client.Send(1, map[string]any{"msg": "hi"})
+	if e := nextEvent(t, events, EventReceive); e.ClientID != "watched" || e.ProtocolID != 1 || !strings.Contains(string(e.Data), "hi") {
+		t.Errorf("receive event %+v", e)
+	}
+	postTask(t, srv, "observed")
+	if e := nextEvent(t, events, EventBroadcast); e.Seq == 0 || !strings.Contains(string(e.Data), "observed") {
+		t.Errorf("broadcast event %+v", e)
+	}
+	client.conn.Close()
+	if e := nextEvent(t, events, EventDisconnect); e.ClientID != "watched" {
+		t.Errorf("disconnect event %+v", e)
+	}
+
+	unsubscribe()
+	unsubscribe()
+	postTask(t, srv, "unobserved")
+	select {
+	case e := <-events:
+		t.Errorf("event %+v after unsubscribe", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
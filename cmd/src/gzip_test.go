@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestGzipResponse 接受 gzip 且响应体不小于 gzipMinSize 时压缩，解压后与原响应一致；小响应和不接受 gzip 的请求原样返回
+func TestGzipResponse(t *testing.T) {
+	large := `{"msg":"` + strings.Repeat("x", gzipMinSize) + `"}`
+	handler := func(body string) http.HandlerFunc {
+		return gzipResponse(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, body)
+		})
+	}
+	for _, tc := range []struct {
+		name, body, accept string
+		gzipped            bool
+	}{
+		{"large gzip", large, "deflate, gzip", true},
+		{"large identity", large, "", false},
+		{"large gzip refused", large, "gzip;q=0", false},
+		{"small gzip", `{"msg":"x"}`, "gzip", false},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/stats", nil)
+		if tc.accept != "" {
+			req.Header.Set("Accept-Encoding", tc.accept)
+		}
+		rec := httptest.NewRecorder()
+		handler(tc.body)(rec, req)
+		body := rec.Body.Bytes()
+		if gzipped := rec.Header().Get("Content-Encoding") == "gzip"; gzipped != tc.gzipped {
+			t.Errorf("%s: gzipped %v, want %v", tc.name, gzipped, tc.gzipped)
+			continue
+		}
+		if tc.gzipped {
+			zr, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				t.Fatalf("%s: gzip reader: %v", tc.name, err)
+			}
+			if body, err = io.ReadAll(zr); err != nil {
+				t.Fatalf("%s: decompress: %v", tc.name, err)
+			}
+		}
+		if rec.Code != http.StatusCreated || string(body) != tc.body || rec.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("%s: status %d, Vary %q, body %d bytes; want 201 with the original body", tc.name, rec.Code, rec.Header().Get("Vary"), len(body))
+		}
+	}
+}
+
+// TestGzipResults 较大的复判结果在请求 gzip 时压缩返回，解压后是完整的任务记录
+func TestGzipResults(t *testing.T) {
+	srv := startTestServer(t)
+	client := dialTestClient(t, srv, "")
+	waitClients(t, 1)
+	id := postTask(t, srv, "m1")
+	var task InspectorResult
+	client.RecvProtocol(1).decodeData(&task)
+	task.Target = "/img/" + strings.Repeat("long/", 150) + "1.jpg"
+	client.Send(2, task)
+	waitFor(t, func() bool {
+		record, ok := tasks.get(id)
+		return ok && record.Status == taskCompleted
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/results/"+id, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("get result: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding %q, want gzip", resp.Header.Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	var record taskRecord
+	if err := json.NewDecoder(zr).Decode(&record); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if record.ID != id || !strings.Contains(string(record.Result), task.Target) {
+		t.Errorf("record %s with %d byte result, want the completed task", record.ID, len(record.Result))
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// 测试中等待一条消息的最长时间
+const testRecvTimeout = 5 * time.Second
+
+// startTestServer 启动进程内服务并替换全局 hub，测试结束时停止 Hub 并关闭服务
+func startTestServer(t testing.TB) *httptest.Server {
+	t.Helper()
+	return startTestServerAt(t, "")
+}
+
+// startTestServerAt 与 startTestServer 相同，但所有路由挂在 basePath 之下
+func startTestServerAt(t testing.TB, basePath string) *httptest.Server {
+	t.Helper()
+	setupLogging("error", io.Discard)
+	s := newServer(basePath, defaultReplaySize, time.Minute)
+	srv := httptest.NewServer(s.Handler)
+	h := hub
+	t.Cleanup(func() {
+		closeClients(h)
+		h.stop()
+		<-h.stopped
+		srv.Close()
+	})
+	return srv
+}
+
+// closeClients 关闭 h 及其各分片中所有真实连接并等待其 readPump 注销。readPump 处理完最后一条消息后才注销，
+// 等到注销后再停止 Hub，之后的测试修改 resultWebhook 等全局配置时不会与残留的读取竞争
+func closeClients(h *Hub) {
+	connected := func() []*websocket.Conn {
+		var conns []*websocket.Conn
+		for _, member := range h.members() {
+			member.query(func() {
+				for client := range member.clients {
+					if client.conn != nil {
+						conns = append(conns, client.conn)
+					}
+				}
+			})
+		}
+		return conns
+	}
+	for _, conn := range connected() {
+		conn.Close()
+	}
+	deadline := time.Now().Add(testRecvTimeout)
+	for len(connected()) > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// testClient 是连接到进程内服务的 WebSocket 客户端
+type testClient struct {
+	t    testing.TB
+	conn *websocket.Conn
+	// writePump 合并在同一帧中、尚未取出的消息
+	queued [][]byte
+}
+
+// dialTestClient 连接 srv 的 /ws，query 为附加的查询参数（如 client_id=a），可为空。
+// 连接在测试结束时关闭
+func dialTestClient(t testing.TB, srv *httptest.Server, query string) *testClient {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+	if query != "" {
+		url += "?" + query
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial %s: %v", url, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &testClient{t: t, conn: conn}
+}
+
+// Send 向服务端发送一条 protocol_id 为 protocolID、data 为 data 的消息
+func (c *testClient) Send(protocolID int, data any) {
+	c.t.Helper()
+	c.SendRaw(map[string]any{"protocol_id": protocolID, "data": data})
+}
+
+// SendRaw 将 v 编码为 JSON 后原样发送
+func (c *testClient) SendRaw(v any) {
+	c.t.Helper()
+	c.conn.SetWriteDeadline(time.Now().Add(testRecvTimeout))
+	if err := c.conn.WriteJSON(v); err != nil {
+		c.t.Fatalf("send: %v", err)
+	}
+}
+
+// RecvRaw 返回下一条消息的原始 JSON，合并在一帧中的消息逐条返回
+func (c *testClient) RecvRaw() []byte {
+	c.t.Helper()
+	for len(c.queued) == 0 {
+		c.conn.SetReadDeadline(time.Now().Add(testRecvTimeout))
+		_, frame, err := c.conn.ReadMessage()
+		if err != nil {
+			c.t.Fatalf("recv: %v", err)
+		}
+		c.queued = bytes.Split(frame, []byte{'\n'})
+	}
+	message := c.queued[0]
+	c.queued = c.queued[1:]
+	return message
+}
+
+// Recv 返回下一条消息解析后的信封
+func (c *testClient) Recv() Envelope {
+	c.t.Helper()
+	message := c.RecvRaw()
+	env, err := parseEnvelope(message)
+	if err != nil {
+		c.t.Fatalf("recv %s: %v", message, err)
+	}
+	return env
+}
+
+// RecvProtocol 跳过其他消息（如欢迎消息），返回下一条 protocol_id 为 protocolID 的消息
+func (c *testClient) RecvProtocol(protocolID int64) Envelope {
+	c.t.Helper()
+	for {
+		if env := c.Recv(); env.ProtocolID == protocolID {
+			return env
+		}
+	}
+}
+
+// waitClients 等待 Hub 中的客户端数变为 n
+func waitClients(t testing.TB, n int) {
+	t.Helper()
+	deadline := time.Now().Add(testRecvTimeout)
+	for {
+		count := 0
+		for _, member := range hub.members() {
+			member.query(func() { count += len(member.clients) })
+		}
+		if count == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("hub has %d clients, want %d", count, n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// waitFor 轮询 cond 直到其为真，超时则测试失败
+func waitFor(t testing.TB, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(testRecvTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met within %v", testRecvTimeout)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// postTask 以 /tasks 广播一个任务，返回分配的任务 id
+func postTask(t testing.TB, srv *httptest.Server, model string) string {
+	t.Helper()
+	resp, err := http.Post(srv.URL+"/tasks?address=/img/1.jpg&model="+model+"&version=v1", "", nil)
+	if err != nil {
+		t.Fatalf("post task: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("post task: status %d: %s", resp.StatusCode, body)
+	}
+	// 任务 id 是 Location 指向的结果地址的最后一段
+	location := resp.Header.Get("Location")
+	return location[strings.LastIndex(location, "/")+1:]
+}
+
+// 测试中使用的管理令牌
+const testAdminToken = "test-admin"
+
+// adminRequest 以管理令牌向 srv 发送请求，返回状态码和响应体
+func adminRequest(t testing.TB, srv *httptest.Server, method, path string) (int, []byte) {
+	t.Helper()
+	return adminRequestBody(t, srv, method, path, "")
+}
+
+// adminRequestBody 与 adminRequest 相同，但附带请求体 body
+func adminRequestBody(t testing.TB, srv *httptest.Server, method, path, body string) (int, []byte) {
+	t.Helper()
+	prev := access.Load()
+	access.Store(&accessControl{adminToken: testAdminToken})
+	defer access.Store(prev)
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, respBody
+}
+
+// overrideSettings 不经过 PUT /setting 的校验直接修改当前设置，用于测试需要的极短 ping 周期等取值，
+// 测试结束时恢复原设置
+func overrideSettings(t testing.TB, modify func(*Settings)) {
+	t.Helper()
+	settings.mu.Lock()
+	saved := settings.current
+	modify(&settings.current)
+	settings.mu.Unlock()
+	t.Cleanup(func() {
+		settings.mu.Lock()
+		settings.current = saved
+		settings.mu.Unlock()
+	})
+}
+
+// getJSON 以 GET 请求 srv 的 path，将响应解码到 v，返回状态码
+func getJSON(t testing.TB, srv *httptest.Server, path string, v any) int {
+	t.Helper()
+	resp, err := http.Get(srv.URL + path)
+	if err != nil {
+		t.Fatalf("get %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("decode %s: %v", path, err)
+	}
+	return resp.StatusCode
+}
+
+// logBuffer 是可并发写入和读取的日志输出
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// captureLogs 将 level 及以上级别的日志写入返回的缓冲区，测试结束时恢复为丢弃
+func captureLogs(t testing.TB, level string) *logBuffer {
+	t.Helper()
+	logs := new(logBuffer)
+	if err := setupLogging(level, logs); err != nil {
+		t.Fatalf("setup logging: %v", err)
+	}
+	t.Cleanup(func() { setupLogging("error", io.Discard) })
+	return logs
+}
+
+// logLine 返回 logs 中第一条包含全部 parts 的日志行，没有则返回空串
+func logLine(logs *logBuffer, parts ...string) string {
+	for _, line := range strings.Split(logs.String(), "\n") {
+		matched := true
+		for _, part := range parts {
+			if !strings.Contains(line, part) {
+				matched = false
+				break
+			}
+		}
+		if matched && line != "" {
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// 单个记录的请求头值的最大长度，超出部分截断
+const maxCapturedHeaderLen = 256
+
+// 升级请求中需要记录到客户端上的请求头，由 -capture-headers 配置。
+// 只记录名单中的请求头，避免客户端通过任意请求头占用内存
+var capturedHeaders = []string{"X-Reviewer-Name", "X-Reviewer-Version"}
+
+// parseHeaderList 解析逗号分隔的请求头名称，并规范为标准大小写形式
+func parseHeaderList(list string) []string {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, http.CanonicalHeaderKey(name))
+		}
+	}
+	return names
+}
+
+// captureHeaders 按名单提取请求头，没有任何匹配时返回 nil
+func captureHeaders(r *http.Request) map[string]string {
+	var captured map[string]string
+	for _, name := range capturedHeaders {
+		value := r.Header.Get(name)
+		if value == "" {
+			continue
+		}
+		if len(value) > maxCapturedHeaderLen {
+			value = value[:maxCapturedHeaderLen]
+		}
+		if captured == nil {
+			captured = make(map[string]string)
+		}
+		captured[name] = value
+	}
+	return captured
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestCaptureHeaders 升级请求中只记录名单内的请求头，过长的值被截断，记录的请求头出现在 /clients 和日志中
+func TestCaptureHeaders(t *testing.T) {
+	srv := startTestServer(t)
+	logs := captureLogs(t, "info")
+
+	header := http.Header{}
+	header.Set("X-Reviewer-Name", "station-7")
+	header.Set("X-Reviewer-Version", strings.Repeat("9", 2*maxCapturedHeaderLen))
+	header.Set("X-Other", "ignored")
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws?client_id=h1", header)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	waitClients(t, 1)
+
+	var infos []ClientInfo
+	getJSON(t, srv, "/clients", &infos)
+	if len(infos) != 1 {
+		t.Fatalf("/clients = %+v, want one client", infos)
+	}
+	want := map[string]string{
+		"X-Reviewer-Name":    "station-7",
+		"X-Reviewer-Version": strings.Repeat("9", maxCapturedHeaderLen),
+	}
+	if fmt.Sprint(infos[0].Headers) != fmt.Sprint(want) {
+		t.Errorf("headers %v, want %v", infos[0].Headers, want)
+	}
+	waitFor(t, func() bool { return logLine(logs, "Client h1 headers:", "station-7") != "" })
+	if strings.Contains(logs.String(), "X-Other") {
+		t.Errorf("header outside the allowlist logged:\n%s", logs)
+	}
+}
+
+// TestParseHeaderList 请求头名单去除空白和空项，并规范为标准大小写
+func TestParseHeaderList(t *testing.T) {
+	got := parseHeaderList(" x-reviewer-name, ,X-SITE ,")
+	if want := []string{"X-Reviewer-Name", "X-Site"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("parseHeaderList = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestHubStop 停止后 run() 在期限内返回并向在线客户端发送关闭帧，之后的提交、注册和查询都不会阻塞
+func TestHubStop(t *testing.T) {
+	srv := startTestServer(t)
+	client := dialTestClient(t, srv, "")
+	waitClients(t, 1)
+
+	// 停止时还有一个正在等待分发结果的提交
+	blocked := make(chan struct{})
+	go hub.query(func() { <-blocked })
+	submitted := make(chan error, 1)
+	go func() {
+		_, err := hub.submit([]byte(`{"protocol_id":1,"data":{}}`), priorityNormal)
+		submitted <- err
+	}()
+
+	hub.stop()
+	close(blocked)
+	select {
+	case <-hub.stopped:
+	case <-time.After(time.Second):
+		t.Fatal("run() did not return within 1s of stop")
+	}
+	if err := <-submitted; err != nil && !errors.Is(err, errHubStopped) {
+		t.Errorf("pending submit returned %v", err)
+	}
+
+	client.conn.SetReadDeadline(time.Now().Add(testRecvTimeout))
+	for {
+		_, _, err := client.conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if _, ok := err.(*websocket.CloseError); !ok {
+			t.Errorf("read after stop: %v, want a close frame", err)
+		}
+		break
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := hub.submit([]byte(`{"protocol_id":1,"data":{}}`), priorityNormal); !errors.Is(err, errHubStopped) {
+			t.Errorf("submit after stop returned %v, want errHubStopped", err)
+		}
+		if hub.join(fakeClient("late")) {
+			t.Error("join after stop succeeded")
+		}
+		ran := false
+		hub.query(func() { ran = true })
+		if ran {
+			t.Error("query ran after stop")
+		}
+		hub.leave(fakeClient("late"))
+		hub.stop()
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("hub calls blocked after stop")
+	}
+}
+
+// TestConnectAfterStop Hub 停止后新连接的注册立即失败，服务端以 1001 关闭连接，升级请求不会阻塞
+func TestConnectAfterStop(t *testing.T) {
+	srv := startTestServer(t)
+	hub.stop()
+	<-hub.stopped
+
+	client := dialTestClient(t, srv, "")
+	client.conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err := client.conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Fatalf("read after connecting to a stopped hub: %v, want close 1001", err)
+	}
+}
+
+// TestShutdownWaitsForWritePumps shutdownServer 等到各连接的 writePump 写完已排队的消息、
+// 发送关闭帧并关闭连接后才返回
+func TestShutdownWaitsForWritePumps(t *testing.T) {
+	setupLogging("error", io.Discard)
+	server := newServer("", defaultReplaySize, time.Minute)
+	srv := httptest.NewServer(server.Handler)
+	defer srv.Close()
+	client := dialTestClient(t, srv, "")
+	waitClients(t, 1)
+	serverConn := hubClient(t).conn
+	for i := 0; i < 20; i++ {
+		hub.submit([]byte(`{"protocol_id":1,"data":{}}`), priorityNormal)
+	}
+
+	shutdownServer(server, time.Second)
+	if err := serverConn.UnderlyingConn().SetDeadline(time.Now()); err == nil {
+		t.Fatal("server side connection still open after shutdown")
+	}
+	received := 0
+	client.conn.SetReadDeadline(time.Now().Add(testRecvTimeout))
+	for {
+		_, frame, err := client.conn.ReadMessage()
+		if err != nil {
+			if _, ok := err.(*websocket.CloseError); !ok {
+				t.Fatalf("read after shutdown: %v, want a close frame", err)
+			}
+			break
+		}
+		received += bytes.Count(frame, []byte{'\n'}) + 1
+	}
+	// 欢迎、会话等连接时的消息之外，20 条广播都已写出
+	if received < 20 {
+		t.Fatalf("received %d messages before the close frame, want all 20 broadcasts", received)
+	}
+}
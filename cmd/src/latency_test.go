@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// TestReviewLatency 复判端带回广播的时间戳后，往返耗时计入统计且为正
+func TestReviewLatency(t *testing.T) {
+	srv := startTestServer(t)
+	client := dialTestClient(t, srv, "")
+	waitClients(t, 1)
+	before := stats.latency.snapshot().Count
+	postTask(t, srv, "m1")
+
+	var task struct {
+		ProtocolID int64           `json:"protocol_id"`
+		Data       json.RawMessage `json:"data"`
+		Timestamp  int64           `json:"timestamp"`
+	}
+	for task.ProtocolID != 1 {
+		if err := json.Unmarshal(client.RecvRaw(), &task); err != nil {
+			t.Fatalf("decode broadcast: %v", err)
+		}
+	}
+	if task.Timestamp <= 0 {
+		t.Fatalf("broadcast timestamp %d, want the server send time", task.Timestamp)
+	}
+	time.Sleep(20 * time.Millisecond)
+	client.SendRaw(map[string]any{"protocol_id": 2, "data": task.Data, "timestamp": task.Timestamp})
+
+	waitFor(t, func() bool { return stats.latency.snapshot().Count == before+1 })
+	if snap := stats.latency.snapshot(); snap.AvgMs <= 0 || snap.P99Ms <= 0 {
+		t.Errorf("latency snapshot %+v, want positive values", snap)
+	}
+}
+
+// TestLatencyPercentiles 分位数按最近的样本计算，样本满后覆盖最旧的记录
+func TestLatencyPercentiles(t *testing.T) {
+	l := newLatencyRecorder(10)
+	for i := 1; i <= 10; i++ {
+		l.record(time.Duration(i) * time.Millisecond)
+	}
+	snap := l.snapshot()
+	if snap.Count != 10 || snap.AvgMs != 5.5 || snap.P50Ms != 5 || snap.P90Ms != 9 || snap.P99Ms != 9 {
+		t.Fatalf("snapshot %+v", snap)
+	}
+	// 再记录 10 个 100ms，原有样本全部被覆盖，平均值仍按全部记录计算
+	for i := 0; i < 10; i++ {
+		l.record(100 * time.Millisecond)
+	}
+	snap = l.snapshot()
+	if snap.Count != 20 || snap.P50Ms != 100 || snap.AvgMs != 52.75 {
+		t.Fatalf("snapshot after wrap %+v", snap)
+	}
+}
@@ -0,0 +1,16 @@
+package main
+
+import "time"
+
+// 连接的最长存活时间，超过后要求客户端重连以便重新认证，0 表示不限制，由 -max-conn-lifetime 配置
+var maxConnLifetime time.Duration
+
+// lifetimeTimer 返回连接达到最长存活时间时触发的通道，未限制时返回 nil（永不触发）。
+// 返回的 stop 用于在 writePump 退出时释放计时器
+func (c *Client) lifetimeTimer() (<-chan time.Time, func() bool) {
+	if maxConnLifetime <= 0 {
+		return nil, func() bool { return false }
+	}
+	timer := time.NewTimer(maxConnLifetime - time.Since(c.connectedAt))
+	return timer.C, timer.Stop
+}
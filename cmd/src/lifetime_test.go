@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestMaxConnLifetime 超过最长存活时间的连接被移除并以 1012 关闭，期间持续发送的消息不会导致 panic
+func TestMaxConnLifetime(t *testing.T) {
+	maxConnLifetime = 100 * time.Millisecond
+	defer func() { maxConnLifetime = 0 }()
+	srv := startTestServer(t)
+	client := dialTestClient(t, srv, "")
+	waitClients(t, 1)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if err := client.conn.WriteJSON(map[string]any{"protocol_id": 1, "data": map[string]any{"msg": "spam"}}); err != nil {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	client.conn.SetReadDeadline(time.Now().Add(testRecvTimeout))
+	var err error
+	for err == nil {
+		_, _, err = client.conn.ReadMessage()
+	}
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseServiceRestart {
+		t.Fatalf("connection closed with %v, want close code %d", err, websocket.CloseServiceRestart)
+	}
+	waitClients(t, 0)
+	<-done
+}
+
+// TestAcceptedAfterRemoval 被移除的客户端只有结果类消息仍被处理
+func TestAcceptedAfterRemoval(t *testing.T) {
+	for id, want := range map[int64]bool{
+		1:                    false,
+		2:                    true,
+		protocolSubscribe:    false,
+		protocolRelay:        false,
+		protocolResultChunk:  true,
+		protocolAck:          true,
+		protocolProgress:     true,
+		protocolCapabilities: false,
+	} {
+		if got := acceptedAfterRemoval(id); got != want {
+			t.Errorf("acceptedAfterRemoval(%d) = %t, want %t", id, got, want)
+		}
+	}
+}
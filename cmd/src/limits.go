@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 按 protocol_id 单独设置的消息长度上限（字节），未列出的协议使用 MaxMessageSize，
+// 由 -protocol-size-limits 配置
+var protocolSizeLimits = map[int64]int64{}
+
+// parseProtocolSizeLimits 解析逗号分隔的 protocol_id=bytes 列表，如 "2=65536,6=4096"
+func parseProtocolSizeLimits(list string) (map[int64]int64, error) {
+	limits := make(map[int64]int64)
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		id, size, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q must be in the form protocol_id=bytes", item)
+		}
+		protocolID, err := strconv.ParseInt(strings.TrimSpace(id), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid protocol_id in %q", item)
+		}
+		limit, err := strconv.ParseInt(strings.TrimSpace(size), 10, 64)
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("size in %q must be a positive integer", item)
+		}
+		limits[protocolID] = limit
+	}
+	return limits, nil
+}
+
+// protocolSizeLimit 返回指定协议允许的最大消息长度
+func (s Settings) protocolSizeLimit(protocolID int64) int64 {
+	if limit, ok := protocolSizeLimits[protocolID]; ok {
+		return limit
+	}
+	return s.MaxMessageSize
+}
+
+// readLimit 返回连接层的读取上限，需容纳所有协议中最大的上限，各协议的上限在读出后再单独检查
+func (s Settings) readLimit() int64 {
+	limit := s.MaxMessageSize
+	for _, l := range protocolSizeLimits {
+		if l > limit {
+			limit = l
+		}
+	}
+	return limit
+}
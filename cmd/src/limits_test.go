@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestProtocolSizeLimits 单独放宽上限的协议可以发送超过 MaxMessageSize 的消息，其他协议同样大小的消息被拒绝并回复错误，
+// 被拒绝的消息不计入协议统计
+func TestProtocolSizeLimits(t *testing.T) {
+	t.Cleanup(func() { protocolSizeLimits = map[int64]int64{} })
+	protocolSizeLimits = map[int64]int64{protocolRelay: 8 * maxMessageSize}
+	srv := startTestServer(t)
+	sender := dialTestClient(t, srv, "client_id=a")
+	peer := dialTestClient(t, srv, "client_id=b")
+	waitClients(t, 2)
+
+	large := strings.Repeat("x", 4*maxMessageSize)
+	sender.Send(protocolRelay, map[string]any{"note": large})
+	if env := peer.RecvProtocol(protocolRelay); env.Data["note"] != large {
+		t.Fatalf("peer received %d byte note, want %d", len(env.Data["note"].(string)), len(large))
+	}
+
+	key := fmt.Sprint(protocolSubscribe)
+	before := stats.snapshot().ProtocolMessages[key]
+	sender.Send(protocolSubscribe, map[string]any{"note": large})
+	env := sender.RecvProtocol(protocolError)
+	if after := stats.snapshot().ProtocolMessages[key]; after != before {
+		t.Errorf("protocol_id %d count %d -> %d for a rejected message", protocolSubscribe, before, after)
+	}
+	if fmt.Sprint(env.Data["protocol_id"]) != fmt.Sprint(protocolSubscribe) || !strings.Contains(env.Data["error"].(string), "exceeds limit") {
+		t.Fatalf("error reply %v, want size limit exceeded for protocol_id %d", env.Data, protocolSubscribe)
+	}
+}
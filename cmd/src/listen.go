@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+)
+
+// listen 根据参数创建监听：指定 unixSocket 时监听该 Unix 域套接字路径，否则监听 TCP 地址 addr
+func listen(addr, unixSocket string) (net.Listener, error) {
+	if unixSocket == "" {
+		return net.Listen("tcp", addr)
+	}
+	// 清理上次异常退出遗留的套接字文件，否则 Listen 会因地址已占用而失败
+	if info, err := os.Lstat(unixSocket); err == nil {
+		if info.Mode()&fs.ModeSocket == 0 {
+			return nil, errors.New("unix socket path exists and is not a socket: " + unixSocket)
+		}
+		if err := os.Remove(unixSocket); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("unix", unixSocket)
+	if err != nil {
+		return nil, err
+	}
+	// 关闭监听时删除套接字文件
+	ln.(*net.UnixListener).SetUnlinkOnClose(true)
+	return ln, nil
+}
+
+// unixPeerHost 是通过 Unix 域套接字接入的对端所使用的主机名
+const unixPeerHost = "unix"
+
+// splitRemoteAddr 拆分请求的远程地址。通过 Unix 域套接字接入时远程地址为 "@" 或空，
+// 无法按 host:port 拆分，此时返回 unixPeerHost 作为主机名
+func splitRemoteAddr(remoteAddr string) (host, port string, err error) {
+	if remoteAddr == "@" || remoteAddr == "" {
+		return unixPeerHost, "", nil
+	}
+	return net.SplitHostPort(remoteAddr)
+}
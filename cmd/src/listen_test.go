@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestUnixSocket 通过 Unix 域套接字完成 WebSocket 升级和消息往返，关闭监听后删除套接字文件
+func TestUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ws.sock")
+	// 遗留的套接字文件会被清理
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := listen("", path)
+	if err != nil {
+		t.Fatalf("listen on unix socket: %v", err)
+	}
+	setupLogging("error", io.Discard)
+	server := newServer("", defaultReplaySize, time.Minute)
+	go server.Serve(ln)
+	defer shutdownServer(server, time.Second)
+
+	dialer := websocket.Dialer{
+		NetDialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}
+	conn, resp, err := dialer.Dial("ws://unix/ws", nil)
+	if err != nil {
+		t.Fatalf("dial over unix socket: %v", err)
+	}
+	defer conn.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("upgrade status %d", resp.StatusCode)
+	}
+	client := &testClient{t: t, conn: conn}
+	welcome := client.RecvProtocol(protocolWelcome)
+	if id, _ := welcome.Data["client_id"].(string); id != unixPeerHost+":"+welcome.Data["conn_id"].(string) {
+		t.Errorf("client id %q, want %s:<conn_id>", id, unixPeerHost)
+	}
+	client.Send(1, map[string]any{"msg": "hi"})
+	if env := client.RecvProtocol(2); env.Data["msg"] == nil {
+		t.Errorf("echo %v has no msg", env.Data)
+	}
+
+	conn.Close()
+	shutdownServer(server, time.Second)
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("socket file still exists after shutdown: %v", err)
+	}
+}
+
+// TestUnixSocketNotASocket 路径上已有普通文件时拒绝监听，不会删除该文件
+func TestUnixSocketNotASocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ws.sock")
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if ln, err := listen("", path); err == nil {
+		ln.Close()
+		t.Fatal("listen succeeded on a regular file")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("regular file removed: %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 当前日志级别，可在运行期调整
+var logLevel = new(slog.LevelVar)
+
+// setupLogging 按级别名称（debug/info/warn/error）初始化输出到 out 的默认 slog 日志器
+func setupLogging(level string, out io.Writer) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(strings.ToUpper(level))); err != nil {
+		return fmt.Errorf("invalid log level %q: %v", level, err)
+	}
+	logLevel.Set(l)
+	slog.SetDefault(slog.New(slog.NewTextHandler(out, &slog.HandlerOptions{
+		Level:     logLevel,
+		AddSource: true,
+		// 与原先 log.Lshortfile 一致，source 只保留文件名和行号
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if src, ok := a.Value.Any().(*slog.Source); ok && a.Key == slog.SourceKey {
+				return slog.String(slog.SourceKey, fmt.Sprintf("%s:%d", filepath.Base(src.File), src.Line))
+			}
+			return a
+		},
+	})))
+	return nil
+}
+
+// logFile 是 -log-file 指定的日志文件，收到 SIGHUP 时重新打开，配合 logrotate 使用
+type logFile struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+// openLogFile 以追加方式打开日志文件
+func openLogFile(path string) (*logFile, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &logFile{path: path, f: f}, nil
+}
+
+func (l *logFile) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Write(p)
+}
+
+// reopen 关闭当前文件并按原路径重新打开，打开失败时继续写入原文件
+func (l *logFile) reopen() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	old := l.f
+	l.f = f
+	l.mu.Unlock()
+	return old.Close()
+}
+
+func (l *logFile) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+// logAt 以指定级别输出格式化日志。级别未启用时直接返回，不做任何字符串格式化，
+// source 记录为调用 debugf 等函数的位置
+func logAt(level slog.Level, attrs []slog.Attr, format string, v ...interface{}) {
+	ctx := context.Background()
+	logger := slog.Default()
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+	var pcs [1]uintptr
+	// 跳过 runtime.Callers、logAt 以及外层的 debugf 等包装函数
+	runtime.Callers(3, pcs[:])
+	r := slog.NewRecord(time.Now(), level, fmt.Sprintf(format, v...), pcs[0])
+	r.AddAttrs(attrs...)
+	_ = logger.Handler().Handle(ctx, r)
+}
+
+func debugf(format string, v ...interface{}) { logAt(slog.LevelDebug, nil, format, v...) }
+func infof(format string, v ...interface{})  { logAt(slog.LevelInfo, nil, format, v...) }
+func warnf(format string, v ...interface{})  { logAt(slog.LevelWarn, nil, format, v...) }
+func errorf(format string, v ...interface{}) { logAt(slog.LevelError, nil, format, v...) }
+
+// fatalf 以 error 级别输出日志后退出进程
+func fatalf(format string, v ...interface{}) {
+	logAt(slog.LevelError, nil, format, v...)
+	os.Exit(1)
+}
+
+// connAttrs 返回连接关联 ID 属性，使同一连接的所有日志都可按 conn=<id> 检索
+func connAttrs(connID string) []slog.Attr {
+	return []slog.Attr{slog.String("conn", connID)}
+}
+
+// connWarnf 和 connErrorf 用于尚未创建 Client 时输出带连接关联 ID 的日志
+func connWarnf(connID string, format string, v ...interface{}) {
+	logAt(slog.LevelWarn, connAttrs(connID), format, v...)
+}
+
+func connErrorf(connID string, format string, v ...interface{}) {
+	logAt(slog.LevelError, connAttrs(connID), format, v...)
+}
+
+func (c *Client) debugf(format string, v ...interface{}) {
+	logAt(slog.LevelDebug, connAttrs(c.connID), format, v...)
+}
+
+func (c *Client) infof(format string, v ...interface{}) {
+	logAt(slog.LevelInfo, connAttrs(c.connID), format, v...)
+}
+
+func (c *Client) warnf(format string, v ...interface{}) {
+	logAt(slog.LevelWarn, connAttrs(c.connID), format, v...)
+}
+
+func (c *Client) errorf(format string, v ...interface{}) {
+	logAt(slog.LevelError, connAttrs(c.connID), format, v...)
+}
+
+// 是否以缩进格式输出日志中的 JSON 消息，由 -pretty-logs 配置，只影响日志，不影响发送的数据
+var prettyLogs = false
+
+// logPayload 包装日志中输出的 JSON 消息，仅在日志真正被格式化时才进行缩进处理
+type logPayload []byte
+
+func (p logPayload) String() string {
+	if !prettyLogs {
+		return string(p)
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, p, "", "  "); err != nil {
+		return string(p)
+	}
+	return buf.String()
+}
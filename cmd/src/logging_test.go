@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// countingStringer 记录被格式化的次数
+type countingStringer struct{ calls int }
+
+func (s *countingStringer) String() string {
+	s.calls++
+	return "formatted"
+}
+
+// TestLogLevel info 级别下不输出也不格式化 debug 日志，连接事件照常输出；debug 级别下输出逐条消息的日志
+func TestLogLevel(t *testing.T) {
+	if err := setupLogging("verbose", &logBuffer{}); err == nil {
+		t.Error("setupLogging accepted an unknown level")
+	}
+	srv := startTestServer(t)
+
+	logs := captureLogs(t, "info")
+	arg := &countingStringer{}
+	debugf("debug line %v", arg)
+	client := dialTestClient(t, srv, "")
+	client.Send(1, map[string]any{"msg": "hi"})
+	client.RecvProtocol(2)
+	if arg.calls != 0 {
+		t.Errorf("debug arguments formatted %d times at info level", arg.calls)
+	}
+	if line := logLine(logs, "DEBUG"); line != "" {
+		t.Errorf("debug line logged at info level: %s", line)
+	}
+	if logLine(logs, "level=INFO", "Client registered") == "" {
+		t.Errorf("no info register line:\n%s", logs)
+	}
+
+	logs = captureLogs(t, "debug")
+	debugf("debug line %v", arg)
+	client.Send(1, map[string]any{"msg": "hi"})
+	client.RecvProtocol(2)
+	if arg.calls != 1 || logLine(logs, "level=DEBUG", "debug line formatted") == "" {
+		t.Errorf("debug line not logged at debug level (%d formats):\n%s", arg.calls, logs)
+	}
+	// 日志的 source 指向调用 debugf 的位置而不是日志包装函数
+	if line := logLine(logs, "Echoing message"); !strings.Contains(line, "level=DEBUG") || !strings.Contains(line, "source=main.go:") {
+		t.Errorf("echo line %q, want a debug line with source main.go", line)
+	}
+}
+
+// TestPrettyLogs -pretty-logs 只让日志中的 JSON 缩进，发送给客户端的消息仍是紧凑格式
+func TestPrettyLogs(t *testing.T) {
+	prettyLogs = true
+	t.Cleanup(func() { prettyLogs = false })
+	srv := startTestServer(t)
+	logs := captureLogs(t, "debug")
+	client := dialTestClient(t, srv, "")
+	client.SendRaw(map[string]any{"protocol_id": 1, "data": map[string]any{"msg": "hi"}})
+
+	var wire []byte
+	for {
+		wire = client.RecvRaw()
+		if env, err := parseEnvelope(wire); err == nil && env.ProtocolID == 2 {
+			break
+		}
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, wire); err != nil || compact.String() != string(wire) {
+		t.Errorf("wire payload %q is not minified", wire)
+	}
+	// 文本日志中换行被转义为 \n
+	if line := logLine(logs, "Echoing message"); !strings.Contains(line, `{\n  \"protocol_id\": 2`) {
+		t.Errorf("echo log line %q is not indented", line)
+	}
+
+	payload := logPayload(`{"a":1}`)
+	if got := payload.String(); got != "{\n  \"a\": 1\n}" {
+		t.Errorf("pretty payload %q", got)
+	}
+	if got := logPayload(`not json`).String(); got != "not json" {
+		t.Errorf("invalid JSON payload %q, want it unchanged", got)
+	}
+}
+
+// TestLogFile 日志写入 -log-file 指定的文件；文件被移走后 reopen 在原路径创建新文件继续写入
+func TestLogFile(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := openLogFile(filepath.Join(dir, "missing", "server.log")); err == nil {
+		t.Error("opened a log file in a missing directory")
+	}
+
+	path := filepath.Join(dir, "server.log")
+	lf, err := openLogFile(path)
+	if err != nil {
+		t.Fatalf("open log file: %v", err)
+	}
+	t.Cleanup(func() {
+		setupLogging("error", io.Discard)
+		lf.Close()
+	})
+	if err := setupLogging("info", lf); err != nil {
+		t.Fatalf("setup logging: %v", err)
+	}
+	infof("before rotation")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if err := lf.reopen(); err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	infof("after rotation")
+
+	for file, want := range map[string]string{path + ".1": "before rotation", path: "after rotation"} {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("read %s: %v", file, err)
+		}
+		if !strings.Contains(string(content), want) || strings.Count(string(content), "\n") != 1 {
+			t.Errorf("%s contains %q, want only the %q line", file, content, want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestWriteErrorUnregisters writePump 写入失败退出时客户端从 Hub 中移除，连接随之关闭
+func TestWriteErrorUnregisters(t *testing.T) {
+	srv := startTestServer(t)
+	conn := dialTestClient(t, srv, "")
+	waitClients(t, 1)
+	client := hubClient(t)
+
+	// 只关闭服务端一侧的写方向，读方向仍可用，之后的写入必然失败
+	if err := client.conn.UnderlyingConn().(*countingConn).Conn.(*net.TCPConn).CloseWrite(); err != nil {
+		t.Fatalf("close write: %v", err)
+	}
+	hub.submit([]byte(`{"protocol_id":1,"data":{}}`), priorityNormal)
+	waitClients(t, 0)
+
+	// 服务端已关闭连接，readPump 不再读取
+	conn.conn.SetReadDeadline(time.Now().Add(testRecvTimeout))
+	for {
+		if _, _, err := conn.conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+}
+
+// benchmarkUpgradeWrite 每次迭代升级一条连接并写出一条消息后关闭，pool 为 nil 时每条连接各自分配写缓冲
+func benchmarkUpgradeWrite(b *testing.B, pool websocket.BufferPool) {
+	up := websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 16 << 10, WriteBufferPool: pool}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := up.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conn.WriteMessage(websocket.TextMessage, benchMessage)
+		conn.Close()
+	}))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			b.Fatalf("dial: %v", err)
+		}
+		if _, _, err := conn.ReadMessage(); err != nil {
+			b.Fatalf("read: %v", err)
+		}
+		conn.Close()
+	}
+}
+
+// BenchmarkWriteBufferPerConn 不使用写缓冲池（-write-buffer-pool=false）
+func BenchmarkWriteBufferPerConn(b *testing.B) { benchmarkUpgradeWrite(b, nil) }
+
+// BenchmarkWriteBufferPool 所有连接共享写缓冲池（默认）
+func BenchmarkWriteBufferPool(b *testing.B) { benchmarkUpgradeWrite(b, &sync.Pool{}) }
+
+// fakeClient 返回未连接网络的客户端，发送缓冲只放得下欢迎消息和续传令牌
+func fakeClient(id string) *Client {
+	return &Client{hub: hub, id: id, send: make(chan outMessage, 2), sendHigh: make(chan outMessage, 1), closing: make(chan struct{})}
+}
+
+// TestBroadcastOrder 广播按注册顺序投递，注销的客户端不影响其余客户端的相对顺序。
+// 所有客户端的发送缓冲都已满，广播依次将其移除，断开事件的顺序即投递顺序
+func TestBroadcastOrder(t *testing.T) {
+	startTestServer(t)
+	clients := make(map[string]*Client)
+	for _, id := range []string{"a", "b", "c", "d"} {
+		clients[id] = fakeClient(id)
+		hub.join(clients[id])
+	}
+	hub.leave(clients["b"])
+	hub.join(fakeClient("e"))
+
+	events := make(chan Event, 16)
+	unsubscribe := hub.Subscribe(func(e Event) { events <- e })
+	defer unsubscribe()
+	hub.submit([]byte(`{"protocol_id":1,"data":{}}`), priorityNormal)
+
+	var order []string
+	for len(order) < 4 {
+		select {
+		case e := <-events:
+			if e.Kind == EventDisconnect {
+				order = append(order, e.ClientID)
+			}
+		case <-time.After(testRecvTimeout):
+			t.Fatalf("only %v disconnected", order)
+		}
+	}
+	if got := strings.Join(order, ","); got != "a,c,d,e" {
+		t.Fatalf("delivery order %s, want a,c,d,e", got)
+	}
+}
+
+// 基准测试注册的客户端数
+const benchClients = 1000
+
+// benchMessage 是接近实际任务广播大小的 JSON
+var benchMessage = []byte(`{"protocol_id":1,"data":{"host":"10.0.0.12","target":"/line3/2024/06/01/cam2/000123.jpg",` +
+	`"model":"pcb-a","version":"v2","source":"inspector-3","task_id":"4f1c2d3e4a5b6c7d"},"timestamp":1717200000000}`)
+
+// benchHub 启动 Hub 并注册 n 个客户端，每个客户端由一个 goroutine 持续取走发送缓冲中的消息
+func benchHub(b *testing.B, n int) {
+	b.Helper()
+	startTestServer(b)
+	for i := 0; i < n; i++ {
+		client := &Client{
+			hub:      hub,
+			id:       fmt.Sprintf("bench-%d", i),
+			send:     make(chan outMessage, 256),
+			sendHigh: make(chan outMessage, highPrioritySendBuffer),
+			closing:  make(chan struct{}),
+		}
+		go func() {
+			for range client.send {
+			}
+		}()
+		hub.join(client)
+	}
+	waitClients(b, n)
+}
+
+// BenchmarkBroadcast 测量 Hub 向 benchClients 个客户端广播的吞吐
+func BenchmarkBroadcast(b *testing.B) {
+	benchmarkBroadcast(b, 1)
+}
+
+// BenchmarkBroadcastSharded 与 BenchmarkBroadcast 相同，但客户端分布在 benchShards 个分片中，
+// 两者对比即为分片带来的吞吐差异
+func BenchmarkBroadcastSharded(b *testing.B) {
+	benchmarkBroadcast(b, benchShards)
+}
+
+// 分片基准测试的分片数
+const benchShards = 4
+
+// benchmarkBroadcast 以 shards 个分片启动 Hub，测量向 benchClients 个客户端广播的吞吐。
+// 投递可能快于取走消息的 goroutine，发送缓冲满时等待而不是移除客户端
+func benchmarkBroadcast(b *testing.B, shards int) {
+	savedShards, savedTimeout := hubShards, clientSendTimeout
+	hubShards, clientSendTimeout = shards, time.Second
+	b.Cleanup(func() { hubShards, clientSendTimeout = savedShards, savedTimeout })
+	benchHub(b, benchClients)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if delivered, err := hub.submit(benchMessage, priorityNormal); err != nil || delivered != benchClients {
+			b.Fatalf("delivered %d, %v", delivered, err)
+		}
+	}
+}
+
+// BenchmarkRegisterUnregister 在已有 benchClients 个客户端时注册并注销一个客户端，
+// 衡量维护有序切片的开销
+func BenchmarkRegisterUnregister(b *testing.B) {
+	benchHub(b, benchClients)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		client := fakeClient("extra")
+		hub.join(client)
+		hub.leave(client)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import "encoding/json"
+
+// 各协议消息的类型化表示。下发的消息按这些结构编码，收到的消息先由 parseEnvelope 解析信封，
+// 再按 protocol_id 将 data 解码为对应的结构
+
+// TaskMessage 是下发给复判端的任务广播（protocol_id = 1）
+type TaskMessage struct {
+	ProtocolID int             `json:"protocol_id"`
+	Data       InspectorResult `json:"data"`
+	// 服务端发出广播的时间（Unix 毫秒），复判端需在结果中原样带回
+	Timestamp int64 `json:"timestamp"`
+	// 可选的有效期（毫秒），在客户端缓冲中等待超过该时间的任务不再下发
+	TTL int64 `json:"ttl,omitempty"`
+	// 启用追踪时的 W3C traceparent，复判端可以此为父节点继续追踪
+	Traceparent string `json:"traceparent,omitempty"`
+	// 配置了 -sign-key 时整个信封的签名，由 encodeSigned 在编码时加入
+	Signature string `json:"signature,omitempty"`
+}
+
+// TaskBatchMessage 是 /tasks/batch 下发的批量任务广播（protocol_id = 1），字段含义与 TaskMessage 相同
+type TaskBatchMessage struct {
+	ProtocolID int       `json:"protocol_id"`
+	Data       TaskBatch `json:"data"`
+	Timestamp  int64     `json:"timestamp"`
+	TTL        int64     `json:"ttl,omitempty"`
+	Signature  string    `json:"signature,omitempty"`
+}
+
+// TaskBatch 是批量任务广播的 data，复判端按数组顺序逐个处理
+type TaskBatch struct {
+	Tasks []InspectorResult `json:"tasks"`
+}
+
+// ReviewResult 是复判端回传的结果（protocol_id = 2）
+type ReviewResult struct {
+	ProtocolID int             `json:"protocol_id"`
+	Data       InspectorResult `json:"data"`
+	// 复判端原样带回的广播时间戳（Unix 毫秒）
+	Timestamp int64 `json:"timestamp"`
+}
+
+// InspectorResult 是任务的内容，随任务广播下发，复判端在结果中原样带回
+type InspectorResult struct {
+	Host    string `json:"host"`
+	Target  string `json:"target"`
+	Model   string `json:"model"`
+	Version string `json:"version"`
+	// 任务来源的检测端标识，复判端原样带回
+	Source string `json:"source"`
+	// 广播时分配的任务 id，复判端原样带回
+	TaskID string `json:"task_id"`
+}
+
+// EchoReply 是对 protocol_id=1 消息的回显（protocol_id = 2），data 为收到的 data 加上完成标记
+type EchoReply struct {
+	ProtocolID int `json:"protocol_id"`
+	// 请求消息的 id，未携带时省略
+	ID   interface{}            `json:"id,omitempty"`
+	Hops int64                  `json:"hops"`
+	Data map[string]interface{} `json:"data"`
+}
+
+// ErrorReply 是客户端消息被拒绝时的回复（protocol_id = protocolError）
+type ErrorReply struct {
+	ProtocolID int `json:"protocol_id"`
+	// 出错消息的 id，未携带时省略
+	ID   interface{} `json:"id,omitempty"`
+	Data ErrorData   `json:"data"`
+}
+
+// ErrorData 说明被拒绝的消息及原因
+type ErrorData struct {
+	ProtocolID int64  `json:"protocol_id"`
+	Error      string `json:"error"`
+}
+
+// decodeData 将信封中 data 的原始 JSON 解码为协议对应的结构
+func (e Envelope) decodeData(v interface{}) error {
+	return json.Unmarshal(e.RawData, v)
+}
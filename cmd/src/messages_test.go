@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// TestMessageRoundTrip 各协议的类型化消息编码后经 parseEnvelope 解析，再由 decodeData 解码回原值
+func TestMessageRoundTrip(t *testing.T) {
+	inspector := InspectorResult{Host: "10.0.0.7", Target: "/img/1.jpg", Model: "m1", Version: "v1", Source: "line-3", TaskID: "0123456789abcdef"}
+	for _, tc := range []struct {
+		name string
+		msg  any
+		// 解码目标，与 msg 类型相同的零值指针
+		decoded    any
+		protocolID int64
+	}{
+		{"task", &TaskMessage{ProtocolID: 1, Data: inspector, Timestamp: 1717200000000, TTL: 60000, Traceparent: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", Signature: "abc"}, new(TaskMessage), 1},
+		{"batch", &TaskBatchMessage{ProtocolID: 1, Data: TaskBatch{Tasks: []InspectorResult{inspector, inspector}}, Timestamp: 1717200000000, TTL: 60000}, new(TaskBatchMessage), 1},
+		{"result", &ReviewResult{ProtocolID: 2, Data: inspector, Timestamp: 1717200000000}, new(ReviewResult), 2},
+		{"echo", &EchoReply{ProtocolID: 2, ID: "req-1", Hops: 1, Data: map[string]any{"msg": "hello" + echoSuffix}}, new(EchoReply), 2},
+		{"error", &ErrorReply{ProtocolID: protocolError, ID: "req-2", Data: ErrorData{ProtocolID: 3, Error: "invalid subscription"}}, new(ErrorReply), protocolError},
+	} {
+		encoded, err := json.Marshal(tc.msg)
+		if err != nil {
+			t.Fatalf("%s: marshal: %v", tc.name, err)
+		}
+		env, err := parseEnvelope(encoded)
+		if err != nil {
+			t.Fatalf("%s: parse %s: %v", tc.name, encoded, err)
+		}
+		if env.ProtocolID != tc.protocolID {
+			t.Errorf("%s: protocol_id %d, want %d", tc.name, env.ProtocolID, tc.protocolID)
+		}
+		if err := json.Unmarshal(encoded, tc.decoded); err != nil {
+			t.Fatalf("%s: unmarshal: %v", tc.name, err)
+		}
+		if !reflect.DeepEqual(tc.decoded, tc.msg) {
+			t.Errorf("%s: round trip %+v, want %+v", tc.name, tc.decoded, tc.msg)
+		}
+	}
+
+	// decodeData 只解码 data 部分
+	encoded, _ := json.Marshal(ReviewResult{ProtocolID: 2, Data: inspector})
+	env, err := parseEnvelope(encoded)
+	if err != nil {
+		t.Fatalf("parse result: %v", err)
+	}
+	var data InspectorResult
+	if err := env.decodeData(&data); err != nil || data != inspector {
+		t.Errorf("decodeData = %+v, %v; want %+v", data, err, inspector)
+	}
+}
+
+// TestTaskMessageOmitEmpty 未设置的可选字段不出现在下发的任务中
+func TestTaskMessageOmitEmpty(t *testing.T) {
+	encoded, _ := json.Marshal(TaskMessage{ProtocolID: 1})
+	var fields map[string]json.RawMessage
+	json.Unmarshal(encoded, &fields)
+	for _, name := range []string{"ttl", "traceparent", "signature"} {
+		if _, ok := fields[name]; ok {
+			t.Errorf("empty %s encoded in %s", name, encoded)
+		}
+	}
+}
+
+// TestResultWrongTypes 结果中字段类型不符时回复错误，而不是交给结果处理
+func TestResultWrongTypes(t *testing.T) {
+	srv := startTestServer(t)
+	client := dialTestClient(t, srv, "")
+	waitClients(t, 1)
+	client.SendRaw(map[string]any{"protocol_id": 2, "id": "req-1", "data": map[string]any{"host": 7, "target": "/img/1.jpg"}})
+	if env := client.RecvProtocol(protocolError); env.ID != "req-1" || fmt.Sprint(env.Data["protocol_id"]) != "2" {
+		t.Errorf("error reply %+v, want one for the result", env)
+	}
+}
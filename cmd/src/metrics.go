@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+)
+
+// metricsHandler 以 Prometheus 文本格式输出 /stats 中的计数，
+// 按关闭码和 protocol_id 统计的次数分别带 code 和 protocol_id 标签
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	ip, port, err := splitRemoteAddr(r.RemoteAddr)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Cannot resolve client address")
+		return
+	}
+	logRequest(r, ip, port)
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	snap := stats.snapshot()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writeMetric(w, "wsserver_uptime_seconds", "gauge", "Seconds since the server started.", snap.UptimeSeconds)
+	writeMetric(w, "wsserver_connections_total", "counter", "WebSocket connections accepted.", snap.TotalConnections)
+	writeMetric(w, "wsserver_connections", "gauge", "WebSocket connections currently open.", snap.CurrentConnections)
+	writeMetric(w, "wsserver_broadcasts_total", "counter", "Broadcasts handled by the hub.", snap.TotalBroadcasts)
+	writeMetric(w, "wsserver_tasks_total", "counter", "Tasks received.", snap.TotalTasks)
+	writeMetric(w, "wsserver_dropped_messages_total", "counter", "Messages dropped before reaching a client.", snap.DroppedMessages)
+	writeMetric(w, "wsserver_dropped_results_total", "counter", "Review results dropped because the result queue was full.", snap.DroppedResults)
+	writeMetric(w, "wsserver_ping_failures_total", "counter", "Connections closed after a failed ping write.", snap.PingFailures)
+	writeMetric(w, "wsserver_bytes_sent_total", "counter", "Bytes written to WebSocket clients.", snap.BytesSent)
+	writeLabeled(w, "wsserver_close_codes_total", "Disconnects by WebSocket close code.", "code", snap.CloseCodes)
+	writeLabeled(w, "wsserver_protocol_messages_total", "Messages received by protocol_id.", "protocol_id", snap.ProtocolMessages)
+}
+
+// writeMetric 写出一个不带标签的指标
+func writeMetric(w io.Writer, name, kind, help string, value interface{}) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, kind, name, value)
+}
+
+// writeLabeled 写出一个按 label 区分的计数器，标签值按字典序排列
+func writeLabeled(w io.Writer, name, help, label string, values map[string]int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", name, label, key, values[key])
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// parseMigrateTarget 校验迁移的目标地址，必须是带主机名的 ws:// 或 wss:// 地址
+func parseMigrateTarget(target string) (string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", fmt.Errorf("invalid target url: %v", err)
+	}
+	if (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" {
+		return "", fmt.Errorf("target must be a ws:// or wss:// url")
+	}
+	return u.String(), nil
+}
+
+// errMigrateUndelivered 表示重定向消息未能放入发送缓冲，客户端已作为慢客户端被移除
+var errMigrateUndelivered = errors.New("send buffer full, client dropped without the redirect")
+
+// migrate 向指定 id 的客户端下发重定向消息（protocol_id = protocolRedirect），随后将其移除，
+// writePump 写出重定向后以 1001 关闭连接。客户端不在线时返回 errClientNotFound，
+// 重定向未能放入发送缓冲时返回 errMigrateUndelivered，Hub 已停止时返回 errHubStopped
+func (h *Hub) migrate(id string, message []byte) error {
+	shard := h.shardFor(id)
+	err := errHubStopped
+	shard.query(func() {
+		err = errClientNotFound
+		for client := range shard.clients {
+			if client.id != id {
+				continue
+			}
+			if !shard.deliver(client, outMessage{data: message, priority: priorityHigh}) {
+				err = errMigrateUndelivered
+				return
+			}
+			client.migrated = true
+			shard.removeClient(client)
+			err = nil
+			return
+		}
+	})
+	return err
+}
+
+// migrateHandler 处理 POST /migrate?client=<id>&to=<url>，要求指定客户端改连到另一个地址，
+// 用于缩容或重新分配客户端
+func migrateHandler(w http.ResponseWriter, r *http.Request) {
+	ip, port, err := splitRemoteAddr(r.RemoteAddr)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Cannot resolve client address")
+		return
+	}
+	logRequest(r, ip, port)
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	id := r.URL.Query().Get("client")
+	if id == "" {
+		writeError(w, http.StatusBadRequest, "Missing client parameter")
+		return
+	}
+	target, err := parseMigrateTarget(r.URL.Query().Get("to"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	message, err := json.Marshal(map[string]interface{}{
+		"protocol_id": protocolRedirect,
+		"data":        map[string]string{"url": target},
+		"timestamp":   time.Now().UnixMilli(),
+	})
+	if err != nil {
+		errorf("JSON marshaling error: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+	switch err := hub.migrate(id, message); {
+	case errors.Is(err, errClientNotFound):
+		writeError(w, http.StatusNotFound, "Client not connected")
+		return
+	case err != nil:
+		warnf("Client %s not migrated: %v", id, err)
+		writeError(w, http.StatusServiceUnavailable, "Client not migrated: "+err.Error())
+		return
+	}
+	infof("Client %s migrated to %s", id, target)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "client": id, "to": target})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestMigrate /migrate 下发重定向后以 1001 关闭连接，客户端期间持续发送也不会 panic
+func TestMigrate(t *testing.T) {
+	srv := startTestServer(t)
+	client := dialTestClient(t, srv, "client_id=reviewer-1")
+	waitClients(t, 1)
+	client.RecvProtocol(protocolSession)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if err := client.conn.WriteJSON(map[string]any{"protocol_id": 1, "data": map[string]any{"msg": "spam"}}); err != nil {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	status, body := adminRequest(t, srv, http.MethodPost, "/migrate?client=reviewer-1&to=ws://other:8080/ws")
+	if status != http.StatusOK {
+		t.Fatalf("migrate: status %d: %s", status, body)
+	}
+	redirect := client.RecvProtocol(protocolRedirect)
+	if redirect.Data["url"] != "ws://other:8080/ws" {
+		t.Fatalf("unexpected redirect %+v", redirect.Data)
+	}
+	client.conn.SetReadDeadline(time.Now().Add(testRecvTimeout))
+	var err error
+	for err == nil {
+		_, _, err = client.conn.ReadMessage()
+	}
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseGoingAway {
+		t.Fatalf("connection closed with %v, want close code %d", err, websocket.CloseGoingAway)
+	}
+	waitClients(t, 0)
+	<-done
+
+	if status, _ := adminRequest(t, srv, http.MethodPost, "/migrate?client=reviewer-1&to=ws://other:8080/ws"); status != http.StatusNotFound {
+		t.Fatalf("migrate of a gone client: status %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+// TestMigrateUndelivered 重定向放不进发送缓冲时客户端被移除，/migrate 返回 503 而不是 404；Hub 停止后同样返回 503
+func TestMigrateUndelivered(t *testing.T) {
+	srv := startTestServer(t)
+	slow := fakeClient("slow")
+	hub.join(slow)
+	waitClients(t, 1)
+	slow.sendHigh <- outMessage{data: []byte(`{}`)}
+
+	status, body := adminRequest(t, srv, http.MethodPost, "/migrate?client=slow&to=ws://other:8080/ws")
+	if status != http.StatusServiceUnavailable {
+		t.Fatalf("migrate with a full buffer: status %d: %s, want %d", status, body, http.StatusServiceUnavailable)
+	}
+	waitClients(t, 0)
+
+	hub.stop()
+	<-hub.stopped
+	if status, _ := adminRequest(t, srv, http.MethodPost, "/migrate?client=slow&to=ws://other:8080/ws"); status != http.StatusServiceUnavailable {
+		t.Fatalf("migrate after stop: status %d, want %d", status, http.StatusServiceUnavailable)
+	}
+}
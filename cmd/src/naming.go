@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+)
+
+// 信封字段的命名风格
+const (
+	// protocol_id，默认风格
+	namingSnake = "snake"
+	// protocolId，供习惯驼峰命名的客户端使用
+	namingCamel = "camel"
+)
+
+// 信封中唯一随命名风格变化的字段
+const (
+	protocolIDSnake = "protocol_id"
+	protocolIDCamel = "protocolId"
+)
+
+// 下发消息默认使用的命名风格，由 -envelope-naming 配置；客户端可在连接时通过 naming 参数单独指定。
+// 收到的消息总是两种写法都接受
+var envelopeNaming = namingSnake
+
+// parseNaming 校验命名风格
+func parseNaming(naming string) (string, error) {
+	switch naming {
+	case namingSnake, namingCamel:
+		return naming, nil
+	}
+	return "", fmt.Errorf("unknown envelope naming %q, expected %s or %s", naming, namingSnake, namingCamel)
+}
+
+// clientNaming 返回连接协商的命名风格，未携带 naming 参数时采用 envelopeNaming
+func clientNaming(r *http.Request) (string, error) {
+	naming := r.URL.Query().Get("naming")
+	if naming == "" {
+		return envelopeNaming, nil
+	}
+	return parseNaming(naming)
+}
+
+// renameTopLevelKey 将 JSON 对象顶层的 from 字段改名为 to，其余内容不变。
+// 不是对象或没有该字段时原样返回
+func renameTopLevelKey(message []byte, from, to string) []byte {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(message, &fields); err != nil || fields == nil {
+		return message
+	}
+	value, ok := fields[from]
+	if !ok {
+		return message
+	}
+	delete(fields, from)
+	fields[to] = value
+	renamed, err := json.Marshal(fields)
+	if err != nil {
+		return message
+	}
+	return renamed
+}
+
+// normalizeEnvelope 将驼峰写法的信封转为 protocol_id 写法，供按 snake 风格解码的结果处理使用
+func normalizeEnvelope(message []byte) []byte {
+	return renameTopLevelKey(message, protocolIDCamel, protocolIDSnake)
+}
+
+// encode 按客户端协商的命名风格改写下发的文本消息，二进制消息原样返回
+func (c *Client) encode(m outMessage) outMessage {
+	if c.naming != namingCamel || m.frameType() != websocket.TextMessage {
+		return m
+	}
+	m.data = renameTopLevelKey(m.data, protocolIDSnake, protocolIDCamel)
+	return m
+}
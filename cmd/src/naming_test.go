@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// recvKeys 返回下一条 protocol_id（任一写法）为 protocolID 的消息的顶层字段
+func recvKeys(t *testing.T, client *testClient, protocolID int) map[string]json.RawMessage {
+	t.Helper()
+	for {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(client.RecvRaw(), &fields); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		id := fields[protocolIDSnake]
+		if id == nil {
+			id = fields[protocolIDCamel]
+		}
+		if string(id) == fmt.Sprint(protocolID) {
+			return fields
+		}
+	}
+}
+
+// TestEnvelopeNaming 每个连接按协商的命名风格收到回显和广播，发送时两种写法都被接受；
+// 默认风格由 -envelope-naming 决定，未知的风格返回 400
+func TestEnvelopeNaming(t *testing.T) {
+	t.Cleanup(func() { envelopeNaming = namingSnake })
+	srv := startTestServer(t)
+	snake := dialTestClient(t, srv, "")
+	camel := dialTestClient(t, srv, "naming=camel")
+	envelopeNaming = namingCamel
+	defaultCamel := dialTestClient(t, srv, "")
+	waitClients(t, 3)
+
+	for client, key := range map[*testClient]string{snake: protocolIDSnake, camel: protocolIDCamel, defaultCamel: protocolIDCamel} {
+		client.SendRaw(map[string]any{key: 1, "data": map[string]any{"msg": "hi"}})
+		if fields := recvKeys(t, client, 2); fields[key] == nil || len(fields[protocolIDSnake])+len(fields[protocolIDCamel]) != 1 {
+			t.Errorf("echo %v, want only %s", fields, key)
+		}
+	}
+	postTask(t, srv, "m1")
+	for client, key := range map[*testClient]string{snake: protocolIDSnake, camel: protocolIDCamel, defaultCamel: protocolIDCamel} {
+		if fields := recvKeys(t, client, 1); fields[key] == nil {
+			t.Errorf("task %v, want %s", fields, key)
+		}
+	}
+
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws?naming=kebab", nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("naming=kebab: %v, want 400", err)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATS 订阅的默认参数
+const (
+	defaultNATSSubject = "review.tasks"
+	natsDialTimeout    = 5 * time.Second
+	// 断线重连的等待时间，每次失败翻倍直到上限
+	natsReconnectMin = time.Second
+	natsReconnectMax = 30 * time.Second
+)
+
+// 从 NATS 读取任务的配置，natsURL 为空时不订阅，服务只通过 HTTP 接收任务
+var (
+	natsURL     string
+	natsSubject = defaultNATSSubject
+	// 非空时以队列组订阅，多个服务实例分摊同一主题的任务，每个任务只由一个实例广播
+	natsQueue string
+)
+
+// parseNATSURL 校验 NATS 地址，缺省端口为 4222
+func parseNATSURL(rawURL string) (*url.URL, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "nats" || u.Host == "" {
+		return nil, "", fmt.Errorf("invalid NATS URL %q, expected nats://host:port", rawURL)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	return u, host, nil
+}
+
+// validNATSSubject 判断主题或队列组名是否非空且不含空白字符
+func validNATSSubject(subject string) bool {
+	return subject != "" && !strings.ContainsAny(subject, " \t\r\n")
+}
+
+// natsReconnectDelay 返回第 attempts 次重连前的等待时间，从 natsReconnectMin 开始翻倍直到 natsReconnectMax
+func natsReconnectDelay(attempts int) time.Duration {
+	wait := natsReconnectMin
+	for i := 1; i < attempts && wait < natsReconnectMax; i++ {
+		wait *= 2
+	}
+	return min(wait, natsReconnectMax)
+}
+
+// connectNATS 连接 nats://[user:pass@]host:port，URL 中只有用户名时将其作为 token。
+// 首次连接失败和之后的断线都在后台按 natsReconnectDelay 无限重连，期间发布的消息由客户端缓冲，
+// 订阅在重连后自动恢复，因此只有配置错误时返回错误
+func connectNATS(rawURL string) (*nats.Conn, error) {
+	return nats.Connect(rawURL,
+		nats.Name("review-server"),
+		nats.Timeout(natsDialTimeout),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.CustomReconnectDelay(natsReconnectDelay),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				errorf("NATS disconnected: %v", err)
+			}
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			infof("NATS reconnected to %s", nc.ConnectedUrl())
+		}),
+		nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
+			errorf("NATS error: %v", err)
+		}),
+	)
+}
+
+// runNATS 连接 NATS 并订阅任务主题，stop 关闭后退出。排空期间取消订阅，
+// 任务留给队列组中的其他实例，退出排空后重新订阅
+func runNATS(rawURL, subject, queue string, stop <-chan struct{}) {
+	nc, err := connectNATS(rawURL)
+	if err != nil {
+		errorf("NATS connection error: %v", err)
+		return
+	}
+	defer nc.Close()
+	handle := func(msg *nats.Msg) { handleBrokerTask(msg.Data) }
+	var sub *nats.Subscription
+	for {
+		// 先取得通道再读取状态，读取之后的变化也会唤醒等待
+		changed := drainChanged()
+		switch {
+		case draining.Load() && sub != nil:
+			if err := sub.Unsubscribe(); err != nil {
+				errorf("NATS unsubscribe error: %v", err)
+			}
+			sub = nil
+			infof("Unsubscribed from NATS subject %s while draining", subject)
+		case !draining.Load() && sub == nil:
+			if queue != "" {
+				sub, err = nc.QueueSubscribe(subject, queue, handle)
+			} else {
+				sub, err = nc.Subscribe(subject, handle)
+			}
+			if err != nil {
+				errorf("NATS subscribe error: %v", err)
+				sub = nil
+			} else {
+				infof("Subscribed to NATS subject %s", subject)
+			}
+		}
+		select {
+		case <-stop:
+			return
+		case <-changed:
+		}
+	}
+}
+
+// 等待发布到 NATS 的复判结果数，超出后丢弃新的结果
+const resultPublishQueue = 256
+
+// 复判结果发布的主题，由 -result-subject 配置，为空时不发布
+var resultSubject string
+
+// 等待发布的复判结果，为 nil 时不发布
+var resultPublishes chan []byte
+
+// publishResult 将复判结果交给发布 goroutine，队列已满时丢弃并记录日志，不阻塞结果处理
+func publishResult(message []byte) {
+	if resultPublishes == nil {
+		return
+	}
+	select {
+	case resultPublishes <- message:
+	default:
+		stats.droppedPublishes.Add(1)
+		errorf("Result not published to NATS, publish queue full: %s", logPayload(message))
+	}
+}
+
+// startResultPublisher 创建发布队列并在后台保持发布连接，stop 关闭后退出
+func startResultPublisher(rawURL, subject string, stop <-chan struct{}) {
+	resultPublishes = make(chan []byte, resultPublishQueue)
+	go runNATSPublisher(rawURL, subject, resultPublishes, stop)
+}
+
+// runNATSPublisher 将队列中的结果逐条发布到主题。断线期间的结果由客户端缓冲，重连后发出，
+// 缓冲也已满时丢弃并计数。stop 关闭后尽量发出已缓冲的结果再退出
+func runNATSPublisher(rawURL, subject string, queue <-chan []byte, stop <-chan struct{}) {
+	nc, err := connectNATS(rawURL)
+	if err != nil {
+		errorf("NATS connection error: %v", err)
+		return
+	}
+	defer nc.Close()
+	infof("Publishing review results to NATS subject %s", subject)
+	for {
+		select {
+		case <-stop:
+			if err := nc.FlushTimeout(writeWait); err != nil {
+				warnf("NATS flush on shutdown: %v", err)
+			}
+			return
+		case message := <-queue:
+			if err := nc.Publish(subject, message); err != nil {
+				stats.droppedPublishes.Add(1)
+				errorf("Result not published to NATS: %v: %s", err, logPayload(message))
+			}
+		}
+	}
+}
+
+// brokerTask 是从消息队列收到的任务，字段与 /tasks 的查询参数一致。
+// 没有 HTTP 请求可以取得检测端地址，因此 host 必须由消息给出
+type brokerTask struct {
+	Host        string `json:"host"`
+	Address     string `json:"address"`
+	Model       string `json:"model"`
+	Version     string `json:"version"`
+	InspectorID string `json:"inspector_id"`
+	// 可选的有效期（毫秒），含义与 /tasks 的 ttl 参数相同
+	TTL int64 `json:"ttl"`
+}
+
+// handleBrokerTask 校验一条来自消息队列的任务，并以与 /tasks 相同的信封格式广播。
+// 不合法的任务记录日志后丢弃
+func handleBrokerTask(payload []byte) {
+	var task brokerTask
+	if err := json.Unmarshal(payload, &task); err != nil {
+		warnf("Reject broker task: %v", err)
+		return
+	}
+	if task.Host == "" || task.Address == "" {
+		warnf("Reject broker task: host and address are required")
+		return
+	}
+	if task.TTL < 0 {
+		warnf("Reject broker task: ttl must not be negative")
+		return
+	}
+	if err := validateTask(map[string]string{
+		"address": task.Address,
+		"model":   task.Model,
+		"version": task.Version,
+	}); err != nil {
+		warnf("Reject broker task from %s: %v", task.Host, err)
+		return
+	}
+	source := task.Host
+	if task.InspectorID != "" {
+		if !clientIDPattern.MatchString(task.InspectorID) {
+			warnf("Reject broker task from %s: invalid inspector_id", task.Host)
+			return
+		}
+		source = task.InspectorID
+	}
+	if !hubReady() {
+		warnf("Reject broker task from %s: server is not ready", task.Host)
+		return
+	}
+	// 取消订阅前已投递的任务同样拒绝，与排空期间的 /tasks 一致
+	if draining.Load() {
+		warnf("Reject broker task from %s: server is draining", task.Host)
+		return
+	}
+
+	relativeAddress := strings.TrimPrefix(task.Address, resultPrefix)
+	infof("////////Review_1:Received_from_broker////////%s%s", task.Host, relativeAddress)
+	stats.totalTasks.Add(1)
+	taskID := newTaskID()
+	message := TaskMessage{
+		ProtocolID: 1,
+		Data: InspectorResult{
+			TaskID:  taskID,
+			Host:    task.Host,
+			Target:  relativeAddress,
+			Model:   task.Model,
+			Version: task.Version,
+			Source:  source,
+		},
+		Timestamp: time.Now().UnixMilli(),
+		TTL:       task.TTL,
+	}
+	jsonMsg, err := encodeSigned(message)
+	if err != nil {
+		errorf("JSON marshaling error: %v", err)
+		return
+	}
+	tasks.add(taskID, time.Now())
+	if _, err := hub.submit(jsonMsg, priorityNormal); err != nil {
+		tasks.remove(taskID)
+		warnf("Broker task %s not broadcast: %v", taskID, err)
+	}
+}
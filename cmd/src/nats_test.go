@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// mockNATS 是只说 NATS 文本协议的测试服务端，每个连接先收到 INFO
+type mockNATS struct {
+	ln    net.Listener
+	conns chan *mockNATSConn
+}
+
+// mockNATSConn 是 mockNATS 接受的一个连接
+type mockNATSConn struct {
+	t    testing.TB
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// startMockNATS 在本地端口启动 mockNATS，测试结束时关闭监听
+func startMockNATS(t testing.TB) *mockNATS {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	m := &mockNATS{ln: ln, conns: make(chan *mockNATSConn, 4)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte(`INFO {"server_id":"mock","max_payload":1048576}` + "\r\n"))
+			m.conns <- &mockNATSConn{t: t, conn: conn, r: bufio.NewReader(conn)}
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return m
+}
+
+// url 返回 mockNATS 的 nats:// 地址
+func (m *mockNATS) url() string {
+	return "nats://" + m.ln.Addr().String()
+}
+
+// accept 等待下一个连接，连接在测试结束时关闭
+func (m *mockNATS) accept(t testing.TB) *mockNATSConn {
+	t.Helper()
+	select {
+	case c := <-m.conns:
+		t.Cleanup(func() { c.conn.Close() })
+		return c
+	case <-time.After(testRecvTimeout):
+		t.Fatal("no connection to the mock NATS server")
+		return nil
+	}
+}
+
+// readLine 读取客户端发来的下一行，不含行尾的 \r\n
+func (c *mockNATSConn) readLine() string {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(testRecvTimeout))
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatalf("mock NATS read: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n")
+}
+
+// handshake 读取客户端的 CONNECT 和随后的 PING 并回复 PONG，完成连接握手
+func (c *mockNATSConn) handshake() {
+	c.t.Helper()
+	if line := c.readLine(); !strings.HasPrefix(line, "CONNECT {") {
+		c.t.Fatalf("first line %q, want CONNECT", line)
+	}
+	if line := c.readLine(); line != "PING" {
+		c.t.Fatalf("line after CONNECT %q, want PING", line)
+	}
+	c.conn.Write([]byte("PONG\r\n"))
+}
+
+// deliver 向客户端投递一条 subject 主题的消息
+func (c *mockNATSConn) deliver(subject, payload string) {
+	c.t.Helper()
+	if _, err := fmt.Fprintf(c.conn, "MSG %s 1 %d\r\n%s\r\n", subject, len(payload), payload); err != nil {
+		c.t.Fatalf("mock NATS write: %v", err)
+	}
+}
+
+// runTestNATS 在后台运行 run，测试结束时通知其停止并等待退出
+func runTestNATS(t testing.TB, run func(stop <-chan struct{})) {
+	stop := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		run(stop)
+	}()
+	t.Cleanup(func() {
+		close(stop)
+		<-exited
+	})
+}
+
+// TestNATSTasks 订阅队列组后，来自 NATS 的任务以与 /tasks 相同的格式广播给客户端，不合法的任务被丢弃
+func TestNATSTasks(t *testing.T) {
+	broker := startMockNATS(t)
+	srv := startTestServer(t)
+	client := dialTestClient(t, srv, "")
+	waitClients(t, 1)
+	runTestNATS(t, func(stop <-chan struct{}) { runNATS(broker.url(), "review.tasks", "servers", stop) })
+
+	conn := broker.accept(t)
+	conn.handshake()
+	if line := conn.readLine(); line != "SUB review.tasks servers 1" {
+		t.Fatalf("subscription %q, want the subject in queue group servers", line)
+	}
+	conn.conn.Write([]byte("PING\r\n"))
+	if line := conn.readLine(); line != "PONG" {
+		t.Fatalf("reply to PING %q, want PONG", line)
+	}
+
+	conn.deliver("review.tasks", `{"address":"/img/0.jpg","model":"m0","version":"v1"}`)
+	conn.deliver("review.tasks", `{"host":"10.0.0.7","address":"/home/aoi/aoi/img/1.jpg","model":"m1","version":"v1","inspector_id":"line-3","ttl":60000}`)
+	var task InspectorResult
+	env := client.RecvProtocol(1)
+	if err := env.decodeData(&task); err != nil {
+		t.Fatalf("decode task: %v", err)
+	}
+	if task.Host != "10.0.0.7" || task.Target != "/img/1.jpg" || task.Model != "m1" || task.Source != "line-3" || task.TaskID == "" {
+		t.Fatalf("broadcast %+v, want the broker task without the missing-host one", task)
+	}
+	if _, ok := tasks.get(task.TaskID); !ok {
+		t.Errorf("task %s not registered for /results", task.TaskID)
+	}
+}
+
+// TestNATSDrain 排空时取消任务订阅，退出排空后重新订阅；取消前已投递的任务不再广播
+func TestNATSDrain(t *testing.T) {
+	broker := startMockNATS(t)
+	srv := startTestServer(t)
+	dialTestClient(t, srv, "")
+	waitClients(t, 1)
+	t.Cleanup(func() { setDrainState(false) })
+	runTestNATS(t, func(stop <-chan struct{}) { runNATS(broker.url(), "review.tasks", "servers", stop) })
+
+	conn := broker.accept(t)
+	conn.handshake()
+	if line := conn.readLine(); line != "SUB review.tasks servers 1" {
+		t.Fatalf("subscription %q, want the subject in queue group servers", line)
+	}
+	setDrainState(true)
+	if line := conn.readLine(); strings.TrimSpace(line) != "UNSUB 1" {
+		t.Fatalf("on drain %q, want UNSUB 1", line)
+	}
+	before := stats.totalTasks.Load()
+	handleBrokerTask([]byte(`{"host":"10.0.0.7","address":"/img/1.jpg","model":"m1","version":"v1"}`))
+	if n := stats.totalTasks.Load(); n != before {
+		t.Errorf("broker task accepted while draining")
+	}
+	setDrainState(false)
+	if line := conn.readLine(); line != "SUB review.tasks servers 2" {
+		t.Fatalf("on undrain %q, want a new subscription", line)
+	}
+}
+
+// TestNATSReconnectDelay 重连等待从 natsReconnectMin 开始翻倍，不超过 natsReconnectMax
+func TestNATSReconnectDelay(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{1: natsReconnectMin, 2: 2 * natsReconnectMin, 3: 4 * natsReconnectMin, 100: natsReconnectMax} {
+		if got := natsReconnectDelay(attempts); got != want {
+			t.Errorf("natsReconnectDelay(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+// TestParseNATSURL 只接受 nats:// 地址，缺省端口为 4222
+func TestParseNATSURL(t *testing.T) {
+	if _, host, err := parseNATSURL("nats://broker"); err != nil || host != "broker:4222" {
+		t.Errorf("nats://broker: host %q, %v", host, err)
+	}
+	if _, host, err := parseNATSURL("nats://token@broker:5222"); err != nil || host != "broker:5222" {
+		t.Errorf("nats://token@broker:5222: host %q, %v", host, err)
+	}
+	for _, bad := range []string{"", "tcp://broker:4222", "nats://"} {
+		if _, _, err := parseNATSURL(bad); err == nil {
+			t.Errorf("parseNATSURL(%q) accepted", bad)
+		}
+	}
+}
+
+// TestNATSResults 收到的复判结果原样发布到结果主题；发布队列已满时结果被丢弃并计数
+func TestNATSResults(t *testing.T) {
+	broker := startMockNATS(t)
+	queue := make(chan []byte, resultPublishQueue)
+	resultPublishes = queue
+	t.Cleanup(func() { resultPublishes = nil })
+	srv := startTestServer(t)
+	client := dialTestClient(t, srv, "")
+	waitClients(t, 1)
+	runTestNATS(t, func(stop <-chan struct{}) { runNATSPublisher(broker.url(), "review.results", queue, stop) })
+
+	conn := broker.accept(t)
+	conn.handshake()
+	result := `{"protocol_id":2,"data":{"host":"10.0.0.7","target":"/img/1.jpg","model":"m1","version":"v1"}}`
+	if err := client.conn.WriteMessage(websocket.TextMessage, []byte(result)); err != nil {
+		t.Fatalf("send result: %v", err)
+	}
+	if line := conn.readLine(); line != fmt.Sprintf("PUB review.results %d", len(result)) {
+		t.Fatalf("publish header %q, want the result size", line)
+	}
+	if payload := conn.readLine(); payload != result {
+		t.Fatalf("published %s, want the result as received", payload)
+	}
+
+	// 没有发布 goroutine 取走时队列很快占满，之后的结果被丢弃而不阻塞
+	resultPublishes = make(chan []byte)
+	dropped := stats.droppedPublishes.Load()
+	publishResult([]byte(result))
+	if got := stats.droppedPublishes.Load(); got != dropped+1 {
+		t.Errorf("dropped publishes %d, want %d", got, dropped+1)
+	}
+}
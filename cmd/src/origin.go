@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// originPattern 是 -allowed-origins 中的一项，启动时编译为正则表达式
+type originPattern struct {
+	raw string
+	re  *regexp.Regexp
+	// 为 true 时与完整的 Origin（含 scheme）匹配，否则只与其中的主机名和端口匹配
+	full bool
+}
+
+// originMatcher 是允许的来源名单，为 nil 时允许所有来源
+type originMatcher struct {
+	patterns []originPattern
+}
+
+// parseOriginPatterns 解析逗号分隔的来源名单，每一项可以是：
+//
+//	example.com                 精确匹配主机名
+//	*.example.com               通配符，* 匹配不含 / 的任意字符
+//	https://*.example.com:8443  带 scheme 时与完整的 Origin 匹配
+//	re:^review-\d+\.local$      以 re: 开头的正则表达式，需要完整匹配
+//
+// 匹配不区分大小写，列表为空时返回 nil
+func parseOriginPatterns(list string) (*originMatcher, error) {
+	var m originMatcher
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		var expr string
+		if rest, ok := strings.CutPrefix(item, "re:"); ok {
+			if rest == "" {
+				return nil, fmt.Errorf("empty regular expression in origin pattern %q", item)
+			}
+			expr = rest
+		} else {
+			expr = strings.ReplaceAll(regexp.QuoteMeta(item), `\*`, `[^/]*`)
+		}
+		re, err := regexp.Compile(`(?i)^(?:` + expr + `)$`)
+		if err != nil {
+			return nil, fmt.Errorf("invalid origin pattern %q: %v", item, err)
+		}
+		m.patterns = append(m.patterns, originPattern{raw: item, re: re, full: strings.Contains(item, "://")})
+	}
+	if len(m.patterns) == 0 {
+		return nil, nil
+	}
+	return &m, nil
+}
+
+// allow 判断 Origin 是否在名单中
+func (m *originMatcher) allow(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	for _, p := range m.patterns {
+		target := u.Host
+		if p.full {
+			target = origin
+		}
+		if p.re.MatchString(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkOrigin 是 upgrader 的来源检查，名单由 -allowed-origins 配置，可通过 /reload 或 SIGHUP 重新加载。
+// 未配置名单时允许所有来源；没有 Origin 头的请求来自非浏览器客户端，总是允许
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	allowedOrigins := currentAccess().origins
+	if allowedOrigins == nil || origin == "" {
+		return true
+	}
+	if allowedOrigins.allow(origin) {
+		return true
+	}
+	warnf("Reject connection from %s: origin %q not allowed", r.RemoteAddr, origin)
+	return false
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestOriginPatterns 覆盖精确、通配符、带 scheme 和正则表达式的来源匹配，以及不合法的名单
+func TestOriginPatterns(t *testing.T) {
+	m, err := parseOriginPatterns(`review.local, *.example.com, https://*.secure.com:8443, re:^station-\d+\.lan$`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	for origin, want := range map[string]bool{
+		"http://review.local":           true,
+		"http://REVIEW.local":           true,
+		"http://other.local":            false,
+		"https://a.example.com":         true,
+		"https://a.b.example.com":       true,
+		"https://example.com":           false,
+		"https://evil-example.com":      false,
+		"https://a.example.com.evil.io": false,
+		"https://x.secure.com:8443":     true,
+		"http://x.secure.com:8443":      false,
+		"http://station-12.lan":         true,
+		"http://station-x.lan":          false,
+		"not a url":                     false,
+	} {
+		if got := m.allow(origin); got != want {
+			t.Errorf("allow(%q) = %v, want %v", origin, got, want)
+		}
+	}
+
+	for _, list := range []string{"re:", "re:(unclosed", "re:[a-"} {
+		if _, err := parseOriginPatterns(list); err == nil {
+			t.Errorf("parseOriginPatterns(%q) accepted", list)
+		}
+	}
+	if m, err := parseOriginPatterns(" , "); m != nil || err != nil {
+		t.Errorf("empty list: %v, %v; want nil, nil", m, err)
+	}
+}
+
+// TestCheckOrigin 配置了来源名单时不匹配的 Origin 升级失败，匹配的和没有 Origin 的请求照常升级
+func TestCheckOrigin(t *testing.T) {
+	prev := access.Load()
+	t.Cleanup(func() { access.Store(prev) })
+	origins, err := parseOriginPatterns("*.example.com")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	access.Store(&accessControl{origins: origins})
+	srv := startTestServer(t)
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+
+	for origin, want := range map[string]int{
+		"https://a.example.com": http.StatusSwitchingProtocols,
+		"https://evil.com":      http.StatusForbidden,
+		"":                      http.StatusSwitchingProtocols,
+	} {
+		header := http.Header{}
+		if origin != "" {
+			header.Set("Origin", origin)
+		}
+		conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+		if err == nil {
+			conn.Close()
+		}
+		if resp == nil || resp.StatusCode != want {
+			t.Errorf("origin %q: response %v, err %v; want status %d", origin, resp, err, want)
+		}
+	}
+}
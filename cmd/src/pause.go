@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// 暂停广播期间任务的处理方式
+const (
+	// 广播保留在暂停队列中，恢复后再分发
+	pauseBuffer = "buffer"
+	// /tasks 直接返回 503
+	pauseReject = "reject"
+)
+
+// 暂停期间的处理方式，由 -pause-mode 配置
+var pauseMode = pauseBuffer
+
+// 暂停队列长度的默认值
+const defaultPauseQueue = 256
+
+// 暂停期间最多缓冲的广播条数，由 -pause-queue 配置。与重放缓冲分开，不会被之后的广播挤掉；
+// 队列已满时提交方收到 errPauseQueueFull，/tasks 等接口返回 503，而不是接受后再丢弃
+var pauseQueueSize = defaultPauseQueue
+
+var errPauseQueueFull = errors.New("broadcasting is paused and the pause queue is full")
+
+// parsePauseMode 校验 -pause-mode 的取值
+func parsePauseMode(mode string) (string, error) {
+	switch mode {
+	case pauseBuffer, pauseReject:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown pause mode %q, expected %s or %s", mode, pauseBuffer, pauseReject)
+}
+
+// rejectIfPaused 在 reject 模式下暂停期间返回 503，返回 true 表示请求已被拒绝
+func rejectIfPaused(w http.ResponseWriter) bool {
+	if pauseMode != pauseReject || !hub.paused.Load() {
+		return false
+	}
+	w.Header().Set("Retry-After", "30")
+	writeError(w, http.StatusServiceUnavailable, "Broadcasting is paused")
+	return true
+}
+
+// bufferPaused 将暂停期间的广播放入暂停队列，队列已满时返回 errPauseQueueFull，只能在 run() 中调用。
+// 队列中的广播在恢复分发时才分配序号并写入重放缓冲，暂停期间续传的客户端不会经补发提前收到
+func (h *Hub) bufferPaused(e replayEntry) error {
+	if len(h.pauseQueue) >= pauseQueueSize {
+		warnf("Broadcast rejected, broadcasting is paused and the pause queue is full (%d)", pauseQueueSize)
+		return errPauseQueueFull
+	}
+	stats.totalBroadcasts.Add(1)
+	h.pauseQueue = append(h.pauseQueue, e)
+	infof("Broadcast buffered, broadcasting is paused, %d queued", len(h.pauseQueue))
+	return nil
+}
+
+// setPaused 暂停或恢复任务广播。恢复时将暂停队列中的广播按顺序记录并分发给订阅和连接时长匹配的客户端，
+// 返回恢复时分发的广播条数，暂停期间已过期的广播不计入。
+// 恢复时没有在线客户端的广播与 handleBroadcast 一样放入无客户端队列，留给之后连接的客户端；
+// 这些广播已被接受，即使队列因此超出 orphanQueueSize 也不丢弃，之后的新广播在队列回落前被拒绝。
+// 分片时每条广播由各分片并行投递
+func (h *Hub) setPaused(paused bool) int {
+	flushed := 0
+	h.query(func() {
+		h.paused.Store(paused)
+		if paused || len(h.pauseQueue) == 0 {
+			return
+		}
+		entries := h.pauseQueue
+		h.pauseQueue = nil
+		for _, e := range entries {
+			// 保留提交时的 sentAt 和 ttl，暂停期间已过期的广播不再分发
+			now := time.Now()
+			if e.outMessage().expired(now) {
+				infof("Buffered broadcast expired while paused, dropped")
+				continue
+			}
+			h.mu.Lock()
+			if h.registered == 0 {
+				if !bufferWhenEmpty {
+					h.mu.Unlock()
+					infof("Buffered broadcast skipped on resume, no clients connected")
+					continue
+				}
+				e = h.record(e)
+				h.orphans = append(h.orphans, e)
+				h.mu.Unlock()
+				infof("Buffered broadcast seq %d moved to the orphan queue on resume, no clients connected", e.seq)
+				flushed++
+				continue
+			}
+			e = h.record(e)
+			h.mu.Unlock()
+			out := e.outMessage()
+			deadline := now.Add(clientSendTimeout)
+			h.fanOut(func(member *Hub) int {
+				for _, client := range member.order {
+					// 与 handleBroadcast 相同，记录之后才注册的客户端已在注册时经补发收到
+					if client.joinedSeq < e.seq && e.meta.accepts(client, now) {
+						member.deliverBy(client, out, deadline)
+					}
+				}
+				return 0
+			})
+			flushed++
+		}
+	})
+	return flushed
+}
+
+// pauseHandler 暂停任务广播，客户端保持连接；公告等高优先级消息不受影响
+func pauseHandler(w http.ResponseWriter, r *http.Request) {
+	ip, port, err := splitRemoteAddr(r.RemoteAddr)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Cannot resolve client address")
+		return
+	}
+	logRequest(r, ip, port)
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	hub.setPaused(true)
+	warnf("Broadcasting paused, mode: %s", pauseMode)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "paused": true})
+}
+
+// resumeHandler 恢复任务广播，并分发暂停期间缓冲的广播
+func resumeHandler(w http.ResponseWriter, r *http.Request) {
+	ip, port, err := splitRemoteAddr(r.RemoteAddr)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Cannot resolve client address")
+		return
+	}
+	logRequest(r, ip, port)
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	flushed := hub.setPaused(false)
+	infof("Broadcasting resumed, %d buffered broadcasts delivered", flushed)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "paused": false, "flushed": flushed})
+}
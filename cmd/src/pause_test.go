@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestPauseResume 暂停期间任务进入暂停队列不下发，恢复后按顺序下发；关闭重放缓冲也不影响
+func TestPauseResume(t *testing.T) {
+	srv := startTestServer(t)
+	hub.query(func() { hub.replay = newReplayBuffer(0) })
+	client := dialTestClient(t, srv, "")
+	waitClients(t, 1)
+	client.RecvProtocol(protocolSession)
+
+	if status, body := adminRequest(t, srv, http.MethodPost, "/pause"); status != http.StatusOK {
+		t.Fatalf("pause: status %d: %s", status, body)
+	}
+	ids := []string{postTask(t, srv, "m1"), postTask(t, srv, "m2")}
+	client.conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, frame, err := client.conn.ReadMessage(); err == nil {
+		t.Fatalf("received %s while paused", frame)
+	}
+	client = dialTestClient(t, srv, "client_id=after-pause")
+	waitClients(t, 2)
+
+	if status, body := adminRequest(t, srv, http.MethodPost, "/resume"); status != http.StatusOK {
+		t.Fatalf("resume: status %d: %s", status, body)
+	}
+	for _, id := range ids {
+		var task InspectorResult
+		if err := client.RecvProtocol(1).decodeData(&task); err != nil || task.TaskID != id {
+			t.Fatalf("received task %+v (%v), want %s", task, err, id)
+		}
+	}
+	postTask(t, srv, "m3")
+	client.RecvProtocol(1)
+}
+
+// TestResumeSessionDuringPause 暂停期间续传的客户端不会从重放缓冲提前收到暂停队列中的广播，恢复后只收到一次
+func TestResumeSessionDuringPause(t *testing.T) {
+	srv := startTestServer(t)
+	stay := dialTestClient(t, srv, "client_id=stay")
+	away := dialTestClient(t, srv, "client_id=away")
+	waitClients(t, 2)
+	token := sessionOf(t, away).ResumeToken
+	away.conn.Close()
+	waitClients(t, 1)
+
+	hub.setPaused(true)
+	id := postTask(t, srv, "p1")
+	back := dialTestClient(t, srv, "client_id=away&resume_token="+token)
+	if notice := sessionOf(t, back); !notice.Resumed {
+		t.Fatalf("session notice %+v, want resumed", notice)
+	}
+	waitClients(t, 2)
+
+	// 续传时若补发了暂停中的广播，恢复后还会再收到一次，紧随其后的就不是下一条任务
+	if flushed := hub.setPaused(false); flushed != 1 {
+		t.Fatalf("flushed %d broadcasts, want 1", flushed)
+	}
+	postTask(t, srv, "after")
+	for _, client := range []*testClient{stay, back} {
+		var task InspectorResult
+		if err := client.RecvProtocol(1).decodeData(&task); err != nil || task.TaskID != id {
+			t.Fatalf("received task %+v (%v), want %s", task, err, id)
+		}
+		if env := client.RecvProtocol(1); env.Data["model"] != "after" {
+			t.Errorf("received %v after the paused task, want the next task", env.Data)
+		}
+	}
+}
+
+// TestPauseQueueFull 暂停队列已满时 /tasks 返回 503，任务不被登记
+func TestPauseQueueFull(t *testing.T) {
+	pauseQueueSize = 1
+	defer func() { pauseQueueSize = defaultPauseQueue }()
+	srv := startTestServer(t)
+	hub.setPaused(true)
+
+	postTask(t, srv, "m1")
+	before := len(tasks.pending(time.Now()))
+	resp, err := http.Post(srv.URL+"/tasks?address=/img/2.jpg&model=m1&version=v1", "", nil)
+	if err != nil {
+		t.Fatalf("post task: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("status %d, Retry-After %q, want 503 with Retry-After", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	if after := len(tasks.pending(time.Now())); after != before {
+		t.Fatalf("rejected task still registered, pending %d -> %d", before, after)
+	}
+	if flushed := hub.setPaused(false); flushed != 1 {
+		t.Fatalf("flushed %d broadcasts, want 1", flushed)
+	}
+}
+
+// TestPauseKeepsSentAt 恢复时按提交时的 sentAt 和 ttl 判断过期，并按连接时长筛选接收者
+func TestPauseKeepsSentAt(t *testing.T) {
+	srv := startTestServer(t)
+	client := dialTestClient(t, srv, "")
+	waitClients(t, 1)
+	client.RecvProtocol(protocolSession)
+	hub.setPaused(true)
+
+	for _, query := range []string{"model=expired&ttl=1", "model=veteran&min_age=1h", "model=fresh"} {
+		resp, err := http.Post(srv.URL+"/tasks?address=/img/1.jpg&version=v1&"+query, "", nil)
+		if err != nil {
+			t.Fatalf("post task: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("post task %s: status %d", query, resp.StatusCode)
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	if flushed := hub.setPaused(false); flushed != 2 {
+		t.Fatalf("flushed %d broadcasts, want 2", flushed)
+	}
+	if env := client.RecvProtocol(1); env.Data["model"] != "fresh" {
+		t.Fatalf("received %v, want only the fresh task", env.Data)
+	}
+}
+
+// TestResumeWithoutClients 恢复时没有在线客户端，暂停期间缓冲的广播转入无客户端队列，之后连接的客户端照常收到
+func TestResumeWithoutClients(t *testing.T) {
+	srv := startTestServer(t)
+	hub.setPaused(true)
+	id := postTask(t, srv, "m1")
+	if flushed := hub.setPaused(false); flushed != 1 {
+		t.Fatalf("flushed %d broadcasts, want 1", flushed)
+	}
+
+	client := dialTestClient(t, srv, "")
+	var task InspectorResult
+	if err := client.RecvProtocol(1).decodeData(&task); err != nil || task.TaskID != id {
+		t.Fatalf("received task %+v (%v), want %s", task, err, id)
+	}
+}
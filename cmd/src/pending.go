@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// PendingTask 是 /tasks/pending 返回的一项，即已广播但尚未被复判端确认的任务
+type PendingTask struct {
+	ID         string    `json:"task_id"`
+	CreatedAt  time.Time `json:"created_at"`
+	AgeSeconds float64   `json:"age_seconds"`
+	// 首次广播之后 Hub 又将该任务投递出去的次数，如断线续传时补发
+	Retries int `json:"retries"`
+}
+
+// pending 按创建顺序返回尚未确认也未完成的任务
+func (s *taskStore) pending(now time.Time) []PendingTask {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]PendingTask, 0)
+	for _, id := range s.order {
+		record := s.records[id]
+		if record.Status != taskPending {
+			continue
+		}
+		list = append(list, PendingTask{
+			ID:         record.ID,
+			CreatedAt:  record.CreatedAt,
+			AgeSeconds: now.Sub(record.CreatedAt).Seconds(),
+			Retries:    record.Retries,
+		})
+	}
+	return list
+}
+
+// retry 记录任务又被投递了一次，未知（未登记或已淘汰）的 id 直接忽略
+func (s *taskStore) retry(ids ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		if record, ok := s.records[id]; ok {
+			record.Retries++
+		}
+	}
+}
+
+// countRetries 记录一次已广播过的消息的重新投递，消息中每个任务的重投次数加一，只能在 run() 中调用。
+// 计数保存在任务记录中，与记录一起被淘汰
+func (h *Hub) countRetries(message []byte) {
+	tasks.retry(parseBroadcastMeta(message).taskIDs...)
+}
+
+// pendingTasks 在 run() 中汇总等待确认的任务及其重投次数，与重投计数的更新不会交错。
+// Hub 已停止时直接读取任务记录
+func (h *Hub) pendingTasks(now time.Time) []PendingTask {
+	var list []PendingTask
+	h.query(func() {
+		list = tasks.pending(now)
+	})
+	if list == nil {
+		list = tasks.pending(now)
+	}
+	return list
+}
+
+// pendingTasksHandler 处理 GET /tasks/pending，列出等待复判端确认的任务及其已等待的时间和重投次数，
+// 用于发现长时间无人处理的任务
+func pendingTasksHandler(w http.ResponseWriter, r *http.Request) {
+	ip, port, err := splitRemoteAddr(r.RemoteAddr)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Cannot resolve client address")
+		return
+	}
+	logRequest(r, ip, port)
+
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, hub.pendingTasks(time.Now()))
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// pendingList 通过 /tasks/pending 返回等待确认的任务，键为任务 id
+func pendingList(t *testing.T, srvURL string) map[string]PendingTask {
+	t.Helper()
+	resp, err := http.Get(srvURL + "/tasks/pending")
+	if err != nil {
+		t.Fatalf("get pending: %v", err)
+	}
+	defer resp.Body.Close()
+	var list []PendingTask
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatalf("decode pending: %v", err)
+	}
+	pending := make(map[string]PendingTask, len(list))
+	for _, task := range list {
+		pending[task.ID] = task
+	}
+	return pending
+}
+
+// TestPendingTasks 广播后未确认的任务出现在列表中，续传补发计为重投，确认后从列表消失
+func TestPendingTasks(t *testing.T) {
+	srv := startTestServer(t)
+	stay := dialTestClient(t, srv, "client_id=stay")
+	away := dialTestClient(t, srv, "client_id=away")
+	waitClients(t, 2)
+	var notice sessionNotice
+	if err := away.RecvProtocol(protocolSession).decodeData(&notice); err != nil {
+		t.Fatalf("decode session notice: %v", err)
+	}
+	away.conn.Close()
+	waitClients(t, 1)
+
+	id := postTask(t, srv, "m1")
+	stay.RecvProtocol(1)
+	task, ok := pendingList(t, srv.URL)[id]
+	if !ok || task.Retries != 0 {
+		t.Fatalf("pending task %s = %+v, %t; want listed with 0 retries", id, task, ok)
+	}
+
+	// 断线的客户端带着令牌重连，补发错过的任务
+	back := dialTestClient(t, srv, "client_id=away&resume_token="+notice.ResumeToken)
+	back.RecvProtocol(1)
+	if task := pendingList(t, srv.URL)[id]; task.Retries != 1 {
+		t.Fatalf("task %s has %d retries after resume, want 1", id, task.Retries)
+	}
+
+	back.Send(protocolAck, map[string]any{"ack_ids": []string{id}})
+	waitFor(t, func() bool {
+		_, ok := pendingList(t, srv.URL)[id]
+		return !ok
+	})
+}
+
+// TestRetryCountEviction 重投次数保存在任务记录中，任务被淘汰后不再保留计数，也不会因重投重新出现
+func TestRetryCountEviction(t *testing.T) {
+	store := newTaskStore(2)
+	now := time.Now()
+	store.add("a", now)
+	store.add("b", now)
+	store.retry("a", "a", "b")
+	if list := store.pending(now); len(list) != 2 || list[0].Retries != 2 || list[1].Retries != 1 {
+		t.Fatalf("pending %+v, want a with 2 retries and b with 1", list)
+	}
+	store.add("c", now)
+	store.retry("a")
+	store.remove("b")
+	store.retry("b")
+	if len(store.records) != 1 {
+		t.Fatalf("%d records kept, want only c", len(store.records))
+	}
+	if list := store.pending(now); len(list) != 1 || list[0].ID != "c" || list[0].Retries != 0 {
+		t.Errorf("pending %+v, want only c with 0 retries", list)
+	}
+}
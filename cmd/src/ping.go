@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// /ping-client 等待客户端回复的默认时间
+const defaultPingTimeout = 5 * time.Second
+
+// pendingPing 是一个已发出的探测，只接受被探测客户端的回复
+type pendingPing struct {
+	clientID string
+	replied  chan struct{}
+}
+
+// pingRegistry 记录已发出、尚未收到回复的探测，键为 nonce
+type pingRegistry struct {
+	mu      sync.Mutex
+	pending map[string]pendingPing
+}
+
+var pendingPings = &pingRegistry{pending: make(map[string]pendingPing)}
+
+// add 登记发给 clientID 的探测，返回收到该客户端回复时关闭的通道
+func (p *pingRegistry) add(nonce, clientID string) chan struct{} {
+	ch := make(chan struct{})
+	p.mu.Lock()
+	p.pending[nonce] = pendingPing{clientID: clientID, replied: ch}
+	p.mu.Unlock()
+	return ch
+}
+
+// remove 在超时或完成后撤销登记
+func (p *pingRegistry) remove(nonce string) {
+	p.mu.Lock()
+	delete(p.pending, nonce)
+	p.mu.Unlock()
+}
+
+// resolve 标记探测已收到 clientID 的回复。nonce 未知、已超时或回复来自其他客户端时返回 false，
+// 其他客户端带回的 nonce 不会结束探测
+func (p *pingRegistry) resolve(nonce, clientID string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ping, ok := p.pending[nonce]
+	if !ok || ping.clientID != clientID {
+		return false
+	}
+	delete(p.pending, nonce)
+	close(ping.replied)
+	return true
+}
+
+var errClientNotFound = errors.New("client not connected")
+
+// sendTo 将消息以高优先级放入指定 id 客户端的发送缓冲。缓冲已满时不像广播那样移除客户端，
+// 而是在 run() 之外阻塞等待缓冲腾出空位，直到放入、客户端被移除或 ctx 结束。
+// sendHigh 不会被关闭，因此可以在 run() 之外发送；客户端被移除时 closing 关闭，等待随之结束。
+// 客户端不在线或已被移除时返回 errClientNotFound，ctx 结束时返回 ctx.Err()
+func (h *Hub) sendTo(ctx context.Context, id string, message []byte) error {
+	target := h.findClient(id)
+	if target == nil {
+		return errClientNotFound
+	}
+	select {
+	case target.sendHigh <- outMessage{data: message, priority: priorityHigh}:
+		return nil
+	case <-target.closing:
+		return errClientNotFound
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pingClientHandler 向指定客户端发送探测消息并等待其回复，返回往返耗时，
+// 用于检查某个复判端是否仍能正常收发
+func pingClientHandler(w http.ResponseWriter, r *http.Request) {
+	ip, port, err := splitRemoteAddr(r.RemoteAddr)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Cannot resolve client address")
+		return
+	}
+	logRequest(r, ip, port)
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeError(w, http.StatusBadRequest, "Missing id parameter")
+		return
+	}
+	timeout := defaultPingTimeout
+	if v := r.URL.Query().Get("timeout_ms"); v != "" {
+		ms, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || ms <= 0 {
+			writeError(w, http.StatusBadRequest, "Invalid timeout_ms parameter")
+			return
+		}
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+
+	nonce := randomHex(8)
+	message, err := json.Marshal(map[string]interface{}{
+		"protocol_id": protocolPing,
+		"data":        map[string]string{"nonce": nonce},
+	})
+	if err != nil {
+		errorf("JSON marshaling error: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	// 放入发送缓冲和等待回复共用 timeout，请求自身的截止时间更早时以请求为准
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	replied := pendingPings.add(nonce, id)
+	defer pendingPings.remove(nonce)
+	start := time.Now()
+	if err := hub.sendTo(ctx, id, message); err != nil {
+		if errors.Is(err, errClientNotFound) {
+			writeError(w, http.StatusNotFound, "Client not connected")
+			return
+		}
+		warnf("Ping to %s not sent, send buffer stayed full: %v", id, err)
+		writeError(w, http.StatusGatewayTimeout, "Client send buffer full")
+		return
+	}
+
+	select {
+	case <-replied:
+		rtt := time.Since(start)
+		debugf("Ping reply from %s in %v", id, rtt)
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"id":     id,
+			"rtt_ms": float64(rtt.Microseconds()) / 1000,
+		})
+	case <-ctx.Done():
+		if r.Context().Err() != nil {
+			return
+		}
+		warnf("Ping to %s timed out after %v", id, timeout)
+		writeError(w, http.StatusGatewayTimeout, "Client did not reply in time")
+	}
+}
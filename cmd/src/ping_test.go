@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// pingResult 是 /ping-client 的响应
+type pingResult struct {
+	status int
+	rttMs  float64
+}
+
+// pingClient 在后台以管理令牌请求 /ping-client，返回接收结果的通道
+func pingClient(t *testing.T, srvURL, id string, timeout time.Duration) <-chan pingResult {
+	t.Helper()
+	prev := access.Load()
+	access.Store(&accessControl{adminToken: testAdminToken})
+	t.Cleanup(func() { access.Store(prev) })
+	result := make(chan pingResult, 1)
+	go func() {
+		req, err := http.NewRequest(http.MethodPost, srvURL+"/ping-client?id="+id+"&timeout_ms="+strconv.FormatInt(timeout.Milliseconds(), 10), nil)
+		if err != nil {
+			t.Errorf("new request: %v", err)
+			result <- pingResult{}
+			return
+		}
+		req.Header.Set("Authorization", "Bearer "+testAdminToken)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Errorf("ping-client: %v", err)
+			result <- pingResult{}
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		var decoded struct {
+			RTT float64 `json:"rtt_ms"`
+		}
+		json.Unmarshal(body, &decoded)
+		result <- pingResult{status: resp.StatusCode, rttMs: decoded.RTT}
+	}()
+	return result
+}
+
+// TestPingClient 被探测的客户端回复后返回往返耗时
+func TestPingClient(t *testing.T) {
+	srv := startTestServer(t)
+	client := dialTestClient(t, srv, "client_id=reviewer-1")
+	waitClients(t, 1)
+
+	result := pingClient(t, srv.URL, "reviewer-1", testRecvTimeout)
+	ping := client.RecvProtocol(protocolPing)
+	client.Send(protocolPong, ping.Data)
+	if got := <-result; got.status != http.StatusOK || got.rttMs <= 0 {
+		t.Fatalf("ping-client returned status %d, rtt %v ms", got.status, got.rttMs)
+	}
+}
+
+// TestPingClientReplyFromOtherClient 其他客户端带回同一 nonce 时探测不算完成，最终超时
+func TestPingClientReplyFromOtherClient(t *testing.T) {
+	srv := startTestServer(t)
+	target := dialTestClient(t, srv, "client_id=reviewer-1")
+	other := dialTestClient(t, srv, "client_id=reviewer-2")
+	waitClients(t, 2)
+
+	result := pingClient(t, srv.URL, "reviewer-1", 200*time.Millisecond)
+	ping := target.RecvProtocol(protocolPing)
+	other.Send(protocolPong, ping.Data)
+	if got := <-result; got.status != http.StatusGatewayTimeout {
+		t.Fatalf("ping-client returned status %d after a reply from another client, want 504", got.status)
+	}
+}
+
+// TestPingClientBufferFull 目标客户端的高优先级缓冲一直是满的时，探测在截止时间到达后返回 504，客户端不被移除；
+// 缓冲腾出空位后 sendTo 随即放入
+func TestPingClientBufferFull(t *testing.T) {
+	srv := startTestServer(t)
+	client := &Client{hub: hub, id: "stuck", send: make(chan outMessage, 8), sendHigh: make(chan outMessage, 1), closing: make(chan struct{})}
+	if !hub.join(client) {
+		t.Fatal("join failed")
+	}
+	waitClients(t, 1)
+	client.sendHigh <- outMessage{data: []byte(`{}`)}
+
+	start := time.Now()
+	if got := <-pingClient(t, srv.URL, "stuck", 100*time.Millisecond); got.status != http.StatusGatewayTimeout {
+		t.Fatalf("ping-client returned status %d with a full buffer, want 504", got.status)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("ping-client gave up after %v, before the deadline", elapsed)
+	}
+	waitClients(t, 1)
+	if got := <-pingClient(t, srv.URL, "missing", 100*time.Millisecond); got.status != http.StatusNotFound {
+		t.Errorf("ping-client returned status %d for an unknown client, want 404", got.status)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), testRecvTimeout)
+	defer cancel()
+	sent := make(chan error, 1)
+	go func() { sent <- hub.sendTo(ctx, "stuck", []byte(`{"protocol_id":7}`)) }()
+	time.Sleep(30 * time.Millisecond)
+	<-client.sendHigh
+	if err := <-sent; err != nil {
+		t.Fatalf("sendTo after the buffer drained: %v", err)
+	}
+	if m := <-client.sendHigh; string(m.data) != `{"protocol_id":7}` {
+		t.Errorf("queued %s, want the unicast message", m.data)
+	}
+}
+
+// TestPingClientRequiresAdmin 没有管理令牌时不能探测客户端
+func TestPingClientRequiresAdmin(t *testing.T) {
+	srv := startTestServer(t)
+	prev := access.Load()
+	access.Store(&accessControl{adminToken: testAdminToken})
+	defer access.Store(prev)
+	dialTestClient(t, srv, "client_id=reviewer-1")
+	waitClients(t, 1)
+
+	resp, err := http.Post(srv.URL+"/ping-client?id=reviewer-1", "", nil)
+	if err != nil {
+		t.Fatalf("ping-client: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("ping-client without token = %d, want 401", resp.StatusCode)
+	}
+}
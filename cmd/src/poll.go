@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// 长轮询的默认等待时间
+const defaultPollTimeout = 25 * time.Second
+
+// 长轮询单次等待时间，客户端在此期间没有消息时收到空数组
+var pollTimeout = defaultPollTimeout
+
+// 同时存在的长轮询伪客户端数上限的默认值
+const defaultMaxPollClients = 1000
+
+// 同时存在的长轮询伪客户端数上限，由 -max-poll-clients 配置
+var maxPollClients = defaultMaxPollClients
+
+// pollEntry 是一个长轮询伪客户端及其轮询状态
+type pollEntry struct {
+	client *Client
+	// 正在进行中的轮询请求数，为 0 时客户端空闲，expiry 在计时
+	active int
+	// 最近一次轮询结束的时间，客户端数达到上限时先淘汰空闲最久的
+	idleSince time.Time
+	// 空闲过期计时器，在两个轮询周期内没有再次轮询时注销客户端
+	expiry *time.Timer
+}
+
+// pollClients 保存以长轮询方式接入的伪客户端，键为 client_id
+var pollClients = struct {
+	sync.Mutex
+	m map[string]*pollEntry
+}{m: make(map[string]*pollEntry)}
+
+// pollClient 返回 clientID 对应的伪客户端并记为正在轮询。不存在时先经过与 WebSocket 连接相同的准入检查，
+// 伪客户端数达到 maxPollClients 时淘汰空闲最久的一个，没有空闲的则拒绝，然后创建并注册到 Hub。
+// 伪客户端没有 WebSocket 连接，消息由 pollHandler 从 send 通道中取出。被拒绝时已写出错误响应并返回 nil
+func pollClient(h *Hub, w http.ResponseWriter, r *http.Request, clientID string) *Client {
+	pollClients.Lock()
+	defer pollClients.Unlock()
+	if entry, ok := pollClients.m[clientID]; ok {
+		if entry.expiry != nil {
+			entry.expiry.Stop()
+		}
+		entry.active++
+		return entry.client
+	}
+	connID := newConnID()
+	current := settings.get()
+	if !admitClient(w, r, connID, current) {
+		return nil
+	}
+	if len(pollClients.m) >= maxPollClients && !evictIdlePollClient() {
+		connWarnf(connID, "Reject poll client from %s: max poll clients %d reached", r.RemoteAddr, maxPollClients)
+		rejectForCapacity(w, "Too many poll clients")
+		return nil
+	}
+	client := &Client{
+		hub:      h,
+		send:     make(chan outMessage, 256),
+		sendHigh: make(chan outMessage, highPrioritySendBuffer),
+		closing:  make(chan struct{}),
+		id:       "poll:" + clientID,
+		settings: current,
+		connID:   connID,
+		naming:   envelopeNaming,
+
+		connectedAt: time.Now(),
+	}
+	if !h.join(client) {
+		writeError(w, http.StatusServiceUnavailable, "Service is shutting down")
+		return nil
+	}
+	pollClients.m[clientID] = &pollEntry{client: client, active: 1}
+	return client
+}
+
+// evictIdlePollClient 注销空闲最久的长轮询客户端，没有空闲客户端时返回 false。调用方需持有 pollClients 锁
+func evictIdlePollClient() bool {
+	var oldestID string
+	var oldest *pollEntry
+	for id, entry := range pollClients.m {
+		if entry.active == 0 && (oldest == nil || entry.idleSince.Before(oldest.idleSince)) {
+			oldestID, oldest = id, entry
+		}
+	}
+	if oldest == nil {
+		return false
+	}
+	oldest.expiry.Stop()
+	delete(pollClients.m, oldestID)
+	oldest.client.hub.leave(oldest.client)
+	oldest.client.infof("Poll client %s evicted", oldest.client.id)
+	return true
+}
+
+// releasePollClient 在一次轮询结束后调用，客户端没有其他进行中的轮询时开始计时，
+// 若在两个轮询周期内没有再次轮询则注销
+func releasePollClient(clientID string, client *Client) {
+	pollClients.Lock()
+	defer pollClients.Unlock()
+	entry, ok := pollClients.m[clientID]
+	if !ok || entry.client != client {
+		return
+	}
+	if entry.active--; entry.active > 0 {
+		return
+	}
+	entry.idleSince = time.Now()
+	entry.expiry = time.AfterFunc(2*pollTimeout, func() {
+		if removePollClient(clientID, client) {
+			client.infof("Poll client %s expired", client.id)
+		}
+	})
+}
+
+// removePollClient 从长轮询客户端表中移除并向 Hub 注销，客户端已被移除或已再次轮询时返回 false
+func removePollClient(clientID string, client *Client) bool {
+	pollClients.Lock()
+	entry, ok := pollClients.m[clientID]
+	if !ok || entry.client != client || entry.active > 0 {
+		pollClients.Unlock()
+		return false
+	}
+	delete(pollClients.m, clientID)
+	pollClients.Unlock()
+	client.hub.leave(client)
+	return true
+}
+
+// pollHandler 为无法使用 WebSocket 的客户端提供长轮询：
+// 最多等待 pollTimeout，返回期间收到的所有广播组成的 JSON 数组，客户端随后再次轮询。
+// client_id 必填且与 WebSocket 的 client_id 规则相同，首次轮询按 WebSocket 连接的规则准入
+func pollHandler(w http.ResponseWriter, r *http.Request) {
+	ip, port, err := splitRemoteAddr(r.RemoteAddr)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Cannot resolve client address")
+		return
+	}
+	logRequest(r, ip, port)
+
+	clientID := r.URL.Query().Get("client_id")
+	if clientID == "" {
+		writeError(w, http.StatusBadRequest, "Missing client_id parameter")
+		return
+	}
+	if !clientIDPattern.MatchString(clientID) {
+		writeError(w, http.StatusBadRequest, "Invalid client_id")
+		return
+	}
+	// 与 WebSocket 握手一样按 -allowed-origins 检查来源
+	if !checkOrigin(r) {
+		writeError(w, http.StatusForbidden, "Origin not allowed")
+		return
+	}
+	client := pollClient(hub, w, r, clientID)
+	if client == nil {
+		return
+	}
+	defer releasePollClient(clientID, client)
+
+	messages := []json.RawMessage{}
+	timer := time.NewTimer(pollTimeout)
+	defer timer.Stop()
+	select {
+	case message := <-client.sendHigh:
+		messages = append(messages, client.encode(message).pollData())
+		messages = drainPollQueue(client, messages)
+	case message, ok := <-client.send:
+		if !ok {
+			// 已被 Hub 移除（如缓冲已满），客户端需重新轮询以重新注册
+			pollClients.Lock()
+			if entry, ok := pollClients.m[clientID]; ok && entry.client == client {
+				delete(pollClients.m, clientID)
+			}
+			pollClients.Unlock()
+			writeError(w, http.StatusGone, "Poll client was dropped, poll again")
+			return
+		}
+		messages = append(messages, client.encode(message).pollData())
+		messages = drainPollQueue(client, messages)
+	case <-timer.C:
+	case <-r.Context().Done():
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(messages); err != nil {
+		errorf("JSON encoding error: %v", err)
+	}
+}
+
+// drainPollQueue 一并取出已排队的消息，高优先级在前
+func drainPollQueue(client *Client, messages []json.RawMessage) []json.RawMessage {
+	for n := len(client.sendHigh) + len(client.send); n > 0; n-- {
+		queued, ok := client.nextQueued()
+		if !ok {
+			break
+		}
+		messages = append(messages, client.encode(queued).pollData())
+	}
+	return messages
+}
+
+// pollData 返回长轮询响应中的消息内容，二进制消息以 base64 字符串表示
+func (m outMessage) pollData() json.RawMessage {
+	if m.frameType() == websocket.TextMessage {
+		return m.data
+	}
+	encoded, _ := json.Marshal(m.data)
+	return encoded
+}
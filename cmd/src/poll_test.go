@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// poll 请求一次 /poll，返回状态码和收到的消息
+func poll(t *testing.T, srv *httptest.Server, clientID string) (int, []Envelope) {
+	t.Helper()
+	resp, err := http.Get(srv.URL + "/poll?client_id=" + clientID)
+	if err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, nil
+	}
+	var raw []json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		t.Fatalf("decode poll: %v", err)
+	}
+	envs := make([]Envelope, 0, len(raw))
+	for _, message := range raw {
+		env, err := parseEnvelope(message)
+		if err != nil {
+			t.Fatalf("poll message %s: %v", message, err)
+		}
+		envs = append(envs, env)
+	}
+	return resp.StatusCode, envs
+}
+
+// startPollServer 以 100ms 的轮询周期启动测试服务器，
+// 在 HTTP 服务关闭、所有轮询请求结束之后恢复轮询周期并清空长轮询客户端表
+func startPollServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	pollTimeout = 100 * time.Millisecond
+	t.Cleanup(func() {
+		pollTimeout = defaultPollTimeout
+		pollClients.Lock()
+		defer pollClients.Unlock()
+		for id, entry := range pollClients.m {
+			if entry.expiry != nil {
+				entry.expiry.Stop()
+			}
+			delete(pollClients.m, id)
+		}
+	})
+	return startTestServer(t)
+}
+
+// TestLongPoll 长轮询客户端注册为 Hub 的伪客户端，广播后轮询收到任务，没有消息时等待超时返回空数组
+func TestLongPoll(t *testing.T) {
+	srv := startPollServer(t)
+
+	if status, _ := poll(t, srv, ""); status != http.StatusBadRequest {
+		t.Errorf("poll without client_id = %d, want 400", status)
+	}
+	// 第一次轮询完成注册，取回欢迎消息和续传令牌
+	_, envs := poll(t, srv, "p1")
+	if len(envs) != 2 || envs[0].ProtocolID != protocolWelcome || envs[1].ProtocolID != protocolSession {
+		t.Fatalf("first poll %+v, want welcome and session notice", envs)
+	}
+	if !hub.hasClient("poll:p1") {
+		t.Fatal("poll client not registered with the hub")
+	}
+
+	id := postTask(t, srv, "m1")
+	_, envs = poll(t, srv, "p1")
+	if len(envs) != 1 || envs[0].ProtocolID != 1 || envs[0].Data["task_id"] != id {
+		t.Fatalf("poll after broadcast %+v, want task %s", envs, id)
+	}
+
+	start := time.Now()
+	status, envs := poll(t, srv, "p1")
+	if status != http.StatusOK || len(envs) != 0 || time.Since(start) < pollTimeout {
+		t.Errorf("idle poll = %d %+v after %v, want an empty array after %v", status, envs, time.Since(start), pollTimeout)
+	}
+
+	// 两个轮询周期内没有再次轮询的客户端被注销
+	waitFor(t, func() bool { return !hub.hasClient("poll:p1") })
+}
+
+// TestPollAdmission 长轮询与 WebSocket 连接经过相同的准入检查：client_id 不合法、来源不被允许或排空期间拒绝，
+// 伪客户端数达到上限时淘汰空闲最久的，没有空闲的则拒绝
+func TestPollAdmission(t *testing.T) {
+	prev := access.Load()
+	t.Cleanup(func() { access.Store(prev) })
+	origins, err := parseOriginPatterns("*.example.com")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	access.Store(&accessControl{origins: origins})
+	maxPollClients = 1
+	t.Cleanup(func() { maxPollClients = defaultMaxPollClients })
+	srv := startPollServer(t)
+
+	if status, _ := poll(t, srv, "bad%20id"); status != http.StatusBadRequest {
+		t.Errorf("poll with invalid client_id = %d, want 400", status)
+	}
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/poll?client_id=p1", nil)
+	req.Header.Set("Origin", "https://evil.com")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("poll from disallowed origin = %d, want 403", resp.StatusCode)
+	}
+
+	draining.Store(true)
+	status, _ := poll(t, srv, "p1")
+	draining.Store(false)
+	if status != http.StatusServiceUnavailable || hub.hasClient("poll:p1") {
+		t.Errorf("poll while draining = %d, want 503 without registering", status)
+	}
+
+	// p1 空闲时 p2 到达，淘汰 p1
+	if status, _ := poll(t, srv, "p1"); status != http.StatusOK {
+		t.Fatalf("poll p1 = %d, want 200", status)
+	}
+	if status, _ := poll(t, srv, "p2"); status != http.StatusOK {
+		t.Fatalf("poll p2 = %d, want 200", status)
+	}
+	waitFor(t, func() bool { return !hub.hasClient("poll:p1") && hub.hasClient("poll:p2") })
+
+	// p2 正在轮询时没有可淘汰的客户端，p3 被拒绝
+	done := make(chan int)
+	go func() {
+		status, _ := poll(t, srv, "p2")
+		done <- status
+	}()
+	waitFor(t, func() bool {
+		pollClients.Lock()
+		defer pollClients.Unlock()
+		entry := pollClients.m["p2"]
+		return entry != nil && entry.active > 0
+	})
+	if status, _ := poll(t, srv, "p3"); status != http.StatusServiceUnavailable {
+		t.Errorf("poll p3 at the limit = %d, want 503", status)
+	}
+	if status := <-done; status != http.StatusOK {
+		t.Errorf("concurrent poll p2 = %d, want 200", status)
+	}
+}
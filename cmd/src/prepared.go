@@ -0,0 +1,28 @@
+package main
+
+import "github.com/gorilla/websocket"
+
+// prepareBroadcast 将广播预先编码为 PreparedMessage，gorilla 按压缩与否各缓存一份帧，
+// 发给多个客户端时只压缩一次。编码失败时返回 nil，由各连接按普通消息写出
+func prepareBroadcast(msgType int, message []byte) *websocket.PreparedMessage {
+	prepared, err := websocket.NewPreparedMessage(msgType, message)
+	if err != nil {
+		warnf("Prepare broadcast error: %v", err)
+		return nil
+	}
+	return prepared
+}
+
+// writeStandalone 将消息单独写成一帧，有预编码的帧时直接写出
+func (c *Client) writeStandalone(message outMessage) error {
+	var err error
+	if message.prepared != nil {
+		err = c.conn.WritePreparedMessage(message.prepared)
+	} else {
+		err = c.conn.WriteMessage(message.frameType(), message.data)
+	}
+	if err == nil {
+		c.countSent(len(message.data))
+	}
+	return err
+}
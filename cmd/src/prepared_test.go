@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestPreparedBroadcast 协商了压缩的客户端共享预编码的帧，解压后内容与广播一致
+func TestPreparedBroadcast(t *testing.T) {
+	upgrader.EnableCompression = true
+	defer func() { upgrader.EnableCompression = false }()
+	srv := startTestServer(t)
+
+	dialer := websocket.Dialer{EnableCompression: true}
+	var clients []*testClient
+	for i := 0; i < 3; i++ {
+		conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", nil)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		clients = append(clients, &testClient{t: t, conn: conn})
+	}
+	waitClients(t, len(clients))
+	hub.query(func() {
+		for client := range hub.clients {
+			if !client.compression {
+				t.Errorf("client %s did not negotiate compression", client.id)
+			}
+		}
+	})
+
+	msg := strings.Repeat("prepared ", 64)
+	message := []byte(`{"protocol_id":1,"data":{"msg":"` + msg + `"}}`)
+	if delivered, err := hub.submit(message, priorityNormal); err != nil || delivered != len(clients) {
+		t.Fatalf("delivered to %d clients, want %d", delivered, len(clients))
+	}
+	for _, client := range clients {
+		if got := client.RecvProtocol(1); got.Data["msg"] != msg {
+			t.Fatalf("received %v, want msg %q", got.Data, msg)
+		}
+	}
+}
+
+// benchConns 建立 n 对启用压缩的连接，返回服务端一侧的连接；客户端一侧持续读取并丢弃收到的消息
+func benchConns(b *testing.B, n int) []*websocket.Conn {
+	b.Helper()
+	up := websocket.Upgrader{EnableCompression: true}
+	accepted := make(chan *websocket.Conn)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := up.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conn.EnableWriteCompression(true)
+		accepted <- conn
+	}))
+	b.Cleanup(srv.Close)
+	dialer := websocket.Dialer{EnableCompression: true}
+	conns := make([]*websocket.Conn, 0, n)
+	for i := 0; i < n; i++ {
+		client, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+		if err != nil {
+			b.Fatalf("dial: %v", err)
+		}
+		go func() {
+			for {
+				if _, _, err := client.NextReader(); err != nil {
+					return
+				}
+			}
+		}()
+		conn := <-accepted
+		b.Cleanup(func() {
+			conn.Close()
+			client.Close()
+		})
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+// BenchmarkBroadcastPerClient 每个连接各自压缩同一条广播
+func BenchmarkBroadcastPerClient(b *testing.B) {
+	conns := benchConns(b, benchClients)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, conn := range conns {
+			if err := conn.WriteMessage(websocket.TextMessage, benchMessage); err != nil {
+				b.Fatalf("write: %v", err)
+			}
+		}
+	}
+}
+
+// BenchmarkBroadcastPrepared 广播只预编码一次，所有连接写出同一个 PreparedMessage
+func BenchmarkBroadcastPrepared(b *testing.B) {
+	conns := benchConns(b, benchClients)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		prepared := prepareBroadcast(websocket.TextMessage, benchMessage)
+		for _, conn := range conns {
+			if err := conn.WritePreparedMessage(prepared); err != nil {
+				b.Fatalf("write: %v", err)
+			}
+		}
+	}
+}
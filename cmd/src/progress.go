@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// 单个任务保留的进度记录数，超出后丢弃最早的记录
+const maxProgressUpdates = 32
+
+// 复判端报告进度后、回传结果前的任务状态
+const taskInProgress = "in_progress"
+
+// 是否将进度消息通过 -result-webhook 转发给检测端，由 -forward-progress 配置
+var forwardProgress bool
+
+// progressUpdate 是复判端报告的一次进度
+type progressUpdate struct {
+	// 完成百分比，未报告时为 nil
+	Percent *float64 `json:"percent,omitempty"`
+	// 版本 2 报告的已完成项数与总项数，Percent 由二者换算
+	Done  int64 `json:"done,omitempty"`
+	Total int64 `json:"total,omitempty"`
+	// 复判端自定义的阶段描述，如 "downloading"
+	Status string    `json:"status,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// parseProgress 按信封版本解析进度消息的 data。版本 1：
+//
+//	{"task_id": "9f2c...", "percent": 40, "status": "analyzing"}
+//
+// percent 取值 0 到 100。版本 2 以已完成项数和总项数代替百分比，便于逐张处理多张图片的复判端直接上报：
+//
+//	{"task_id": "9f2c...", "done": 3, "total": 10, "status": "analyzing"}
+//
+// done 与 total 须同时出现且 0 <= done <= total、total > 0。两个版本中进度与 status 都至少带一个
+func parseProgress(data map[string]interface{}, version int64) (string, progressUpdate, error) {
+	var update progressUpdate
+	id, _ := data["task_id"].(string)
+	if !taskIDPattern.MatchString(id) {
+		return "", update, fmt.Errorf("task_id is missing or invalid")
+	}
+	var err error
+	if version >= 2 {
+		err = parseProgressCounts(data, &update)
+	} else {
+		err = parseProgressPercent(data, &update)
+	}
+	if err != nil {
+		return "", update, err
+	}
+	if raw, ok := data["status"]; ok {
+		status, ok := raw.(string)
+		if !ok {
+			return "", update, fmt.Errorf("status must be a string, got %T", raw)
+		}
+		update.Status = status
+	}
+	if update.Percent == nil && update.Status == "" {
+		return "", update, fmt.Errorf("progress needs percent or status")
+	}
+	return id, update, nil
+}
+
+// parseProgressPercent 解析版本 1 的 percent 字段
+func parseProgressPercent(data map[string]interface{}, update *progressUpdate) error {
+	raw, ok := data["percent"]
+	if !ok {
+		return nil
+	}
+	num, ok := raw.(json.Number)
+	if !ok {
+		return fmt.Errorf("percent must be a number, got %T", raw)
+	}
+	percent, err := num.Float64()
+	if err != nil || percent < 0 || percent > 100 {
+		return fmt.Errorf("percent %s must be between 0 and 100", num)
+	}
+	update.Percent = &percent
+	return nil
+}
+
+// parseProgressCounts 解析版本 2 的 done 与 total 字段，并换算为百分比
+func parseProgressCounts(data map[string]interface{}, update *progressUpdate) error {
+	if _, ok := data["percent"]; ok {
+		return fmt.Errorf("percent is replaced by done and total in version 2")
+	}
+	rawDone, hasDone := data["done"]
+	rawTotal, hasTotal := data["total"]
+	if !hasDone && !hasTotal {
+		return nil
+	}
+	if !hasDone || !hasTotal {
+		return fmt.Errorf("done and total must be given together")
+	}
+	done, err := progressCount(rawDone, "done")
+	if err != nil {
+		return err
+	}
+	total, err := progressCount(rawTotal, "total")
+	if err != nil {
+		return err
+	}
+	if total == 0 || done > total {
+		return fmt.Errorf("done %d of total %d is out of range", done, total)
+	}
+	percent := float64(done) * 100 / float64(total)
+	update.Percent = &percent
+	update.Done, update.Total = done, total
+	return nil
+}
+
+// progressCount 解析 done 或 total，须为非负整数
+func progressCount(raw interface{}, name string) (int64, error) {
+	num, ok := raw.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("%s must be a number, got %T", name, raw)
+	}
+	n, err := num.Int64()
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s %s must be a non-negative integer", name, num)
+	}
+	return n, nil
+}
+
+// progress 记录任务的一次进度，任务随之进入 in_progress 状态，直到收到结果。
+// 任务未知或已完成时返回错误
+func (s *taskStore) progress(id, reviewer string, update progressUpdate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[id]
+	if !ok {
+		return fmt.Errorf("unknown task %s", id)
+	}
+	if record.Status == taskCompleted {
+		return fmt.Errorf("task %s is already completed", id)
+	}
+	record.Status = taskInProgress
+	record.Reviewer = reviewer
+	if len(record.Progress) >= maxProgressUpdates {
+		record.Progress = record.Progress[1:]
+	}
+	record.Progress = append(record.Progress, update)
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// TestProgress 两次进度按顺序记录在任务上，任务处于处理中；回传结果后任务完成，之后的进度被拒绝
+func TestProgress(t *testing.T) {
+	srv := startTestServer(t)
+	client := dialTestClient(t, srv, "client_id=reviewer-1")
+	waitClients(t, 1)
+
+	id := postTask(t, srv, "m1")
+	var task InspectorResult
+	if err := client.RecvProtocol(1).decodeData(&task); err != nil {
+		t.Fatalf("decode task: %v", err)
+	}
+	client.Send(protocolProgress, map[string]any{"task_id": id, "percent": 30, "status": "downloading"})
+	client.Send(protocolProgress, map[string]any{"task_id": id, "percent": 70})
+	waitFor(t, func() bool {
+		record, _ := tasks.get(id)
+		return len(record.Progress) == 2
+	})
+	record, _ := tasks.get(id)
+	if record.Status != taskInProgress || record.Reviewer != "reviewer-1" {
+		t.Fatalf("status %q reviewer %q, want in_progress by reviewer-1", record.Status, record.Reviewer)
+	}
+	first, second := record.Progress[0], record.Progress[1]
+	if first.Percent == nil || *first.Percent != 30 || first.Status != "downloading" {
+		t.Errorf("first update %+v, want 30%% downloading", first)
+	}
+	if second.Percent == nil || *second.Percent != 70 || second.Status != "" {
+		t.Errorf("second update %+v, want 70%%", second)
+	}
+	if second.At.Before(first.At) {
+		t.Errorf("updates out of order: %v before %v", second.At, first.At)
+	}
+
+	client.Send(2, task)
+	waitFor(t, func() bool {
+		record, _ := tasks.get(id)
+		return record.Status == taskCompleted
+	})
+	resp, err := http.Get(srv.URL + "/results/" + id)
+	if err != nil {
+		t.Fatalf("get result: %v", err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&record); err != nil {
+		t.Fatalf("decode result: %v", err)
+	}
+	if len(record.Progress) != 2 {
+		t.Errorf("/results lists %d progress updates, want 2", len(record.Progress))
+	}
+
+	client.Send(protocolProgress, map[string]any{"task_id": id, "percent": 100})
+	if env := client.RecvProtocol(protocolError); env.Data["error"] != "task "+id+" is already completed" {
+		t.Errorf("progress after result: %v", env.Data)
+	}
+}
+
+// TestParseProgress percent 与 status 至少带一个，percent 须在 0 到 100 之间；
+// 版本 2 以 done/total 代替 percent，二者须同时出现且 done 不超过 total
+func TestParseProgress(t *testing.T) {
+	const id = "0123456789abcdef"
+	for _, tc := range []struct {
+		data    map[string]any
+		version int64
+		ok      bool
+	}{
+		{map[string]any{"task_id": id, "percent": json.Number("50")}, 1, true},
+		{map[string]any{"task_id": id, "status": "analyzing"}, 1, true},
+		{map[string]any{"task_id": id}, 1, false},
+		{map[string]any{"task_id": id, "percent": json.Number("101")}, 1, false},
+		{map[string]any{"task_id": id, "percent": "50"}, 1, false},
+		{map[string]any{"task_id": id, "status": 1}, 1, false},
+		{map[string]any{"percent": json.Number("50")}, 1, false},
+		// 版本 1 不认识 done/total
+		{map[string]any{"task_id": id, "done": json.Number("1"), "total": json.Number("4")}, 1, false},
+		{map[string]any{"task_id": id, "done": json.Number("1"), "total": json.Number("4")}, 2, true},
+		{map[string]any{"task_id": id, "status": "analyzing"}, 2, true},
+		{map[string]any{"task_id": id, "percent": json.Number("50")}, 2, false},
+		{map[string]any{"task_id": id, "done": json.Number("1")}, 2, false},
+		{map[string]any{"task_id": id, "done": json.Number("5"), "total": json.Number("4")}, 2, false},
+		{map[string]any{"task_id": id, "done": json.Number("0"), "total": json.Number("0")}, 2, false},
+		{map[string]any{"task_id": id, "done": json.Number("1.5"), "total": json.Number("4")}, 2, false},
+	} {
+		if _, _, err := parseProgress(tc.data, tc.version); (err == nil) != tc.ok {
+			t.Errorf("parseProgress(%v, v%d) error %v, want ok %v", tc.data, tc.version, err, tc.ok)
+		}
+	}
+	_, update, _ := parseProgress(map[string]any{"task_id": id, "done": json.Number("1"), "total": json.Number("4")}, 2)
+	if update.Percent == nil || *update.Percent != 25 || update.Done != 1 || update.Total != 4 {
+		t.Errorf("v2 update %+v, want 1 of 4 as 25%%", update)
+	}
+}
+
+// TestProgressVersion2 带 version 2 的进度消息经 readPump 按 done/total 解码，同样内容以版本 1 发送被拒绝
+func TestProgressVersion2(t *testing.T) {
+	srv := startTestServer(t)
+	client := dialTestClient(t, srv, "")
+	waitClients(t, 1)
+
+	id := postTask(t, srv, "m1")
+	client.RecvProtocol(1)
+	data := map[string]any{"task_id": id, "done": 3, "total": 4}
+	client.SendRaw(map[string]any{"protocol_id": protocolProgress, "data": data})
+	if env := client.RecvProtocol(protocolError); env.Data["error"] != "progress needs percent or status" {
+		t.Errorf("v1 progress with done/total: %v", env.Data)
+	}
+	client.SendRaw(map[string]any{"protocol_id": protocolProgress, "version": 2, "data": data})
+	waitFor(t, func() bool {
+		record, _ := tasks.get(id)
+		return len(record.Progress) == 1
+	})
+	record, _ := tasks.get(id)
+	if update := record.Progress[0]; update.Percent == nil || *update.Percent != 75 || update.Done != 3 || update.Total != 4 {
+		t.Errorf("v2 update %+v, want 3 of 4 as 75%%", update)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// protocol_id 科学计数法中允许的最大指数绝对值
+const maxProtocolIDExponent = 64
+
+// 客户端发来的协议号
+const (
+	// 订阅指定型号的任务
+	protocolSubscribe = 3
+	// 声明自身可处理的型号和版本
+	protocolCapabilities = 4
+	// 报告任务进度，data 中带有 task_id 以及 percent（版本 2 为 done/total）或 status，最终仍以 protocol_id=2 回传结果
+	protocolProgress = 5
+	// 转发给其他所有复判端，服务端下发时附带发送者 from
+	protocolRelay = 6
+	// 回复服务端的探测消息，data 原样带回 nonce
+	protocolPong = 7
+	// 分片发送的复判结果，收齐后按 protocol_id=2 处理
+	protocolResultChunk = 8
+	// 批量确认已收到的任务，data 中 ack_ids 为任务 id 数组
+	protocolAck = 9
+)
+
+// 服务端主动下发的协议号
+const (
+	// 服务公告，如维护通知，由 /announce 发起
+	protocolAnnounce = 200
+	// 欢迎消息，连接注册后最先下发，带有服务端时间、分配的客户端标识和生效的设置
+	protocolWelcome = 201
+	// 要求客户端改连到 data.url，由 /migrate 发起，随后服务端关闭连接
+	protocolRedirect = 202
+	// 续传令牌，连接注册后下发
+	protocolSession = 203
+	// 往返探测，由 /ping-client 发起，data 中带有 nonce
+	protocolPing = 204
+	// 客户端消息被拒绝时的错误回复，data 中带有出错消息的 protocol_id 和原因
+	protocolError = 205
+)
+
+// 消息允许被回显或转发的默认最大次数
+const defaultMaxHops = 8
+
+// 客户端消息的 hops 达到该值时直接丢弃，防止回显与转发形成环路，由 -max-hops 配置
+var maxHops int64 = defaultMaxHops
+
+// 信封中未携带 version 字段时采用的协议版本
+const defaultEnvelopeVersion = 1
+
+// protocolVersions 记录每个协议号支持的最高版本，数据格式演进时在此登记新版本，
+// 并在 readPump 中将 Envelope.Version 传给该协议的解析函数按版本分别解码。未登记的协议只支持默认版本。
+// 进度消息的版本 2 以 done/total 代替 percent，见 parseProgress
+var protocolVersions = map[int64]int64{
+	1:                    1,
+	2:                    1,
+	protocolSubscribe:    1,
+	protocolCapabilities: 1,
+	protocolRelay:        1,
+	protocolPong:         1,
+	protocolResultChunk:  1,
+	protocolAck:          1,
+	protocolProgress:     2,
+}
+
+// parseEnvelopeVersion 读取信封中的 version 字段，缺省时为 defaultEnvelopeVersion，
+// 并检查该协议是否支持此版本
+func parseEnvelopeVersion(msgData map[string]interface{}, protocolID int64) (int64, error) {
+	raw, ok := msgData["version"]
+	if !ok {
+		return defaultEnvelopeVersion, nil
+	}
+	num, ok := raw.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("version must be a number, got %T", raw)
+	}
+	version, err := num.Int64()
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("version %s must be a positive integer", num)
+	}
+	latest, ok := protocolVersions[protocolID]
+	if !ok {
+		latest = defaultEnvelopeVersion
+	}
+	if version > latest {
+		return 0, fmt.Errorf("version %d is not supported for protocol_id %d (max %d)", version, protocolID, latest)
+	}
+	return version, nil
+}
+
+// broadcastMeta 是 Hub 分发广播时需要的元信息
+type broadcastMeta struct {
+	// 任务的型号和版本，批量任务包含所有任务
+	tasks []taskKey
+	// 广播中的任务 id，批量任务包含所有任务
+	taskIDs []string
+	// 消息有效期，0 表示永不过期
+	ttl time.Duration
+	// 接收者的连接时长范围，由提交广播时指定，不从消息中解析
+	age ageRange
+}
+
+// taskKey 是任务的型号和版本
+type taskKey struct {
+	Model   string `json:"model"`
+	Version string `json:"version"`
+}
+
+// parseBroadcastMeta 从广播消息中提取型号、版本、任务 id 和有效期（ttl 字段，毫秒）。
+// 无法解析的消息返回零值，视为发给所有客户端且不过期
+func parseBroadcastMeta(message []byte) broadcastMeta {
+	type taskRef struct {
+		taskKey
+		TaskID string `json:"task_id"`
+	}
+	var envelope struct {
+		Data struct {
+			taskRef
+			Tasks []taskRef `json:"tasks"`
+		} `json:"data"`
+		TTL int64 `json:"ttl"`
+	}
+	var meta broadcastMeta
+	if err := json.Unmarshal(message, &envelope); err != nil {
+		return meta
+	}
+	for _, task := range append([]taskRef{envelope.Data.taskRef}, envelope.Data.Tasks...) {
+		if task.Model != "" || task.Version != "" {
+			meta.tasks = append(meta.tasks, task.taskKey)
+		}
+		if task.TaskID != "" {
+			meta.taskIDs = append(meta.taskIDs, task.TaskID)
+		}
+	}
+	if envelope.TTL > 0 {
+		meta.ttl = time.Duration(envelope.TTL) * time.Millisecond
+	}
+	return meta
+}
+
+// parseTTLParam 解析请求中可选的 ttl 查询参数（毫秒），未提供时返回 0
+func parseTTLParam(r *http.Request) (int64, error) {
+	param := r.URL.Query().Get("ttl")
+	if param == "" {
+		return 0, nil
+	}
+	ttl, err := strconv.ParseInt(param, 10, 64)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("ttl must be a positive integer in milliseconds")
+	}
+	return ttl, nil
+}
+
+// decodeMessage 以 UseNumber 方式解码消息，使数字字段保留为 json.Number，
+// 避免 float64 带来的精度丢失
+func decodeMessage(message []byte) (map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(message))
+	dec.UseNumber()
+	var msgData map[string]interface{}
+	if err := dec.Decode(&msgData); err != nil {
+		return nil, err
+	}
+	return msgData, nil
+}
+
+// 是否拒绝带有未知顶层字段的消息，由 -strict-envelope 配置，默认忽略未知字段
+var strictEnvelope = false
+
+// clientEnvelope 列出客户端消息允许的顶层字段，仅用于严格模式下的字段检查
+type clientEnvelope struct {
+	ProtocolID json.RawMessage `json:"protocol_id"`
+	// protocol_id 的驼峰写法
+	ProtocolIDCamel json.RawMessage `json:"protocolId"`
+	Version         json.RawMessage `json:"version"`
+	ID              json.RawMessage `json:"id"`
+	Hops            json.RawMessage `json:"hops"`
+	Data            json.RawMessage `json:"data"`
+	Timestamp       json.RawMessage `json:"timestamp"`
+	// 复判端可在结果中带回广播的 traceparent
+	Traceparent json.RawMessage `json:"traceparent"`
+	// 配置了 -sign-key 时结果须带有整个信封的签名
+	Signature json.RawMessage `json:"signature"`
+}
+
+// checkEnvelopeFields 检查消息是否只包含 clientEnvelope 中的顶层字段
+func checkEnvelopeFields(message []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(message))
+	dec.DisallowUnknownFields()
+	var envelope clientEnvelope
+	return dec.Decode(&envelope)
+}
+
+// parseProtocolID 将 protocol_id 字段解析为整数。
+// 接受 1、1.0、1e2 等数值上为整数的写法，拒绝 1.5 这类非整数以及超出 int64 范围的值
+func parseProtocolID(v interface{}) (int64, error) {
+	num, ok := v.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("protocol_id must be a number, got %T", v)
+	}
+	if id, err := num.Int64(); err == nil {
+		return id, nil
+	}
+	// 限制指数大小，避免 1e999999999 之类的输入让 big.Rat 分配巨大的内存
+	if i := strings.IndexAny(num.String(), "eE"); i >= 0 {
+		exp, err := strconv.Atoi(num.String()[i+1:])
+		if err != nil || exp > maxProtocolIDExponent || exp < -maxProtocolIDExponent {
+			return 0, fmt.Errorf("protocol_id %s is out of range", num)
+		}
+	}
+	r, ok := new(big.Rat).SetString(num.String())
+	if !ok {
+		return 0, fmt.Errorf("protocol_id %q is not a valid number", num)
+	}
+	if !r.IsInt() {
+		return 0, fmt.Errorf("protocol_id %s is not an integer", num)
+	}
+	if !r.Num().IsInt64() {
+		return 0, fmt.Errorf("protocol_id %s is out of range", num)
+	}
+	return r.Num().Int64(), nil
+}
+
+// replyError 向客户端回复错误消息（protocol_id = protocolError），说明其发送的消息为何被拒绝，
+// 并带回该消息的 id
+func (c *Client) replyError(req Envelope, reason string) {
+	reply, err := json.Marshal(ErrorReply{
+		ProtocolID: protocolError,
+		ID:         req.ID,
+		Data:       ErrorData{ProtocolID: req.ProtocolID, Error: reason},
+	})
+	if err != nil {
+		c.errorf("Error encoding error reply for %s: %v", c.id, err)
+		return
+	}
+	if !c.reply(outMessage{data: reply}) {
+		c.warnf("Error reply to %s dropped, client removed or send buffer full", c.id)
+	}
+}
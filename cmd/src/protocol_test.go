@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestParseProtocolID 对比按 float64 解码与按 json.Number 解析的结果：
+// 整数写法都能精确解析，非整数和超出 int64 范围的值被拒绝，而 float64 会静默截断或丢失精度
+func TestParseProtocolID(t *testing.T) {
+	for _, tc := range []struct {
+		raw  string
+		want int64
+		ok   bool
+		// 旧的 float64 解码得到的值，用于说明差异
+		old float64
+	}{
+		{"1", 1, true, 1},
+		{"1.0", 1, true, 1},
+		{"1e2", 100, true, 100},
+		{"0.5e1", 5, true, 5},
+		{"-3", -3, true, -3},
+		{"1.5", 0, false, 1.5},
+		{"9007199254740993", 9007199254740993, true, 9007199254740992},
+		{"9223372036854775807", 9223372036854775807, true, 9223372036854775808},
+		{"9223372036854775808", 0, false, 9223372036854775808},
+		{"1e65", 0, false, 1e65},
+		{"1e-65", 0, false, 1e-65},
+	} {
+		msg, err := decodeMessage([]byte(`{"protocol_id":` + tc.raw + `}`))
+		if err != nil {
+			t.Fatalf("decode %s: %v", tc.raw, err)
+		}
+		got, err := parseProtocolID(msg["protocol_id"])
+		if tc.ok && (err != nil || got != tc.want) {
+			t.Errorf("parseProtocolID(%s) = %d, %v; want %d", tc.raw, got, err, tc.want)
+		}
+		if !tc.ok && err == nil {
+			t.Errorf("parseProtocolID(%s) = %d, want an error", tc.raw, got)
+		}
+
+		var old map[string]interface{}
+		if err := json.Unmarshal([]byte(`{"protocol_id":`+tc.raw+`}`), &old); err != nil {
+			t.Fatalf("unmarshal %s: %v", tc.raw, err)
+		}
+		if f := old["protocol_id"].(float64); f != tc.old {
+			t.Errorf("float64 decoding of %s gave %v, want %v", tc.raw, f, tc.old)
+		}
+	}
+	for _, v := range []interface{}{"1", float64(1), nil, true} {
+		if _, err := parseProtocolID(v); err == nil {
+			t.Errorf("parseProtocolID(%#v) accepted a non json.Number", v)
+		}
+	}
+}
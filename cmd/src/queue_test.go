@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// TestBroadcastQueueOrder 并发提交的任务在 Hub 忙碌时排队，之后按提交顺序广播
+func TestBroadcastQueueOrder(t *testing.T) {
+	srv := startTestServer(t)
+	client := dialTestClient(t, srv, "")
+	waitClients(t, 1)
+
+	// 占住 run()，让之后的提交都停在广播队列中
+	release := make(chan struct{})
+	busy := make(chan struct{})
+	go hub.query(func() {
+		close(busy)
+		<-release
+	})
+	<-busy
+
+	const n = 10
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			resp, err := http.Post(fmt.Sprintf("%s/tasks?address=/img/%d.jpg&model=m%d&version=v1", srv.URL, i, i), "", nil)
+			if err == nil {
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusAccepted {
+					err = fmt.Errorf("task %d: status %d", i, resp.StatusCode)
+				}
+			}
+			errs <- err
+		}()
+		// 等上一个任务进入队列再发下一个，提交顺序即为 i 的顺序
+		waitFor(t, func() bool { return len(hub.broadcast) == i+1 })
+	}
+	close(release)
+
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < n; i++ {
+		if got := client.RecvProtocol(1).Data["model"]; got != fmt.Sprintf("m%d", i) {
+			t.Fatalf("broadcast %d carried model %v, want m%d", i, got, i)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// ReadMessage 错误的类别
+const (
+	// 对端发送了关闭帧
+	readErrClose = "close"
+	// 在 pongWait 内没有收到任何数据（包括 pong）
+	readErrTimeout = "timeout"
+	// 消息超过读取上限，gorilla 已回复 1009
+	readErrTooBig = "too_big"
+	// 帧格式违反协议，gorilla 已回复 1002
+	readErrProtocol = "protocol"
+	// 连接被重置或未经关闭握手就断开
+	readErrNetwork = "network"
+)
+
+// classifyReadError 判断 ReadMessage 错误的类别，并给出用于统计的关闭码。
+// gorilla/websocket 的读错误都是永久性的，出错后继续读取会 panic，因此无论哪一类都要断开连接，
+// 类别只用于分别记录日志和统计；单条消息内容的问题（非法 JSON 等）在读取成功后处理，不会断开
+func classifyReadError(err error) (kind string, code int) {
+	var closeErr *websocket.CloseError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &closeErr):
+		return readErrClose, closeErr.Code
+	case errors.Is(err, websocket.ErrReadLimit):
+		return readErrTooBig, websocket.CloseMessageTooBig
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return readErrTimeout, websocket.CloseAbnormalClosure
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF), errors.As(err, &netErr):
+		return readErrNetwork, websocket.CloseAbnormalClosure
+	case strings.HasPrefix(err.Error(), "websocket: "):
+		return readErrProtocol, websocket.CloseProtocolError
+	}
+	return readErrNetwork, websocket.CloseAbnormalClosure
+}
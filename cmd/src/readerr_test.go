@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// timeoutError 是超时的 net.Error
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// TestClassifyReadError 各类读错误分别归类并给出统计用的关闭码
+func TestClassifyReadError(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		kind string
+		code int
+	}{
+		{&websocket.CloseError{Code: websocket.CloseGoingAway}, readErrClose, websocket.CloseGoingAway},
+		{fmt.Errorf("read: %w", timeoutError{}), readErrTimeout, websocket.CloseAbnormalClosure},
+		{websocket.ErrReadLimit, readErrTooBig, websocket.CloseMessageTooBig},
+		{io.ErrUnexpectedEOF, readErrNetwork, websocket.CloseAbnormalClosure},
+		{errors.New("websocket: unknown opcode 3"), readErrProtocol, websocket.CloseProtocolError},
+		{errors.New("something else"), readErrNetwork, websocket.CloseAbnormalClosure},
+	} {
+		if kind, code := classifyReadError(tc.err); kind != tc.kind || code != tc.code {
+			t.Errorf("classifyReadError(%v) = %s, %d; want %s, %d", tc.err, kind, code, tc.kind, tc.code)
+		}
+	}
+}
+
+// TestReadTimeout 不回复 ping 的客户端在 pongWait 后以读超时断开，记为 1006；正常关闭的客户端记为关闭码本身
+func TestReadTimeout(t *testing.T) {
+	overrideSettings(t, func(s *Settings) { s.PingPeriodMs = 90 })
+	srv := startTestServer(t)
+	logs := captureLogs(t, "debug")
+	var before StatsSnapshot
+	getJSON(t, srv, "/stats", &before)
+
+	// 不读取就不会处理 ping，也就不会回复 pong
+	dialTestClient(t, srv, "client_id=silent")
+	waitFor(t, func() bool { return logLine(logs, "Read timeout from silent") != "" })
+	waitClients(t, 0)
+
+	closer := dialTestClient(t, srv, "client_id=closer")
+	waitClients(t, 1)
+	closeFrom(t, closer, websocket.CloseGoingAway)
+	if logLine(logs, "level=DEBUG", "Client closed normally closer") == "" {
+		t.Errorf("no normal close line in logs:\n%s", logs)
+	}
+
+	var after StatsSnapshot
+	getJSON(t, srv, "/stats", &after)
+	if after.CloseCodes["1006"]-before.CloseCodes["1006"] != 1 || after.CloseCodes["1001"]-before.CloseCodes["1001"] != 1 {
+		t.Errorf("close_codes %v -> %v, want 1006 and 1001 +1 each", before.CloseCodes, after.CloseCodes)
+	}
+}
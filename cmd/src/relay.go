@@ -0,0 +1,16 @@
+package main
+
+// relayMessage 是需要转发给除发送者以外所有客户端的消息
+type relayMessage struct {
+	sender  *Client
+	payload []byte
+}
+
+// relay 将消息交给 Hub 转发给其他客户端，分片时交给协调者转发给所有分片。Hub 已停止时直接丢弃
+func (h *Hub) relay(sender *Client, payload []byte) {
+	root := h.root()
+	select {
+	case root.broadcastExcept <- relayMessage{sender: sender, payload: payload}:
+	case <-root.done:
+	}
+}
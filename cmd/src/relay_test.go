@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// relayFrame 是客户端收到的转发消息
+type relayFrame struct {
+	ProtocolID int64          `json:"protocol_id"`
+	From       string         `json:"from"`
+	Hops       int64          `json:"hops"`
+	Data       map[string]any `json:"data"`
+}
+
+// TestRelayExcludesSender 转发消息发给除发送者以外的所有客户端，并附带发送者和跳数
+func TestRelayExcludesSender(t *testing.T) {
+	srv := startTestServer(t)
+	sender := dialTestClient(t, srv, "client_id=a")
+	peers := []*testClient{dialTestClient(t, srv, "client_id=b"), dialTestClient(t, srv, "client_id=c")}
+	waitClients(t, 3)
+
+	sender.Send(protocolRelay, map[string]any{"note": "lot 7 done"})
+	for _, peer := range peers {
+		if env := peer.RecvProtocol(protocolRelay); env.Data["note"] != "lot 7 done" || env.Hops != 1 {
+			t.Errorf("peer received %+v, want the note with hops 1", env)
+		}
+	}
+
+	// 转发在回显之前进入 Hub；发送者收到的第一条非握手消息是回显，说明转发没有发回给它
+	sender.Send(protocolRelay, map[string]any{"note": "again"})
+	sender.Send(1, map[string]any{"msg": "after"})
+	for {
+		var frame relayFrame
+		if err := json.Unmarshal(sender.RecvRaw(), &frame); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if frame.ProtocolID == protocolWelcome || frame.ProtocolID == protocolSession {
+			continue
+		}
+		if frame.ProtocolID != 2 {
+			t.Fatalf("sender received %+v, want only its echo", frame)
+		}
+		break
+	}
+	for _, peer := range peers {
+		var frame relayFrame
+		for frame.ProtocolID != protocolRelay {
+			if err := json.Unmarshal(peer.RecvRaw(), &frame); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+		}
+		if frame.From != "a" || frame.Data["note"] != "again" {
+			t.Errorf("peer received %+v, want the note from a", frame)
+		}
+	}
+}
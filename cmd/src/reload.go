@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// accessControl 是可在运行中重新加载的访问控制配置。重新加载时整体替换，
+// 读取方总是看到同一次加载的令牌和来源名单
+type accessControl struct {
+	// 管理接口的访问令牌，为空时管理接口不可用
+	adminToken string
+	// 允许的来源名单，为 nil 时允许所有来源
+	origins *originMatcher
+}
+
+var access atomic.Pointer[accessControl]
+
+// currentAccess 返回当前的访问控制配置，未初始化时管理接口不可用且允许所有来源
+func currentAccess() *accessControl {
+	if a := access.Load(); a != nil {
+		return a
+	}
+	return &accessControl{}
+}
+
+// 启动时的 -config 路径，重新加载时再次读取
+var configFile string
+
+// reloadAccess 重新读取配置文件中的 admin-token 和 allowed-origins 并整体替换，
+// 只影响之后的升级握手和管理请求，已建立的连接不受影响。命令行中显式给出的参数保持不变，
+// 配置文件中删去的项恢复默认值；其他参数仍需重启才能生效
+func reloadAccess() error {
+	if configFile == "" {
+		return fmt.Errorf("no config file, start with -config to enable reloading")
+	}
+	values, err := readConfigFile(configFile)
+	if err != nil {
+		return err
+	}
+	origins, err := parseOriginPatterns(reloadValue(values, "allowed-origins"))
+	if err != nil {
+		return fmt.Errorf("%s: invalid allowed-origins: %v", configFile, err)
+	}
+	access.Store(&accessControl{adminToken: reloadValue(values, "admin-token"), origins: origins})
+	return nil
+}
+
+// reloadValue 返回参数重新加载后的取值：命令行给出的保持原值，否则取配置文件中的值，都没有时为默认值
+func reloadValue(values map[string]string, name string) string {
+	f := flag.Lookup(name)
+	if cmdlineFlags[name] {
+		return f.Value.String()
+	}
+	if v, ok := values[name]; ok {
+		return v
+	}
+	return f.DefValue
+}
+
+// reloadHandler 处理 POST /reload，重新加载配置文件中的访问控制配置，效果与向进程发送 SIGHUP 相同
+func reloadHandler(w http.ResponseWriter, r *http.Request) {
+	ip, port, err := splitRemoteAddr(r.RemoteAddr)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Cannot resolve client address")
+		return
+	}
+	logRequest(r, ip, port)
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	if err := reloadAccess(); err != nil {
+		errorf("Reload config error: %v", err)
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	infof("Access control reloaded from %s", configFile)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok"})
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// registerAccessFlags 注册可重新加载的访问控制参数，main() 之外它们不存在；重复调用不会重复注册
+func registerAccessFlags() {
+	for _, name := range []string{"admin-token", "allowed-origins"} {
+		if flag.Lookup(name) == nil {
+			flag.String(name, "", "")
+		}
+	}
+}
+
+// bearerStatus 以 token 调用管理接口 POST /undrain，返回状态码
+func bearerStatus(t *testing.T, url, token string) int {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url+"/undrain", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("post /undrain: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// TestReload /reload 重新读取配置文件，新的管理令牌和来源名单对之后的请求生效，已有连接不受影响
+func TestReload(t *testing.T) {
+	registerAccessFlags()
+	prev := access.Load()
+	t.Cleanup(func() {
+		access.Store(prev)
+		configFile = ""
+	})
+	srv := startTestServer(t)
+	if status, _ := adminRequest(t, srv, http.MethodPost, "/reload"); status != http.StatusConflict {
+		t.Errorf("reload without -config: status %d, want 409", status)
+	}
+
+	configFile = writeConfig(t, `{"admin-token": "old-token"}`)
+	if err := reloadAccess(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	existing := dialTestClient(t, srv, "")
+	waitClients(t, 1)
+
+	if err := os.WriteFile(configFile, []byte(`{"admin-token": "new-token", "allowed-origins": "*.example.com"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/reload", nil)
+	req.Header.Set("Authorization", "Bearer old-token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("post /reload: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("reload: status %d", resp.StatusCode)
+	}
+
+	if status := bearerStatus(t, srv.URL, "old-token"); status != http.StatusUnauthorized {
+		t.Errorf("old token after reload: status %d, want 401", status)
+	}
+	if status := bearerStatus(t, srv.URL, "new-token"); status != http.StatusOK {
+		t.Errorf("new token after reload: status %d, want 200", status)
+	}
+	header := http.Header{"Origin": {"https://evil.com"}}
+	if _, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", header); err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("origin outside the reloaded list: %v, want 403", err)
+	}
+	postTask(t, srv, "after-reload")
+	if env := existing.RecvProtocol(1); env.Data["model"] != "after-reload" {
+		t.Errorf("existing client received %v, want the task", env.Data)
+	}
+}
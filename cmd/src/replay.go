@@ -0,0 +1,72 @@
+package main
+
+import "net/http"
+
+// ReplayInfo 是 /replay 返回的重放缓冲概况，缓冲为空时序号为 0
+type ReplayInfo struct {
+	Count     int    `json:"count"`
+	Capacity  int    `json:"capacity"`
+	Bytes     int    `json:"bytes"`
+	OldestSeq uint64 `json:"oldest_seq"`
+	NewestSeq uint64 `json:"newest_seq"`
+}
+
+// info 返回缓冲的概况，调用方需持有 Hub.mu
+func (b *replayBuffer) info() ReplayInfo {
+	info := ReplayInfo{Count: len(b.entries), Capacity: b.size}
+	for _, e := range b.entries {
+		info.Bytes += len(e.data)
+	}
+	if len(b.entries) > 0 {
+		info.OldestSeq = b.entries[0].seq
+		info.NewestSeq = b.entries[len(b.entries)-1].seq
+	}
+	return info
+}
+
+// replayInfo 返回重放缓冲的概况
+func (h *Hub) replayInfo() ReplayInfo {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.replay.info()
+}
+
+// clearReplay 清空重放缓冲，返回清除的条数。为无客户端或暂停期间缓冲的广播一并作废，
+// 序号继续递增，已有的续传会话不受影响
+func (h *Hub) clearReplay() int {
+	cleared := 0
+	h.query(func() {
+		h.mu.Lock()
+		cleared = len(h.replay.entries)
+		h.replay.entries = nil
+		h.orphans = nil
+		h.mu.Unlock()
+		h.pauseQueue = nil
+	})
+	return cleared
+}
+
+// replayHandler 处理 /replay：GET 返回重放缓冲的概况，DELETE 清空缓冲（需要管理令牌），
+// 如数据格式变更后丢弃旧格式的广播
+func replayHandler(w http.ResponseWriter, r *http.Request) {
+	ip, port, err := splitRemoteAddr(r.RemoteAddr)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Cannot resolve client address")
+		return
+	}
+	logRequest(r, ip, port)
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, hub.replayInfo())
+	case http.MethodDelete:
+		requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+			cleared := hub.clearReplay()
+			warnf("Replay buffer cleared by %s, %d broadcasts removed", r.RemoteAddr, cleared)
+			writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "cleared": cleared})
+		})(w, r)
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// TestReplayInspectClear GET /replay 返回缓冲的条数和序号范围；DELETE 需要管理令牌，清空后缓冲为空，序号继续递增
+func TestReplayInspectClear(t *testing.T) {
+	srv := startTestServer(t)
+	dialTestClient(t, srv, "")
+	waitClients(t, 1)
+	for i := 0; i < 3; i++ {
+		postTask(t, srv, "m1")
+	}
+
+	var info ReplayInfo
+	if status := getJSON(t, srv, "/replay", &info); status != http.StatusOK {
+		t.Fatalf("GET /replay: status %d", status)
+	}
+	if info.Count != 3 || info.Capacity != defaultReplaySize || info.Bytes == 0 || info.NewestSeq-info.OldestSeq != 2 {
+		t.Fatalf("/replay = %+v, want 3 consecutive broadcasts", info)
+	}
+
+	// 配置了管理令牌但请求未携带时拒绝
+	prev := access.Load()
+	access.Store(&accessControl{adminToken: testAdminToken})
+	req, _ := http.NewRequest(http.MethodDelete, srv.URL+"/replay", nil)
+	resp, err := http.DefaultClient.Do(req)
+	access.Store(prev)
+	if err != nil {
+		t.Fatalf("DELETE /replay: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("DELETE without token: status %d, want 401", resp.StatusCode)
+	}
+
+	status, body := adminRequest(t, srv, http.MethodDelete, "/replay")
+	var cleared struct{ Cleared int }
+	if err := json.Unmarshal(body, &cleared); status != http.StatusOK || err != nil || cleared.Cleared != 3 {
+		t.Fatalf("DELETE /replay: status %d: %s", status, body)
+	}
+	var empty ReplayInfo
+	getJSON(t, srv, "/replay", &empty)
+	if empty.Count != 0 || empty.Bytes != 0 || empty.OldestSeq != 0 || empty.NewestSeq != 0 {
+		t.Fatalf("/replay after clear = %+v, want empty", empty)
+	}
+
+	postTask(t, srv, "m1")
+	var next ReplayInfo
+	getJSON(t, srv, "/replay", &next)
+	if next.Count != 1 || next.OldestSeq != info.NewestSeq+1 {
+		t.Errorf("/replay = %+v, want one broadcast with seq %d", next, info.NewestSeq+1)
+	}
+
+	if status, _ := adminRequest(t, srv, http.MethodPut, "/replay"); status != http.StatusMethodNotAllowed {
+		t.Errorf("PUT /replay: status %d, want 405", status)
+	}
+}
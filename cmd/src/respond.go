@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// acceptsMediaType 判断请求的 Accept 头是否明确列出了指定的媒体类型
+func acceptsMediaType(r *http.Request, mediaType string) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err == nil && mt == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// wantsJSON 判断客户端是否要求 JSON 响应
+func wantsJSON(r *http.Request) bool {
+	return acceptsMediaType(r, "application/json")
+}
+
+// writeJSON 以 JSON 写出响应体
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		errorf("JSON encoding error: %v", err)
+	}
+}
+
+// writeBroadcastResult 写出任务广播成功的响应：要求 JSON 时返回
+// {"status":"ok","broadcasted":N,"delivered":M,"task_ids":[...]}，否则返回原有的纯文本。
+// broadcasted 为任务数，delivered 为收到广播的客户端数
+func writeBroadcastResult(w http.ResponseWriter, r *http.Request, status int, taskIDs []string, delivered int, text string) {
+	if wantsJSON(r) {
+		writeJSON(w, status, map[string]interface{}{
+			"status":      "ok",
+			"broadcasted": len(taskIDs),
+			"delivered":   delivered,
+			"task_ids":    taskIDs,
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprintln(w, text)
+	if delivered == 0 {
+		fmt.Fprintln(w, "No websocket clients received it.")
+	}
+}
+
+// writeSubmitError 写出广播提交失败的响应，均为 503。暂停队列或无客户端队列已满时带上 Retry-After，
+// 提示检测端稍后重试，任务不会被接受后再丢弃
+func writeSubmitError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errPauseQueueFull):
+		w.Header().Set("Retry-After", "30")
+		writeError(w, http.StatusServiceUnavailable, "Broadcasting is paused and the pause queue is full")
+	case errors.Is(err, errOrphanQueueFull):
+		w.Header().Set("Retry-After", "30")
+		writeError(w, http.StatusServiceUnavailable, "No websocket clients connected and the orphan queue is full")
+	default:
+		writeError(w, http.StatusServiceUnavailable, "Service is shutting down")
+	}
+}
+
+// writeError 以 {"error":"...","code":N} 的 JSON 形式写出错误响应，code 与 HTTP 状态码一致
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": message,
+		"code":  status,
+	})
+}
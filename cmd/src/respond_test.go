@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestContentNegotiation /tasks 和 /setting 按 Accept 选择 JSON 或纯文本响应
+func TestContentNegotiation(t *testing.T) {
+	srv := startTestServer(t)
+	for _, tc := range []struct {
+		method, path, accept string
+		json                 bool
+	}{
+		{http.MethodPost, "/tasks?address=/img/1.jpg&model=m1&version=v1", "", false},
+		{http.MethodPost, "/tasks?address=/img/1.jpg&model=m1&version=v1", "text/plain", false},
+		{http.MethodPost, "/tasks?address=/img/1.jpg&model=m1&version=v1", "application/json", true},
+		{http.MethodPost, "/tasks?address=/img/1.jpg&model=m1&version=v1", "text/html, application/json;q=0.9", true},
+		{http.MethodGet, "/setting", "", true},
+		{http.MethodGet, "/setting", "text/plain", false},
+		{http.MethodGet, "/setting", "text/plain, application/json", true},
+	} {
+		req, err := http.NewRequest(tc.method, srv.URL+tc.path, nil)
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		if tc.accept != "" {
+			req.Header.Set("Accept", tc.accept)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", tc.method, tc.path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		name := tc.method + " " + tc.path + " Accept " + tc.accept
+		contentType := resp.Header.Get("Content-Type")
+
+		if !tc.json {
+			if !strings.HasPrefix(contentType, "text/plain") || json.Valid(body) {
+				t.Errorf("%s: %s %q, want plain text", name, contentType, body)
+			}
+			continue
+		}
+		var result map[string]any
+		if !strings.HasPrefix(contentType, "application/json") || json.Unmarshal(body, &result) != nil {
+			t.Errorf("%s: %s %q, want JSON", name, contentType, body)
+			continue
+		}
+		if strings.HasPrefix(tc.path, "/tasks") && (result["status"] != "ok" || result["broadcasted"] != float64(1)) {
+			t.Errorf("%s: %v, want status ok and broadcasted 1", name, result)
+		}
+		if tc.path == "/setting" && result["ping_period_ms"] == nil {
+			t.Errorf("%s: %v, want the settings", name, result)
+		}
+	}
+}
+
+// TestJSONErrors /tasks、/setting、客户端查询、长轮询和 /ws 升级前的失败响应都是 {"error":...,"code":...} 形式的 JSON，code 与状态码一致
+func TestJSONErrors(t *testing.T) {
+	srv := startTestServer(t)
+	prev := access.Load()
+	access.Store(&accessControl{adminToken: testAdminToken})
+	defer access.Store(prev)
+	// 所有请求都带管理令牌，检查的是令牌之后的参数校验
+	check := func(method, path, body string, want int) {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testAdminToken)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		var result struct {
+			Error string `json:"error"`
+			Code  int    `json:"code"`
+		}
+		if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+			t.Errorf("%s %s: content type %q, want JSON", method, path, resp.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Errorf("%s %s: body is not JSON: %v", method, path, err)
+			return
+		}
+		if resp.StatusCode != want || result.Code != want || result.Error == "" {
+			t.Errorf("%s %s = %d %+v, want %d with matching code and a message", method, path, resp.StatusCode, result, want)
+		}
+	}
+
+	check(http.MethodPost, "/tasks?address=/img/1.jpg", "", http.StatusBadRequest)
+	check(http.MethodPost, "/tasks?address=/img/1.jpg&model=m1&version=v1&ttl=soon", "", http.StatusBadRequest)
+	check(http.MethodPost, "/tasks?address=/img/1.jpg&model=m1&version=v1&min_age=old", "", http.StatusBadRequest)
+	check(http.MethodPost, "/tasks?address=/img/1.jpg&model=m1&version=v1&inspector_id=a%20b", "", http.StatusBadRequest)
+	check(http.MethodPut, "/setting", "{", http.StatusBadRequest)
+	check(http.MethodPut, "/setting", `{"max_clients":-1}`, http.StatusBadRequest)
+	check(http.MethodDelete, "/setting", "", http.StatusMethodNotAllowed)
+	check(http.MethodGet, "/clients/exists", "", http.StatusBadRequest)
+	check(http.MethodPost, "/ping-client", "", http.StatusBadRequest)
+	check(http.MethodPost, "/ping-client?id=reviewer-1&timeout_ms=soon", "", http.StatusBadRequest)
+	check(http.MethodPost, "/ping-client?id=nobody", "", http.StatusNotFound)
+	check(http.MethodGet, "/poll", "", http.StatusBadRequest)
+	check(http.MethodGet, "/ws?client_id=a%20b", "", http.StatusBadRequest)
+	check(http.MethodGet, "/ws", "", http.StatusBadRequest)
+
+	draining.Store(true)
+	check(http.MethodPost, "/tasks?address=/img/1.jpg&model=m1&version=v1", "", http.StatusServiceUnavailable)
+	check(http.MethodGet, "/ws", "", http.StatusServiceUnavailable)
+	draining.Store(false)
+	defer func(saved string) { pauseMode = saved }(pauseMode)
+	pauseMode = pauseReject
+	hub.setPaused(true)
+	check(http.MethodPost, "/tasks?address=/img/1.jpg&model=m1&version=v1", "", http.StatusServiceUnavailable)
+	hub.setPaused(false)
+}
@@ -0,0 +1,61 @@
+package main
+
+// 结果处理池的默认规模
+const (
+	defaultResultWorkers = 4
+	defaultResultQueue   = 256
+)
+
+// resultJob 是待处理的一条复判结果
+type resultJob struct {
+	client  *Client
+	message []byte
+	// 为 true 时是待转发的进度消息，只投递 webhook
+	progress bool
+}
+
+// 待处理结果的队列，为 nil 时在 readPump 中直接处理
+var resultJobs chan resultJob
+
+// startResultWorkers 启动 workers 个 goroutine 处理复判结果，使 readPump 不被结果处理阻塞
+func startResultWorkers(workers, queue int) {
+	resultJobs = make(chan resultJob, queue)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range resultJobs {
+				if job.progress {
+					postResult(job.message)
+					continue
+				}
+				job.client.handleResult(job.message)
+			}
+		}()
+	}
+}
+
+// submitResult 将结果交给处理池，队列已满时丢弃并记录日志，不阻塞读取
+func (c *Client) submitResult(message []byte) {
+	if resultJobs == nil {
+		c.handleResult(message)
+		return
+	}
+	select {
+	case resultJobs <- resultJob{client: c, message: message}:
+	default:
+		stats.droppedResults.Add(1)
+		c.errorf("Result from %s dropped, result queue full: %s", c.id, logPayload(message))
+	}
+}
+
+// submitProgress 将进度消息交给处理池转发到 webhook，队列已满时丢弃，进度不影响任务结果
+func (c *Client) submitProgress(message []byte) {
+	if resultJobs == nil {
+		postResult(message)
+		return
+	}
+	select {
+	case resultJobs <- resultJob{client: c, message: message, progress: true}:
+	default:
+		c.warnf("Progress from %s not forwarded, result queue full", c.id)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestResultWorkers 结果回调缓慢时同一客户端的后续消息照常处理；处理池和队列都占满时新结果被丢弃并计数
+func TestResultWorkers(t *testing.T) {
+	t.Cleanup(func() {
+		resultJobs = nil
+		resultWebhook = ""
+	})
+	arrived := make(chan struct{}, 4)
+	release := make(chan struct{})
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-release
+	}))
+	defer webhook.Close()
+	var once sync.Once
+	unblock := func() { once.Do(func() { close(release) }) }
+	defer unblock()
+	resultWebhook = webhook.URL
+	startResultWorkers(1, 1)
+	srv := startTestServer(t)
+	client := dialTestClient(t, srv, "")
+	waitClients(t, 1)
+
+	result := map[string]any{"host": "10.0.0.1", "target": "/img/1.jpg"}
+	client.Send(2, result)
+	select {
+	case <-arrived:
+	case <-time.After(testRecvTimeout):
+		t.Fatal("result never reached the webhook")
+	}
+	// 唯一的 worker 阻塞在回调中，读取不受影响
+	client.Send(1, map[string]any{"msg": "still reading"})
+	if env := client.RecvProtocol(2); env.Data["msg"] != "still reading"+echoSuffix {
+		t.Fatalf("echo %v, want the message echoed while the webhook is blocked", env.Data)
+	}
+
+	dropped := stats.droppedResults.Load()
+	client.Send(2, result)
+	client.Send(2, result)
+	waitFor(t, func() bool { return stats.droppedResults.Load() == dropped+1 })
+	// 放行回调后排队的结果随即被处理
+	unblock()
+	select {
+	case <-arrived:
+	case <-time.After(testRecvTimeout):
+		t.Fatal("queued result never reached the webhook")
+	}
+
+	client.conn.Close()
+	waitClients(t, 0)
+}
+
+// TestDuplicateResult 默认只采纳任务的第一个结果，重复的结果记录警告后忽略；策略为 last 时后到的结果覆盖之前的结果
+func TestDuplicateResult(t *testing.T) {
+	t.Cleanup(func() { resultPolicy = resultFirst })
+	srv := startTestServer(t)
+	first := dialTestClient(t, srv, "client_id=reviewer-1")
+	second := dialTestClient(t, srv, "client_id=reviewer-2")
+	waitClients(t, 2)
+	logs := captureLogs(t, "warn")
+
+	id := postTask(t, srv, "m1")
+	var task InspectorResult
+	if err := first.RecvProtocol(1).decodeData(&task); err != nil {
+		t.Fatalf("decode task: %v", err)
+	}
+	second.RecvProtocol(1)
+	first.Send(2, task)
+	waitFor(t, func() bool {
+		record, _ := tasks.get(id)
+		return record.Status == taskCompleted
+	})
+	kept, _ := tasks.get(id)
+	second.Send(2, task)
+	waitFor(t, func() bool { return logLine(logs, "Ignored duplicate result from reviewer-2", id) != "" })
+	if record, _ := tasks.get(id); record.Reviewer != "reviewer-1" || !record.CompletedAt.Equal(*kept.CompletedAt) {
+		t.Errorf("duplicate replaced the first result: reviewer %q completed %v", record.Reviewer, record.CompletedAt)
+	}
+
+	resultPolicy = resultLast
+	second.Send(2, task)
+	waitFor(t, func() bool {
+		record, _ := tasks.get(id)
+		return record.Reviewer == "reviewer-2"
+	})
+}
+
+// TestParseResultPolicy 只接受 first 和 last
+func TestParseResultPolicy(t *testing.T) {
+	for _, policy := range []string{resultFirst, resultLast} {
+		if got, err := parseResultPolicy(policy); err != nil || got != policy {
+			t.Errorf("parseResultPolicy(%q) = %q, %v", policy, got, err)
+		}
+	}
+	if _, err := parseResultPolicy("all"); err == nil {
+		t.Error("parseResultPolicy accepted all")
+	}
+}
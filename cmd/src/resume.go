@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// 默认保留的最近广播条数
+const defaultReplaySize = 256
+
+// 断线后续传令牌的默认有效期
+const defaultResumeTTL = 2 * time.Minute
+
+// outMessage 是写入客户端 send 通道的消息，seq 为广播序号，非广播消息为 0
+type outMessage struct {
+	seq  uint64
+	data []byte
+	// WebSocket 帧类型，0 视为 websocket.TextMessage
+	msgType int
+	// Hub 分发的时间和有效期，ttl 为 0 时永不过期
+	sentAt time.Time
+	ttl    time.Duration
+	// 为 priorityHigh 时放入客户端的 sendHigh 通道
+	priority priority
+	// 广播时预先编码的帧，由协商了压缩的客户端共享，整个广播只压缩一次；为 nil 时按 data 写出
+	prepared *websocket.PreparedMessage
+}
+
+// frameType 返回写出该消息使用的帧类型
+func (m outMessage) frameType() int {
+	if m.msgType == 0 {
+		return websocket.TextMessage
+	}
+	return m.msgType
+}
+
+// standalone 判断消息是否需要单独成帧写出，二进制消息和预编码的消息都不与其他消息合并
+func (m outMessage) standalone() bool {
+	return m.frameType() != websocket.TextMessage || m.prepared != nil
+}
+
+// expired 判断消息在写出前是否已超过有效期
+func (m outMessage) expired(now time.Time) bool {
+	return m.ttl > 0 && now.Sub(m.sentAt) > m.ttl
+}
+
+// replayEntry 是重放缓冲中的一条广播
+type replayEntry struct {
+	seq     uint64
+	data    []byte
+	msgType int
+	// 广播最初分发的时间和元信息，补发时按原来的有效期和接收者筛选条件判断
+	sentAt time.Time
+	meta   broadcastMeta
+}
+
+// newReplayEntry 解析广播的元信息并记下分发时间，序号由 record 分配。
+// 二进制消息没有元信息，发给所有客户端且不过期
+func newReplayEntry(msgType int, message []byte, age ageRange) replayEntry {
+	e := replayEntry{data: message, msgType: msgType, sentAt: time.Now()}
+	if msgType == websocket.TextMessage {
+		e.meta = parseBroadcastMeta(message)
+	}
+	e.meta.age = age
+	return e
+}
+
+// outMessage 将重放记录转换为待发送的消息，保留最初的分发时间和有效期
+func (e replayEntry) outMessage() outMessage {
+	return outMessage{seq: e.seq, data: e.data, msgType: e.msgType, sentAt: e.sentAt, ttl: e.meta.ttl}
+}
+
+// replayBuffer 保留最近的若干条广播，供断线重连的客户端补发。只在持有 Hub.mu 时访问
+type replayBuffer struct {
+	entries []replayEntry
+	size    int
+}
+
+func newReplayBuffer(size int) *replayBuffer {
+	return &replayBuffer{size: size}
+}
+
+// add 追加一条广播，超出容量时丢弃最旧的记录
+func (b *replayBuffer) add(e replayEntry) {
+	if b.size <= 0 {
+		return
+	}
+	if len(b.entries) == b.size {
+		copy(b.entries, b.entries[1:])
+		b.entries = b.entries[:len(b.entries)-1]
+	}
+	b.entries = append(b.entries, e)
+}
+
+// since 返回序号大于 seq 的所有广播
+func (b *replayBuffer) since(seq uint64) []replayEntry {
+	for i, e := range b.entries {
+		if e.seq > seq {
+			return b.entries[i:]
+		}
+	}
+	return nil
+}
+
+// session 记录一个续传令牌对应的投递进度
+type session struct {
+	token string
+	// 已写入连接的最大广播序号，由 writePump 更新
+	lastSeq atomic.Uint64
+	// 以下字段只在持有 Hub.mu 时访问
+	active    bool
+	expiresAt time.Time
+	// 断线时客户端的订阅和能力声明，续传时恢复，补发按断线前的声明筛选
+	subscriptions subscriptionSet
+	capabilities  []taskKey
+}
+
+// sessionNotice 是下发给客户端的续传令牌消息（protocol_id = protocolSession）
+type sessionNotice struct {
+	ResumeToken string `json:"resume_token"`
+	LastSeq     uint64 `json:"last_seq"`
+	Resumed     bool   `json:"resumed"`
+}
+
+// attachSession 为新注册的客户端绑定续传会话，只能在 run() 中调用。
+// 客户端携带的令牌有效且未被其他连接占用时，先恢复断线前的订阅和能力声明，再从重放缓冲补发断线期间错过的广播，
+// 与实时广播一样按订阅、能力声明和连接时长筛选，已过期的不再补发；否则签发新的令牌。
+// 无客户端队列中已补发给该客户端的广播随即移出队列，其余的与新连接一样交给 replayOrphans。
+// 会话、重放缓冲和无客户端队列在分片时由协调者保存，调用方需持有 h.root().mu
+func (h *Hub) attachSession(client *Client) {
+	state := h.root()
+	now := time.Now()
+	for token, s := range state.sessions {
+		if !s.active && now.After(s.expiresAt) {
+			delete(state.sessions, token)
+		}
+	}
+
+	s, ok := state.sessions[client.resumeToken]
+	resumed := ok && !s.active
+	if !resumed {
+		if client.resumeToken != "" {
+			client.infof("Resume token unknown or in use, issuing a new one")
+		}
+		s = &session{token: randomHex(16)}
+		s.lastSeq.Store(state.seq)
+		state.sessions[s.token] = s
+	}
+	s.active = true
+	client.session = s
+
+	notice, err := json.Marshal(map[string]interface{}{
+		"protocol_id": protocolSession,
+		"data": sessionNotice{
+			ResumeToken: s.token,
+			LastSeq:     s.lastSeq.Load(),
+			Resumed:     resumed,
+		},
+	})
+	if err != nil {
+		client.errorf("Error encoding session notice: %v", err)
+		return
+	}
+	client.send <- outMessage{data: notice}
+
+	if !resumed {
+		state.replayOrphans(client, now)
+		return
+	}
+	h.joinRooms(client, s.subscriptions)
+	client.capabilities = s.capabilities
+	missed := state.replay.since(s.lastSeq.Load())
+	client.infof("Client resumed from seq %d, %d broadcasts missed", s.lastSeq.Load(), len(missed))
+	replayed := make(map[uint64]bool, len(missed))
+	for _, e := range missed {
+		out := e.outMessage()
+		if !e.meta.accepts(client, now) || out.expired(now) {
+			continue
+		}
+		select {
+		case client.send <- out:
+			h.countRetries(e.data)
+			replayed[e.seq] = true
+		default:
+			client.countDrop()
+			client.warnf("Replay stopped at seq %d, send buffer full", e.seq)
+			state.dropOrphans(replayed)
+			return
+		}
+	}
+	state.dropOrphans(replayed)
+	state.replayOrphans(client, now)
+}
+
+// dropOrphans 将已经补发出去的广播移出无客户端队列，避免下一个连接的客户端重复收到，调用方需持有 h.mu
+func (h *Hub) dropOrphans(delivered map[uint64]bool) {
+	if len(delivered) == 0 || len(h.orphans) == 0 {
+		return
+	}
+	kept := h.orphans[:0]
+	for _, e := range h.orphans {
+		if !delivered[e.seq] {
+			kept = append(kept, e)
+		}
+	}
+	h.orphans = kept
+}
+
+// replayOrphans 将无客户端在线期间缓冲的广播补发给新连接的客户端，每条只补发一次。
+// 已过期的广播直接丢弃；该客户端不接收的和发送缓冲放不下的部分留在队列中，交给下一个连接的客户端。
+// 调用方需持有 h.mu
+func (h *Hub) replayOrphans(client *Client, now time.Time) {
+	if len(h.orphans) == 0 {
+		return
+	}
+	client.infof("Delivering %d broadcasts buffered while no clients were connected", len(h.orphans))
+	var kept []replayEntry
+	for i, e := range h.orphans {
+		out := e.outMessage()
+		if out.expired(now) {
+			continue
+		}
+		if !e.meta.accepts(client, now) {
+			kept = append(kept, e)
+			continue
+		}
+		select {
+		case client.send <- out:
+		default:
+			kept = append(kept, h.orphans[i:]...)
+			client.warnf("Buffered delivery stopped at seq %d, send buffer full, %d kept for the next client", e.seq, len(kept))
+			h.orphans = kept
+			return
+		}
+	}
+	h.orphans = kept
+}
+
+// detachSession 在客户端移除时释放其会话并保存订阅和能力声明，令牌在 resumeTTL 内可用于重连续传。
+// 需在 leaveRooms 清空订阅之前调用，调用方需持有 h.root().mu
+func (h *Hub) detachSession(client *Client) {
+	if client.session == nil {
+		return
+	}
+	client.session.active = false
+	client.session.expiresAt = time.Now().Add(h.root().resumeTTL)
+	client.session.subscriptions = client.subscriptions
+	client.session.capabilities = client.capabilities
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// sessionOf 读取客户端收到的续传令牌消息
+func sessionOf(t *testing.T, client *testClient) sessionNotice {
+	t.Helper()
+	var notice sessionNotice
+	if err := client.RecvProtocol(protocolSession).decodeData(&notice); err != nil {
+		t.Fatalf("decode session notice: %v", err)
+	}
+	return notice
+}
+
+// TestResumeToken 断线后带令牌重连，从最后写出的广播之后续传；令牌被占用或过期时签发新令牌
+func TestResumeToken(t *testing.T) {
+	srv := startTestServer(t)
+	stay := dialTestClient(t, srv, "client_id=stay")
+	away := dialTestClient(t, srv, "client_id=away")
+	waitClients(t, 2)
+	first := sessionOf(t, away)
+	if first.ResumeToken == "" || first.Resumed {
+		t.Fatalf("first session notice %+v, want a new token", first)
+	}
+
+	postTask(t, srv, "m1")
+	if env := away.RecvProtocol(1); env.Data["model"] != "m1" {
+		t.Fatalf("received %v, want m1", env.Data)
+	}
+	// 令牌仍被在线连接占用时不能续传
+	if busy := sessionOf(t, dialTestClient(t, srv, "resume_token="+first.ResumeToken)); busy.Resumed || busy.ResumeToken == first.ResumeToken {
+		t.Errorf("token in use was resumed: %+v", busy)
+	}
+	away.conn.Close()
+	waitClients(t, 2)
+
+	postTask(t, srv, "m2")
+	postTask(t, srv, "m3")
+	stay.RecvProtocol(1)
+	stay.RecvProtocol(1)
+
+	back := dialTestClient(t, srv, "resume_token="+first.ResumeToken)
+	resumed := sessionOf(t, back)
+	if !resumed.Resumed || resumed.ResumeToken != first.ResumeToken || resumed.LastSeq <= first.LastSeq {
+		t.Fatalf("resumed notice %+v, want the same token resumed after seq %d", resumed, first.LastSeq)
+	}
+	for _, model := range []string{"m2", "m3"} {
+		if env := back.RecvProtocol(1); env.Data["model"] != model {
+			t.Fatalf("replayed %v, want %s", env.Data, model)
+		}
+	}
+
+	// 令牌过期后重连得到新的令牌，不再续传
+	hub.query(func() { hub.resumeTTL = 0 })
+	back.conn.Close()
+	waitClients(t, 2)
+	postTask(t, srv, "m4")
+	stay.RecvProtocol(1)
+	expired := dialTestClient(t, srv, "resume_token="+first.ResumeToken)
+	if notice := sessionOf(t, expired); notice.Resumed || notice.ResumeToken == first.ResumeToken {
+		t.Errorf("expired token was resumed: %+v", notice)
+	}
+	postTask(t, srv, "m5")
+	if env := expired.RecvProtocol(1); env.Data["model"] != "m5" {
+		t.Errorf("received %v after an expired token, want only new broadcasts", env.Data)
+	}
+}
+
+// TestResumeFilters 续传补发与实时广播使用相同的筛选：已过期的和连接时长不符的广播不补发
+func TestResumeFilters(t *testing.T) {
+	srv := startTestServer(t)
+	dialTestClient(t, srv, "client_id=stay")
+	away := dialTestClient(t, srv, "client_id=away")
+	waitClients(t, 2)
+	token := sessionOf(t, away).ResumeToken
+	away.conn.Close()
+	waitClients(t, 1)
+
+	for _, query := range []string{"model=expired&ttl=1", "model=veteran&min_age=1h", "model=fresh"} {
+		resp, err := http.Post(srv.URL+"/tasks?address=/img/1.jpg&version=v1&"+query, "", nil)
+		if err != nil {
+			t.Fatalf("post task: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("post task %s: status %d", query, resp.StatusCode)
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	back := dialTestClient(t, srv, "resume_token="+token)
+	if notice := sessionOf(t, back); !notice.Resumed {
+		t.Fatalf("session notice %+v, want resumed", notice)
+	}
+	if env := back.RecvProtocol(1); env.Data["model"] != "fresh" {
+		t.Fatalf("replayed %v, want only the fresh task", env.Data)
+	}
+}
+
+// TestResumeOrphans 无客户端在线期间的广播补发给续传的客户端后移出无客户端队列，下一个连接的客户端不再重复收到
+func TestResumeOrphans(t *testing.T) {
+	srv := startTestServer(t)
+	away := dialTestClient(t, srv, "client_id=away")
+	waitClients(t, 1)
+	token := sessionOf(t, away).ResumeToken
+	away.conn.Close()
+	waitClients(t, 0)
+
+	postTask(t, srv, "m1")
+	back := dialTestClient(t, srv, "client_id=away&resume_token="+token)
+	if env := back.RecvProtocol(1); env.Data["model"] != "m1" {
+		t.Fatalf("replayed %v, want m1", env.Data)
+	}
+
+	next := dialTestClient(t, srv, "client_id=next")
+	waitClients(t, 2)
+	postTask(t, srv, "m2")
+	if env := next.RecvProtocol(1); env.Data["model"] != "m2" {
+		t.Fatalf("next client received %v, want only the new m2 task", env.Data)
+	}
+}
+
+// TestResumeKeepsSubscriptions 续传的客户端沿用断线前的订阅，补发按订阅筛选
+func TestResumeKeepsSubscriptions(t *testing.T) {
+	srv := startTestServer(t)
+	dialTestClient(t, srv, "client_id=stay")
+	away := dialTestClient(t, srv, "client_id=away")
+	waitClients(t, 2)
+	token := sessionOf(t, away).ResumeToken
+	away.Send(protocolSubscribe, map[string]any{"models": []string{"m1"}})
+	waitFor(t, func() bool { return len(hub.listRooms()) == 1 })
+	away.conn.Close()
+	waitClients(t, 1)
+
+	postTask(t, srv, "m2")
+	postTask(t, srv, "m1")
+	back := dialTestClient(t, srv, "client_id=away&resume_token="+token)
+	if env := back.RecvProtocol(1); env.Data["model"] != "m1" {
+		t.Fatalf("replayed %v, want only the subscribed m1 task", env.Data)
+	}
+	if rooms := hub.listRooms(); len(rooms) != 1 || rooms[0].Model != "m1" || rooms[0].Members != 1 {
+		t.Errorf("rooms %+v after resume, want m1 with one member", rooms)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// 建议客户端重连等待时间的默认下限和上限
+const (
+	defaultRetryAfterMin = 5 * time.Second
+	defaultRetryAfterMax = time.Minute
+)
+
+// 因容量不足拒绝或断开客户端时建议的重连等待时间范围，由 -retry-after-min 和 -retry-after-max 配置。
+// 负载越高等待越久，满载时为上限
+var (
+	retryAfterMin = defaultRetryAfterMin
+	retryAfterMax = defaultRetryAfterMax
+)
+
+// serverLoad 返回当前负载，取在线连接数占 MaxClients 的比例与升级握手槽位占用率中的较大者，范围 [0, 1]
+func serverLoad(current Settings) float64 {
+	load := 0.0
+	if current.MaxClients > 0 {
+		load = float64(stats.currentConnections.Load()) / float64(current.MaxClients)
+	}
+	if upgradeSlots != nil && cap(upgradeSlots) > 0 {
+		load = math.Max(load, float64(len(upgradeSlots))/float64(cap(upgradeSlots)))
+	}
+	return math.Min(load, 1)
+}
+
+// retryAfterSeconds 按当前负载计算建议的重连等待秒数，并加上至多 10% 的随机抖动，
+// 避免被同时断开的客户端在同一时刻重连
+func retryAfterSeconds() int {
+	wait := retryAfterMin + time.Duration(float64(retryAfterMax-retryAfterMin)*serverLoad(settings.get()))
+	wait += time.Duration(rand.Int64N(int64(wait)/10 + 1))
+	return int(math.Ceil(wait.Seconds()))
+}
+
+// rejectForCapacity 以 503 拒绝升级请求，并通过 Retry-After 头提示客户端等待多久再重连
+func rejectForCapacity(w http.ResponseWriter, msg string) {
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds()))
+	writeError(w, http.StatusServiceUnavailable, msg)
+}
+
+// closeMessage 返回 writePump 结束时发送的关闭帧。因容量原因被移除的客户端收到 1013（Try Again Later），
+// 关闭原因中带有 retry_after 秒数；超过最长存活时间的客户端收到 1012（Service Restart）；
+// 被迁移的客户端收到 1001（Going Away）
+func (c *Client) closeMessage() []byte {
+	if c.migrated {
+		return websocket.FormatCloseMessage(websocket.CloseGoingAway, "migrated")
+	}
+	if c.expired.Load() {
+		return websocket.FormatCloseMessage(websocket.CloseServiceRestart, "max connection lifetime reached, reconnect please")
+	}
+	if c.retryAfter > 0 {
+		return websocket.FormatCloseMessage(websocket.CloseTryAgainLater, fmt.Sprintf("retry_after=%d", c.retryAfter))
+	}
+	return []byte{}
+}
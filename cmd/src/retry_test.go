@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestRetryAfterRejected 达到 MaxClients 时升级请求得到 503，Retry-After 按满载取上限加抖动
+func TestRetryAfterRejected(t *testing.T) {
+	saved := settings.get()
+	t.Cleanup(func() {
+		settings.mu.Lock()
+		settings.current = saved
+		settings.mu.Unlock()
+	})
+	srv := startTestServer(t)
+	if status, _ := putSettings(t, srv, `{"max_clients":1}`); status != http.StatusOK {
+		t.Fatalf("PUT /setting status %d", status)
+	}
+	dialTestClient(t, srv, "")
+	waitClients(t, 1)
+
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", nil)
+	if err == nil {
+		conn.Close()
+		t.Fatal("connection beyond max_clients accepted")
+	}
+	if resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("response %v, want 503", resp)
+	}
+	retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	maxWait := int(retryAfterMax.Seconds())
+	if err != nil || retryAfter < maxWait || retryAfter > maxWait+maxWait/10+1 {
+		t.Errorf("Retry-After %q, want about %ds at full load", resp.Header.Get("Retry-After"), maxWait)
+	}
+}
+
+// TestRetryAfterDropped 发送缓冲已满被移除的客户端收到 1013 关闭帧，原因中带有 retry_after 秒数
+func TestRetryAfterDropped(t *testing.T) {
+	srv := startTestServer(t)
+	client, ws := dialFaulty(t, srv)
+
+	ws.hold.Lock()
+	postTask(t, srv, "first")
+	waitFor(t, func() bool { return ws.waiting.Load() == 1 })
+	for i := 0; ; i++ {
+		if i > 1000 {
+			t.Fatal("client never dropped")
+		}
+		if delivered, _ := hub.submit([]byte(`{"protocol_id":1,"data":{}}`), priorityNormal); delivered == 0 {
+			break
+		}
+	}
+	ws.hold.Unlock()
+
+	for {
+		client.conn.SetReadDeadline(time.Now().Add(testRecvTimeout))
+		_, _, err := client.conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		closeErr, ok := err.(*websocket.CloseError)
+		if !ok || closeErr.Code != websocket.CloseTryAgainLater || !strings.HasPrefix(closeErr.Text, "retry_after=") {
+			t.Fatalf("read error %v, want close 1013 with retry_after", err)
+		}
+		break
+	}
+}
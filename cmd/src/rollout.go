@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// 是否处于下线排空状态：拒绝新的 WebSocket 连接和任务，已有连接照常工作，
+// 负载均衡通过 /readyz 得知后不再路由新流量，用于滚动发布
+var draining atomic.Bool
+
+// drainChanges 在排空状态每次变化时关闭 ch 并换上新的通道，供 NATS 订阅等后台任务等待状态变化
+var drainChanges = struct {
+	sync.Mutex
+	ch chan struct{}
+}{ch: make(chan struct{})}
+
+// setDrainState 设置排空状态并通知等待 drainChanged 的一方
+func setDrainState(on bool) {
+	draining.Store(on)
+	drainChanges.Lock()
+	defer drainChanges.Unlock()
+	close(drainChanges.ch)
+	drainChanges.ch = make(chan struct{})
+}
+
+// drainChanged 返回在排空状态下一次变化时关闭的通道，调用方应在读取 draining 之前取得该通道，以免错过变化
+func drainChanged() <-chan struct{} {
+	drainChanges.Lock()
+	defer drainChanges.Unlock()
+	return drainChanges.ch
+}
+
+// rejectIfDraining 在排空期间以 503 拒绝新的任务或连接，返回 true 表示请求已被拒绝
+func rejectIfDraining(w http.ResponseWriter) bool {
+	if !draining.Load() {
+		return false
+	}
+	writeError(w, http.StatusServiceUnavailable, "Server is draining")
+	return true
+}
+
+// hubReady 判断 Hub 的 run() 是否已开始处理请求
+func hubReady() bool {
+	if hub == nil {
+		return false
+	}
+	select {
+	case <-hub.started:
+		return true
+	default:
+		return false
+	}
+}
+
+// rejectIfNotReady 在 Hub 启动完成前以 503 拒绝任务，避免请求阻塞在无人处理的广播队列上，
+// 返回 true 表示请求已被拒绝
+func rejectIfNotReady(w http.ResponseWriter) bool {
+	if hubReady() {
+		return false
+	}
+	w.Header().Set("Retry-After", "1")
+	writeError(w, http.StatusServiceUnavailable, "Server is not ready")
+	return true
+}
+
+// drainHandler 进入排空状态，已连接的客户端继续接收广播直到自行断开
+func drainHandler(w http.ResponseWriter, r *http.Request) {
+	setDraining(w, r, true)
+}
+
+// undrainHandler 退出排空状态，恢复接受新的连接和任务
+func undrainHandler(w http.ResponseWriter, r *http.Request) {
+	setDraining(w, r, false)
+}
+
+func setDraining(w http.ResponseWriter, r *http.Request, on bool) {
+	ip, port, err := splitRemoteAddr(r.RemoteAddr)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Cannot resolve client address")
+		return
+	}
+	logRequest(r, ip, port)
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	setDrainState(on)
+	if on {
+		warnf("Server draining, new connections and tasks are refused, %d clients still connected", stats.currentConnections.Load())
+	} else {
+		infof("Server undrained, accepting new connections and tasks")
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "draining": on})
+}
+
+// readyzHandler 供负载均衡判断是否继续路由新流量，Hub 启动完成前和排空期间返回 503
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	ip, port, err := splitRemoteAddr(r.RemoteAddr)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Cannot resolve client address")
+		return
+	}
+	logRequest(r, ip, port)
+	if !hubReady() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "starting"})
+		return
+	}
+	if draining.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{"status": "draining", "clients": stats.currentConnections.Load()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestDrain /drain 后 /readyz、新连接和新任务都返回 503，已有客户端仍收到广播；/undrain 后恢复
+func TestDrain(t *testing.T) {
+	t.Cleanup(func() { draining.Store(false) })
+	srv := startTestServer(t)
+	client := dialTestClient(t, srv, "")
+	waitClients(t, 1)
+	status := func(method, path string) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	dial := func() int {
+		t.Helper()
+		conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", nil)
+		if err == nil {
+			conn.Close()
+		}
+		if resp == nil {
+			t.Fatalf("dial: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	if code, body := adminRequest(t, srv, http.MethodPost, "/drain"); code != http.StatusOK {
+		t.Fatalf("POST /drain: status %d: %s", code, body)
+	}
+	if code := status(http.MethodGet, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz while draining: %d, want 503", code)
+	}
+	if code := dial(); code != http.StatusServiceUnavailable {
+		t.Errorf("upgrade while draining: %d, want 503", code)
+	}
+	if code := status(http.MethodPost, "/tasks?address=/img/1.jpg&model=m1&version=v1"); code != http.StatusServiceUnavailable {
+		t.Errorf("/tasks while draining: %d, want 503", code)
+	}
+	if code, body := adminRequestBody(t, srv, http.MethodPost, "/announce", `{"message":"moving"}`); code != http.StatusOK {
+		t.Fatalf("announce while draining: status %d: %s", code, body)
+	}
+	if env := client.RecvProtocol(protocolAnnounce); env.Data["message"] != "moving" {
+		t.Errorf("existing client received %v, want the announcement", env.Data)
+	}
+
+	if code, body := adminRequest(t, srv, http.MethodPost, "/undrain"); code != http.StatusOK {
+		t.Fatalf("POST /undrain: status %d: %s", code, body)
+	}
+	if code := status(http.MethodGet, "/readyz"); code != http.StatusOK {
+		t.Errorf("/readyz after undrain: %d, want 200", code)
+	}
+	if code := dial(); code != http.StatusSwitchingProtocols {
+		t.Errorf("upgrade after undrain: %d, want 101", code)
+	}
+	postTask(t, srv, "m1")
+}
+
+// TestNotReady Hub 的 run() 开始前 /tasks 和 /readyz 立即返回 503 而不是阻塞，run() 开始后恢复
+func TestNotReady(t *testing.T) {
+	setupLogging("error", io.Discard)
+	hub = newHub()
+	h := hub
+	srv := httptest.NewServer(newMux("", h))
+	t.Cleanup(func() {
+		h.stop()
+		<-h.stopped
+		srv.Close()
+	})
+	client := &http.Client{Timeout: testRecvTimeout}
+	post := func(path string) *http.Response {
+		t.Helper()
+		resp, err := client.Post(srv.URL+path, "application/json", strings.NewReader(`[{"address":"/img/1.jpg","model":"m1","version":"v1"}]`))
+		if err != nil {
+			t.Fatalf("post %s: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	for _, path := range []string{"/tasks?address=/img/1.jpg&model=m1&version=v1", "/tasks/batch"} {
+		if resp := post(path); resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") != "1" {
+			t.Errorf("%s before run(): status %d Retry-After %q, want 503 and 1", path, resp.StatusCode, resp.Header.Get("Retry-After"))
+		}
+	}
+	resp, err := client.Get(srv.URL + "/readyz")
+	if err != nil {
+		t.Fatalf("get /readyz: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("/readyz before run(): status %d, want 503", resp.StatusCode)
+	}
+
+	go h.run()
+	<-h.started
+	if resp := post("/tasks?address=/img/1.jpg&model=m1&version=v1"); resp.StatusCode != http.StatusAccepted {
+		t.Errorf("/tasks after run(): status %d, want 202", resp.StatusCode)
+	}
+}
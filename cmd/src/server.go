@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// newServer 创建 Hub 并启动其 run()，返回挂载了所有路由的 HTTP 服务。
+// 处理函数通过全局 hub 访问 Hub，因此同时替换全局 hub；
+// 在进程内驱动服务时可将返回的 Handler 交给 httptest.NewServer
+func newServer(basePath string, replaySize int, resumeTTL time.Duration) *http.Server {
+	hub = newShardedHub(hubShards)
+	hub.replay = newReplayBuffer(replaySize)
+	hub.resumeTTL = resumeTTL
+	go hub.run()
+	return &http.Server{Handler: newMux(basePath, hub)}
+}
+
+// shutdownServer 先关闭 HTTP 服务，再停止 Hub，最后等待各连接的 writePump 排空已排队的消息并发送关闭帧。
+// HTTP 服务和 Hub 停止各有 timeout 的期限；writePump 在 drainTimeout 内排空，
+// 另留出正在进行的写入和关闭帧各自的 timeout
+func shutdownServer(server *http.Server, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		errorf("Shutdown error: %v", err)
+	}
+	hub.stop()
+	select {
+	case <-hub.stopped:
+	case <-time.After(timeout):
+		errorf("Hub stop timed out")
+		return
+	}
+	pumpsDone := make(chan struct{})
+	go func() {
+		hub.pumps.Wait()
+		close(pumpsDone)
+	}()
+	select {
+	case <-pumpsDone:
+	case <-time.After(drainTimeout + 2*timeout):
+		errorf("Timed out waiting for connections to drain")
+	}
+}
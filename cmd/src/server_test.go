@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestEndToEnd 广播一个任务，客户端收到后回传结果，/results 中任务变为完成
+func TestEndToEnd(t *testing.T) {
+	srv := startTestServer(t)
+	client := dialTestClient(t, srv, "client_id=reviewer-1")
+	waitClients(t, 1)
+
+	id := postTask(t, srv, "m1")
+	task := client.RecvProtocol(1)
+	var data InspectorResult
+	if err := task.decodeData(&data); err != nil {
+		t.Fatalf("decode task: %v", err)
+	}
+	if data.TaskID != id || data.Model != "m1" || data.Target != "/img/1.jpg" {
+		t.Fatalf("unexpected task %+v, want task_id %s", data, id)
+	}
+
+	client.Send(2, data)
+	waitFor(t, func() bool {
+		record, ok := tasks.get(id)
+		return ok && record.Status == taskCompleted
+	})
+
+	resp, err := http.Get(srv.URL + "/results/" + id)
+	if err != nil {
+		t.Fatalf("get result: %v", err)
+	}
+	defer resp.Body.Close()
+	var record taskRecord
+	if err := json.NewDecoder(resp.Body).Decode(&record); err != nil {
+		t.Fatalf("decode result: %v", err)
+	}
+	if record.Status != taskCompleted || record.Reviewer != "reviewer-1" {
+		t.Fatalf("unexpected result record %+v", record)
+	}
+}
+
+// TestEcho 客户端发送的 protocol_id=1 消息以 protocol_id=2 回显，msg 追加完成标记
+func TestEcho(t *testing.T) {
+	srv := startTestServer(t)
+	client := dialTestClient(t, srv, "")
+	client.SendRaw(map[string]any{"protocol_id": 1, "id": "req-1", "data": map[string]any{"msg": "hello"}})
+	for {
+		var reply struct {
+			ProtocolID int64          `json:"protocol_id"`
+			ID         any            `json:"id"`
+			Data       map[string]any `json:"data"`
+		}
+		if err := json.Unmarshal(client.RecvRaw(), &reply); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if reply.ProtocolID != 2 {
+			continue
+		}
+		if reply.ID != "req-1" || reply.Data["msg"] != "hello"+echoSuffix {
+			t.Fatalf("unexpected echo %+v", reply)
+		}
+		return
+	}
+}
+
+// TestBasePath 指定 -base-path 时所有路由挂在前缀之下，原路径返回 404
+func TestBasePath(t *testing.T) {
+	for _, basePath := range []string{"", "/", "review/"} {
+		if got := normalizeBasePath(basePath); got != map[string]string{"": "", "/": "", "review/": "/review"}[basePath] {
+			t.Errorf("normalizeBasePath(%q) = %q", basePath, got)
+		}
+	}
+
+	srv := startTestServerAt(t, "/review")
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL+"/review/ws", nil)
+	if err != nil {
+		t.Fatalf("dial /review/ws: %v", err)
+	}
+	defer conn.Close()
+	(&testClient{t: t, conn: conn}).RecvProtocol(protocolWelcome)
+
+	if _, resp, err := websocket.DefaultDialer.Dial(wsURL+"/ws", nil); err == nil || resp == nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("dial /ws: %v, want 404", err)
+	}
+	for path, want := range map[string]int{"/review/healthz": http.StatusOK, "/healthz": http.StatusNotFound, "/tasks": http.StatusNotFound} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("get %s: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("GET %s = %d, want %d", path, resp.StatusCode, want)
+		}
+	}
+}
+
+// TestDataMustBeObject data 不是 JSON 对象的消息被拒绝并记录日志，连接不受影响，之后的对象 data 正常回显
+func TestDataMustBeObject(t *testing.T) {
+	srv := startTestServer(t)
+	logs := captureLogs(t, "warn")
+	client := dialTestClient(t, srv, "")
+	for _, data := range []any{"hello", []any{"a"}, 5, true} {
+		client.Send(1, data)
+	}
+	client.Send(1, map[string]any{"msg": "object"})
+	if reply := client.RecvProtocol(2); reply.Data["msg"] != "object"+echoSuffix {
+		t.Fatalf("echo %v, want msg %q", reply.Data, "object"+echoSuffix)
+	}
+	for _, kind := range []string{"string", "[]interface {}", "json.Number", "bool"} {
+		if logLine(logs, "Rejected message", "expected JSON object, got "+kind) == "" {
+			t.Errorf("no rejection logged for %s data:\n%s", kind, logs)
+		}
+	}
+}
+
+// TestTaskAccepted /tasks 返回 202 和带路由前缀的结果地址，任务完成前该地址返回 pending
+func TestTaskAccepted(t *testing.T) {
+	srv := startTestServerAt(t, "/review")
+	resp, err := http.Post(srv.URL+"/review/tasks?address=/img/1.jpg&model=m1&version=v1", "", nil)
+	if err != nil {
+		t.Fatalf("post task: %v", err)
+	}
+	resp.Body.Close()
+	location := resp.Header.Get("Location")
+	if resp.StatusCode != http.StatusAccepted || !strings.HasPrefix(location, "/review/results/") {
+		t.Fatalf("status %d, Location %q; want 202 and /review/results/{task_id}", resp.StatusCode, location)
+	}
+
+	var record taskRecord
+	if status := getJSON(t, srv, location, &record); status != http.StatusOK || record.Status != taskPending {
+		t.Fatalf("GET %s: status %d, record %+v; want a pending task", location, status, record)
+	}
+	if id := strings.TrimPrefix(location, "/review/results/"); record.ID != id {
+		t.Errorf("record id %s, want %s", record.ID, id)
+	}
+}
+
+// TestRequestID 回复带回请求的 id，字符串和数字 id 原样保留，同一连接上的多个请求可按 id 对应各自的回复
+func TestRequestID(t *testing.T) {
+	srv := startTestServer(t)
+	client := dialTestClient(t, srv, "")
+	client.SendRaw(map[string]any{"protocol_id": 1, "id": "req-a", "data": map[string]any{"msg": "a"}})
+	client.SendRaw(map[string]any{"protocol_id": 1, "id": 42, "data": map[string]any{"msg": "b"}})
+	client.SendRaw(map[string]any{"protocol_id": protocolResultChunk, "id": "req-c", "data": map[string]any{"seq": 0}})
+
+	type reply struct {
+		ProtocolID int64          `json:"protocol_id"`
+		ID         any            `json:"id"`
+		Data       map[string]any `json:"data"`
+	}
+	replies := make(map[string]reply)
+	for len(replies) < 3 {
+		var env reply
+		if err := json.Unmarshal(client.RecvRaw(), &env); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if env.ProtocolID == 2 || env.ProtocolID == protocolError {
+			replies[fmt.Sprint(env.ID)] = env
+		}
+	}
+	if env := replies["req-a"]; env.ProtocolID != 2 || env.Data["msg"] != "a"+echoSuffix {
+		t.Errorf("reply to req-a: %+v", env)
+	}
+	if env := replies["42"]; env.ProtocolID != 2 || env.Data["msg"] != "b"+echoSuffix {
+		t.Errorf("reply to 42: %+v", env)
+	}
+	if env := replies["req-c"]; env.ProtocolID != protocolError {
+		t.Errorf("reply to req-c: %+v, want an error reply", env)
+	}
+}
+
+// TestMaxHops 回显的 hops 比收到的多 1；hops 达到 -max-hops 的消息不再回显或转发，只回复错误
+func TestMaxHops(t *testing.T) {
+	t.Cleanup(func() { maxHops = defaultMaxHops })
+	maxHops = 3
+	srv := startTestServer(t)
+	client := dialTestClient(t, srv, "client_id=a")
+	peer := dialTestClient(t, srv, "client_id=b")
+	waitClients(t, 2)
+
+	client.SendRaw(map[string]any{"protocol_id": 1, "id": "below", "hops": 2, "data": map[string]any{"msg": "x"}})
+	if env := client.RecvProtocol(2); env.ID != "below" || env.Hops != 3 {
+		t.Fatalf("echo %+v, want id below with hops 3", env)
+	}
+
+	client.SendRaw(map[string]any{"protocol_id": 1, "id": "loop", "hops": 3, "data": map[string]any{"msg": "x"}})
+	client.SendRaw(map[string]any{"protocol_id": protocolRelay, "id": "relay-loop", "hops": 3, "data": map[string]any{"note": "loop"}})
+	client.SendRaw(map[string]any{"protocol_id": protocolRelay, "hops": 0, "data": map[string]any{"note": "fresh"}})
+	for _, id := range []string{"loop", "relay-loop"} {
+		env := client.Recv()
+		if env.ProtocolID != protocolError || env.ID != id || !strings.Contains(env.Data["error"].(string), "max hops") {
+			t.Fatalf("received %+v, want a max hops error for %s", env, id)
+		}
+	}
+	// 达到上限的转发被丢弃，对端收到的第一条转发是之后的新消息
+	if env := peer.RecvProtocol(protocolRelay); env.Data["note"] != "fresh" {
+		t.Errorf("peer received relay %v, want only the fresh note", env.Data)
+	}
+}
+
+// TestNullData data 为 null 的消息得到带原 id 的错误回复并记录错误日志，连接保持，之后的消息正常回显
+func TestNullData(t *testing.T) {
+	srv := startTestServer(t)
+	logs := captureLogs(t, "error")
+	client := dialTestClient(t, srv, "")
+	waitClients(t, 1)
+
+	client.SendRaw(map[string]any{"protocol_id": 1, "id": "null-1", "data": nil})
+	env := client.RecvProtocol(protocolError)
+	if env.ID != "null-1" || fmt.Sprint(env.Data["protocol_id"]) != "1" || !strings.Contains(env.Data["error"].(string), "null") {
+		t.Fatalf("error reply %+v, want id null-1 and a null data error", env)
+	}
+	if logLine(logs, "level=ERROR", "Rejected message with null data") == "" {
+		t.Errorf("no error line for null data in logs:\n%s", logs)
+	}
+	client.Send(1, map[string]any{"msg": "after"})
+	if env := client.RecvProtocol(2); env.Data["msg"] != "after"+echoSuffix {
+		t.Fatalf("echo %v, want the message after null data echoed", env.Data)
+	}
+	waitClients(t, 1)
+}
+
+// TestEchoSuffix -echo-suffix 指定的后缀追加在回显的 msg 之后，为空时原样回显
+func TestEchoSuffix(t *testing.T) {
+	t.Cleanup(func() { echoSuffix = defaultEchoSuffix })
+	srv := startTestServer(t)
+	client := dialTestClient(t, srv, "")
+
+	for _, suffix := range []string{" [checked]", ""} {
+		echoSuffix = suffix
+		client.Send(1, map[string]any{"msg": "hello", "n": 1})
+		reply := client.RecvProtocol(2)
+		if reply.Data["msg"] != "hello"+suffix || fmt.Sprint(reply.Data["n"]) != "1" {
+			t.Errorf("suffix %q: echo %v, want msg %q and other fields kept", suffix, reply.Data, "hello"+suffix)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Settings 是可在运行期调整的服务参数，修改后仅对新建立的连接生效，不做持久化
+type Settings struct {
+	// Ping 周期（毫秒），Pong 超时按 Ping 周期的 10/9 计算
+	PingPeriodMs int64 `json:"ping_period_ms"`
+	// 允许的最大消息长度（字节）
+	MaxMessageSize int64 `json:"max_message_size"`
+	// 允许同时在线的最大客户端数，0 表示不限制
+	MaxClients int64 `json:"max_clients"`
+}
+
+// Ping 周期允许设置的最小值，过短的周期会让服务端忙于发送 ping
+const minPingPeriod = time.Second
+
+// settingsUpdate 是 PUT /setting 的请求体，未出现的字段保持原值
+type settingsUpdate struct {
+	PingPeriodMs   *int64 `json:"ping_period_ms"`
+	MaxMessageSize *int64 `json:"max_message_size"`
+	MaxClients     *int64 `json:"max_clients"`
+}
+
+// SettingsStore 以互斥锁保护当前生效的设置
+type SettingsStore struct {
+	mu      sync.RWMutex
+	current Settings
+}
+
+var settings = &SettingsStore{
+	current: Settings{
+		PingPeriodMs:   pingPeriod.Milliseconds(),
+		MaxMessageSize: maxMessageSize,
+		MaxClients:     0,
+	},
+}
+
+// get 返回当前设置的副本
+func (s *SettingsStore) get() Settings {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current
+}
+
+// apply 校验并合并更新，返回更新后的设置
+func (s *SettingsStore) apply(u settingsUpdate) (Settings, string) {
+	if u.PingPeriodMs != nil {
+		if period := time.Duration(*u.PingPeriodMs) * time.Millisecond; period < minPingPeriod || period >= pongWait {
+			return Settings{}, fmt.Sprintf("ping_period_ms must be at least %d and less than %d", minPingPeriod.Milliseconds(), pongWait.Milliseconds())
+		}
+	}
+	if u.MaxMessageSize != nil && *u.MaxMessageSize <= 0 {
+		return Settings{}, "max_message_size must be positive"
+	}
+	if u.MaxClients != nil && *u.MaxClients < 0 {
+		return Settings{}, "max_clients must not be negative"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u.PingPeriodMs != nil {
+		s.current.PingPeriodMs = *u.PingPeriodMs
+	}
+	if u.MaxMessageSize != nil {
+		s.current.MaxMessageSize = *u.MaxMessageSize
+	}
+	if u.MaxClients != nil {
+		s.current.MaxClients = *u.MaxClients
+	}
+	return s.current, ""
+}
+
+// pingPeriod 返回 Ping 周期
+func (s Settings) pingPeriod() time.Duration {
+	return time.Duration(s.PingPeriodMs) * time.Millisecond
+}
+
+// pongWait 返回读超时，与默认常量保持相同的 10/9 比例
+func (s Settings) pongWait() time.Duration {
+	return s.pingPeriod() * 10 / 9
+}
+
+// settingHandler 以 GET 返回当前设置；PUT 修改设置，需要管理令牌
+func settingHandler(w http.ResponseWriter, r *http.Request) {
+	ip, port, err := splitRemoteAddr(r.RemoteAddr)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Cannot resolve client address")
+		return
+	}
+	logRequest(r, ip, port)
+
+	switch r.Method {
+	case http.MethodGet:
+		writeSettings(w, r, settings.get())
+	case http.MethodPut:
+		requireAdmin(updateSettingsHandler)(w, r)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+// updateSettingsHandler 处理 PUT /setting，合并请求体中的设置并返回更新后的值
+func updateSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	var update settingsUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid settings JSON: "+err.Error())
+		return
+	}
+	current, msg := settings.apply(update)
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+	infof("Settings updated: %+v", current)
+	writeSettings(w, r, current)
+}
+
+// writeSettings 输出设置。默认返回 JSON，只有明确要求纯文本且不接受 JSON 时才返回 key: value 形式的文本
+func writeSettings(w http.ResponseWriter, r *http.Request, current Settings) {
+	if acceptsMediaType(r, "text/plain") && !wantsJSON(r) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintf(w, "ping_period_ms: %d\nmax_message_size: %d\nmax_clients: %d\n",
+			current.PingPeriodMs, current.MaxMessageSize, current.MaxClients)
+		return
+	}
+	writeJSON(w, http.StatusOK, current)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// putSettings 以管理令牌 PUT /setting 提交 body，返回状态码和解码后的响应
+func putSettings(t *testing.T, srv *httptest.Server, body string) (int, map[string]any) {
+	t.Helper()
+	status, respBody := adminRequestBody(t, srv, http.MethodPut, "/setting", body)
+	var result map[string]any
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		t.Fatalf("decode /setting: %v", err)
+	}
+	return status, result
+}
+
+// TestSettingsRoundTrip PUT 只修改出现的字段，之后 GET 和新连接的欢迎消息都反映新值
+func TestSettingsRoundTrip(t *testing.T) {
+	saved := settings.get()
+	defer func() {
+		settings.mu.Lock()
+		settings.current = saved
+		settings.mu.Unlock()
+	}()
+	srv := startTestServer(t)
+
+	var got Settings
+	if status := getJSON(t, srv, "/setting", &got); status != http.StatusOK || got != saved {
+		t.Fatalf("GET /setting = %d %+v, want 200 %+v", status, got, saved)
+	}
+
+	status, _ := putSettings(t, srv, `{"ping_period_ms":1500,"max_clients":7}`)
+	if status != http.StatusOK {
+		t.Fatalf("PUT /setting status %d, want 200", status)
+	}
+	want := Settings{PingPeriodMs: 1500, MaxMessageSize: saved.MaxMessageSize, MaxClients: 7}
+	if getJSON(t, srv, "/setting", &got); got != want {
+		t.Fatalf("GET after PUT = %+v, want %+v", got, want)
+	}
+
+	client := dialTestClient(t, srv, "")
+	welcome := client.RecvProtocol(protocolWelcome)
+	applied, _ := welcome.Data["settings"].(map[string]any)
+	if fmt.Sprint(applied["ping_period_ms"]) != "1500" || fmt.Sprint(applied["max_clients"]) != "7" {
+		t.Errorf("new connection settings %v, want ping_period_ms 1500 and max_clients 7", applied)
+	}
+}
+
+// TestSettingsInvalid 非法值和非法 JSON 返回 400，设置保持不变
+func TestSettingsInvalid(t *testing.T) {
+	srv := startTestServer(t)
+	before := settings.get()
+	for _, body := range []string{`{"ping_period_ms":0}`, `{"ping_period_ms":1}`, `{"ping_period_ms":60000}`, `{"max_message_size":-1}`, `{"max_clients":-1}`, `{`} {
+		if status, result := putSettings(t, srv, body); status != http.StatusBadRequest || result["error"] == nil {
+			t.Errorf("PUT %s = %d %v, want 400 with an error", body, status, result)
+		}
+	}
+	if after := settings.get(); after != before {
+		t.Errorf("settings changed to %+v after rejected updates, want %+v", after, before)
+	}
+}
+
+// TestSettingsRequireAdmin 没有管理令牌的 PUT 返回 401，GET 不需要令牌
+func TestSettingsRequireAdmin(t *testing.T) {
+	srv := startTestServer(t)
+	prev := access.Load()
+	access.Store(&accessControl{adminToken: testAdminToken})
+	defer access.Store(prev)
+	before := settings.get()
+
+	req, err := http.NewRequest(http.MethodPut, srv.URL+"/setting", strings.NewReader(`{"max_clients":1}`))
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("put /setting: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("PUT /setting without token = %d, want 401", resp.StatusCode)
+	}
+	var got Settings
+	if status := getJSON(t, srv, "/setting", &got); status != http.StatusOK || got != before {
+		t.Errorf("GET /setting = %d %+v, want 200 %+v", status, got, before)
+	}
+}
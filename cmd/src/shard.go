@@ -0,0 +1,76 @@
+package main
+
+import "hash/fnv"
+
+// Hub 分片数的默认值，1 表示不分片
+const defaultHubShards = 1
+
+// Hub 分片数，由 -hub-shards 配置。大于 1 时客户端按 id 的哈希分布到各分片，
+// 每个分片是一个有独立 run() 的 Hub，注册、注销和投递在各分片中并行进行
+var hubShards = defaultHubShards
+
+// newShardedHub 创建有 n 个分片的 Hub，n 不大于 1 时与 newHub 相同。
+// 返回的 Hub 是协调者：自身不持有客户端，负责广播的变换、序号、重放缓冲、暂停队列和无客户端队列，
+// 并将每条广播交给所有分片投递。续传会话和客户端数等跨分片的状态也由协调者保存，分片经 root 访问
+func newShardedHub(n int) *Hub {
+	h := newHub()
+	if n <= 1 {
+		return h
+	}
+	h.shards = make([]*Hub, n)
+	for i := range h.shards {
+		shard := newHub()
+		shard.group = h
+		shard.pumps = h.pumps
+		h.shards[i] = shard
+	}
+	return h
+}
+
+// root 返回保存跨分片状态的 Hub：分片返回其协调者，未分片的 Hub 返回自身
+func (h *Hub) root() *Hub {
+	if h.group != nil {
+		return h.group
+	}
+	return h
+}
+
+// shardFor 返回 id 对应客户端所在的分片，同一 id 总是落在同一分片，重复 id 的检查因此只需在分片内进行。
+// 未分片时返回 h 自身
+func (h *Hub) shardFor(id string) *Hub {
+	if len(h.shards) == 0 {
+		return h
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(id))
+	return h.shards[hash.Sum32()%uint32(len(h.shards))]
+}
+
+// members 返回实际持有客户端的 Hub：分片时为各分片，否则为 h 自身
+func (h *Hub) members() []*Hub {
+	if len(h.shards) == 0 {
+		return []*Hub{h}
+	}
+	return h.shards
+}
+
+// fanOut 在每个持有客户端的 Hub 的 run() 中并行执行 fn，等待全部完成后返回各结果之和。
+// 未分片时直接在当前 goroutine 中执行，因此只能在 h 的 run() 中调用；已停止的分片不执行 fn
+func (h *Hub) fanOut(fn func(member *Hub) int) int {
+	if len(h.shards) == 0 {
+		return fn(h)
+	}
+	results := make(chan int, len(h.shards))
+	for _, shard := range h.shards {
+		select {
+		case shard.queries <- func() { results <- fn(shard) }:
+		case <-shard.done:
+			results <- 0
+		}
+	}
+	total := 0
+	for range h.shards {
+		total += <-results
+	}
+	return total
+}
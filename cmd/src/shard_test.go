@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+)
+
+// startShardedServer 以 n 个分片启动测试服务，测试结束后恢复分片数
+func startShardedServer(t *testing.T, n int) *httptest.Server {
+	t.Helper()
+	saved := hubShards
+	hubShards = n
+	t.Cleanup(func() { hubShards = saved })
+	return startTestServer(t)
+}
+
+// TestShardedBroadcast 分片时客户端分布在不同分片上，广播和转发都送达所有分片中的客户端，
+// /clients 和 hasClient 汇总各分片
+func TestShardedBroadcast(t *testing.T) {
+	srv := startShardedServer(t, 4)
+	var clients []*testClient
+	used := make(map[*Hub]bool)
+	for i := 0; i < 8; i++ {
+		id := fmt.Sprintf("s%d", i)
+		used[hub.shardFor(id)] = true
+		clients = append(clients, dialTestClient(t, srv, "client_id="+id))
+	}
+	if len(used) < 2 {
+		t.Fatalf("clients landed on %d shards, want at least 2", len(used))
+	}
+	waitClients(t, len(clients))
+
+	var infos []ClientInfo
+	getJSON(t, srv, "/clients", &infos)
+	if len(infos) != len(clients) {
+		t.Errorf("/clients lists %d clients, want %d", len(infos), len(clients))
+	}
+	if !hub.hasClient("s5") || hub.hasClient("missing") {
+		t.Error("hasClient does not match the connected clients")
+	}
+
+	postTask(t, srv, "m1")
+	for i, client := range clients {
+		if env := client.RecvProtocol(1); env.Data["model"] != "m1" {
+			t.Errorf("client s%d received %v, want m1", i, env.Data)
+		}
+	}
+
+	clients[0].Send(protocolRelay, map[string]any{"note": "cross shard"})
+	for i, client := range clients[1:] {
+		if env := client.RecvProtocol(protocolRelay); env.Data["note"] != "cross shard" {
+			t.Errorf("client s%d received %+v, want the relayed note", i+1, env)
+		}
+	}
+}
+
+// TestShardedResume 续传会话由协调者保存，分片时断线重连仍能补发错过的广播
+func TestShardedResume(t *testing.T) {
+	srv := startShardedServer(t, 4)
+	stay := dialTestClient(t, srv, "client_id=stay")
+	away := dialTestClient(t, srv, "client_id=away")
+	waitClients(t, 2)
+	token := sessionOf(t, away).ResumeToken
+	away.conn.Close()
+	waitClients(t, 1)
+
+	postTask(t, srv, "m1")
+	stay.RecvProtocol(1)
+
+	back := dialTestClient(t, srv, "client_id=back&resume_token="+token)
+	if notice := sessionOf(t, back); !notice.Resumed {
+		t.Fatalf("session notice %+v, want resumed", notice)
+	}
+	if env := back.RecvProtocol(1); env.Data["model"] != "m1" {
+		t.Errorf("replayed %v, want m1", env.Data)
+	}
+}
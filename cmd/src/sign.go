@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// 与复判端共享的签名密钥，由 -sign-key 配置，为空时不签名也不校验
+var signKey string
+
+// 签名放在信封顶层的该字段中，计算签名时不包含该字段
+const signatureField = "signature"
+
+var (
+	errUnsigned     = errors.New("message is not signed")
+	errBadSignature = errors.New("signature does not match")
+)
+
+// signData 返回 data 的 HMAC-SHA256 签名，十六进制编码
+func signData(data []byte) string {
+	mac := hmac.New(sha256.New, []byte(signKey))
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// canonicalEnvelope 返回签名覆盖的规范形式：去掉 signature 字段、protocolId 统一写作 protocol_id 后，
+// 按键排序、不含空白、不转义 HTML 字符的紧凑 JSON，数字保持原样。
+// 签名覆盖整个信封，包括 protocol_id、data、timestamp、ttl 和 traceparent，改动其中任何一个都会使签名失效
+func canonicalEnvelope(message []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(normalizeEnvelope(message)))
+	dec.UseNumber()
+	var envelope map[string]interface{}
+	if err := dec.Decode(&envelope); err != nil {
+		return nil, err
+	}
+	if envelope == nil {
+		return nil, errors.New("message must be a JSON object")
+	}
+	delete(envelope, signatureField)
+	return encodeCompact(envelope)
+}
+
+// encodeCompact 将 v 编码为不转义 HTML 字符的紧凑 JSON，对象的键按字典序排列
+func encodeCompact(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte{'\n'}), nil
+}
+
+// encodeSigned 将下发的信封编码为 JSON，配置了密钥时对信封的规范形式签名，签名放在顶层的 signature 字段中：
+//
+//	{"data": {...}, "protocol_id": 1, "signature": "hex(HMAC-SHA256(key, canonical))", "timestamp": ..., ...}
+//
+// 复判端去掉 signature 后按 canonicalEnvelope 的规则计算签名并比对，以拒绝被篡改的消息。
+// 未配置密钥时与 json.Marshal 相同
+func encodeSigned(v interface{}) ([]byte, error) {
+	message, err := json.Marshal(v)
+	if err != nil || signKey == "" {
+		return message, err
+	}
+	canonical, err := canonicalEnvelope(message)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(canonical, &fields); err != nil {
+		return nil, err
+	}
+	fields[signatureField], _ = json.Marshal(signData(canonical))
+	return encodeCompact(fields)
+}
+
+// verifySignature 校验客户端消息的签名，签名方式与 encodeSigned 相同，覆盖除 signature 以外的整个信封。
+// 结果中的 timestamp 是原样带回的广播时间，不用于判断新旧；重复提交的结果由 taskStore.complete 处理。
+// 未配置密钥时总是通过
+func verifySignature(message []byte) error {
+	if signKey == "" {
+		return nil
+	}
+	var signed struct {
+		Signature string `json:"signature"`
+	}
+	if err := json.Unmarshal(message, &signed); err != nil {
+		return fmt.Errorf("cannot read signature: %v", err)
+	}
+	if signed.Signature == "" {
+		return errUnsigned
+	}
+	got, err := hex.DecodeString(signed.Signature)
+	if err != nil {
+		return errBadSignature
+	}
+	canonical, err := canonicalEnvelope(message)
+	if err != nil {
+		return fmt.Errorf("cannot read signature: %v", err)
+	}
+	mac := hmac.New(sha256.New, []byte(signKey))
+	mac.Write(canonical)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return errBadSignature
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// hmacHex 以 key 计算 data 的 HMAC-SHA256，十六进制编码，与复判端的实现相同
+func hmacHex(key string, data []byte) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signAs 按复判端的方式为信封签名：对去掉 signature 的规范形式计算 HMAC，再放回 signature 字段
+func signAs(t *testing.T, key string, envelope map[string]any) string {
+	t.Helper()
+	raw, err := json.Marshal(envelope)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	canonical, err := canonicalEnvelope(raw)
+	if err != nil {
+		t.Fatalf("canonical: %v", err)
+	}
+	envelope["signature"] = hmacHex(key, canonical)
+	signed, err := json.Marshal(envelope)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return string(signed)
+}
+
+// TestSignedTasks 配置 -sign-key 时任务带有对整个信封的签名；签名正确的结果被采纳，即使任务广播于很久之前，
+// 篡改了 data 或信封其他字段、未签名的结果被拒绝
+func TestSignedTasks(t *testing.T) {
+	const key = "shared-secret"
+	t.Cleanup(func() { signKey = "" })
+	signKey = key
+	srv := startTestServer(t)
+	logs := captureLogs(t, "warn")
+	client := dialTestClient(t, srv, "client_id=signer")
+	waitClients(t, 1)
+
+	ids := []string{postTask(t, srv, "m1"), postTask(t, srv, "m1"), postTask(t, srv, "m1"), postTask(t, srv, "m1"), postTask(t, srv, "m1")}
+	var received []map[string]any
+	for len(received) < len(ids) {
+		raw := client.RecvRaw()
+		var task map[string]any
+		if err := json.Unmarshal(raw, &task); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if task["protocol_id"] != float64(1) {
+			continue
+		}
+		canonical, err := canonicalEnvelope(raw)
+		if err != nil {
+			t.Fatalf("canonical: %v", err)
+		}
+		if task["signature"] != hmacHex(key, canonical) {
+			t.Fatalf("task signature %v does not match its envelope %s", task["signature"], canonical)
+		}
+		// 信封的其他字段同样在签名范围内
+		tampered := strings.Replace(string(raw), `"protocol_id":1`, `"protocol_id":1,"ttl":5`, 1)
+		if err := verifySignature([]byte(tampered)); err != errBadSignature {
+			t.Fatalf("added ttl verified with %v, want %v", err, errBadSignature)
+		}
+		received = append(received, task)
+	}
+
+	send := func(raw string) {
+		t.Helper()
+		if err := client.conn.WriteMessage(websocket.TextMessage, []byte(raw)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	result := func(i int) map[string]any {
+		return map[string]any{"protocol_id": 2, "data": received[i]["data"], "timestamp": received[i]["timestamp"]}
+	}
+	// data 被篡改
+	tampered := signAs(t, key, result(0))
+	send(strings.Replace(tampered, `"m1"`, `"m2"`, 1))
+	// 未签名
+	unsigned, _ := json.Marshal(result(1))
+	send(string(unsigned))
+	// 签名后改动了 timestamp
+	moved := result(2)
+	signedMoved := signAs(t, key, moved)
+	send(strings.Replace(signedMoved, `"timestamp":`+strconv.FormatFloat(moved["timestamp"].(float64), 'f', -1, 64), `"timestamp":1`, 1))
+	// 广播于很久之前的任务，签名正确的结果照常接受
+	old := result(3)
+	old["timestamp"] = time.Now().Add(-24 * time.Hour).UnixMilli()
+	send(signAs(t, key, old))
+	send(signAs(t, key, result(4)))
+
+	waitFor(t, func() bool {
+		for _, id := range ids[3:5] {
+			if record, ok := tasks.get(id); !ok || record.Status != taskCompleted {
+				return false
+			}
+		}
+		return true
+	})
+	for i, reason := range []string{errBadSignature.Error(), errUnsigned.Error(), errBadSignature.Error()} {
+		if record, _ := tasks.get(ids[i]); record.Status != taskPending {
+			t.Errorf("task %s is %s, want the result rejected", ids[i], record.Status)
+		}
+		if logLine(logs, "Rejected result from signer", reason) == "" {
+			t.Errorf("no rejection for %q in logs:\n%s", reason, logs)
+		}
+	}
+}
+
+// TestCanonicalEnvelope 规范形式与字段顺序、空白和 protocol_id 的写法无关，不包含 signature
+func TestCanonicalEnvelope(t *testing.T) {
+	want := `{"data":{"a":"<b>","n":1.50},"protocol_id":2,"timestamp":1717200000000}`
+	for _, message := range []string{
+		`{"protocol_id":2,"timestamp":1717200000000,"data":{"n":1.50,"a":"<b>"}}`,
+		`{ "signature":"x", "data":{"a":"<b>", "n":1.50}, "protocolId":2, "timestamp":1717200000000 }`,
+	} {
+		got, err := canonicalEnvelope([]byte(message))
+		if err != nil || string(got) != want {
+			t.Errorf("canonicalEnvelope(%s) = %s, %v; want %s", message, got, err, want)
+		}
+	}
+}
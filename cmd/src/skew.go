@@ -0,0 +1,38 @@
+package main
+
+import "time"
+
+// 时钟偏差告警阈值的默认值
+const defaultClockSkewThreshold = 5 * time.Second
+
+// 结果中带回的时间戳与服务端时间偏差超过该值时记录警告并不计入往返耗时，0 表示不检查，
+// 由 -clock-skew-threshold 配置
+var clockSkewThreshold = defaultClockSkewThreshold
+
+// clockSkew 估算复判端带回的广播时间戳 echoed 与服务端时间的偏差。
+// 已知任务的广播时间 sent 时，时间戳应与之一致，偏差为二者之差；
+// 不知道广播时间时只能发现比服务端当前时间更晚的时间戳，偏差为超前的部分。
+// 偏差多半是复判端用自己的时钟改写了时间戳，会使往返耗时和 TTL 计算失真
+func clockSkew(echoed time.Time, sent time.Time, now time.Time) time.Duration {
+	if !sent.IsZero() {
+		return echoed.Sub(sent)
+	}
+	if echoed.After(now) {
+		return echoed.Sub(now)
+	}
+	return 0
+}
+
+// checkClockSkew 检查结果时间戳的偏差，超过阈值时记录警告并计数，返回 false 表示时间戳不可信
+func (c *Client) checkClockSkew(echoed time.Time, sent time.Time, now time.Time) bool {
+	if clockSkewThreshold <= 0 {
+		return true
+	}
+	skew := clockSkew(echoed, sent, now)
+	if skew.Abs() <= clockSkewThreshold {
+		return true
+	}
+	stats.clockSkews.Add(1)
+	c.warnf("Clock skew from %s: result timestamp is off by %v (threshold %v), check the reviewer's clock", c.id, skew, clockSkewThreshold)
+	return false
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// TestClockSkewWarning 结果带回的时间戳与广播时间相差过大时记录警告并计数，不计入往返耗时
+func TestClockSkewWarning(t *testing.T) {
+	srv := startTestServer(t)
+	client := dialTestClient(t, srv, "client_id=reviewer-1")
+	waitClients(t, 1)
+	logs := captureLogs(t, "warn")
+	skews := stats.clockSkews.Load()
+	samples := stats.latency.snapshot().Count
+
+	postTask(t, srv, "m1")
+	var task struct {
+		ProtocolID int64           `json:"protocol_id"`
+		Data       json.RawMessage `json:"data"`
+		Timestamp  int64           `json:"timestamp"`
+	}
+	for task.ProtocolID != 1 {
+		if err := json.Unmarshal(client.RecvRaw(), &task); err != nil {
+			t.Fatalf("decode broadcast: %v", err)
+		}
+	}
+	// 复判端用慢了 30 秒的时钟改写了时间戳
+	client.SendRaw(map[string]any{"protocol_id": 2, "data": task.Data, "timestamp": task.Timestamp - 30000})
+	waitFor(t, func() bool { return stats.clockSkews.Load() == skews+1 })
+	if logLine(logs, "Clock skew from reviewer-1") == "" {
+		t.Errorf("no clock skew warning in logs:\n%s", logs)
+	}
+
+	// 未知任务只能发现超前的时间戳
+	future := time.Now().Add(time.Hour).UnixMilli()
+	client.SendRaw(map[string]any{"protocol_id": 2, "data": map[string]any{"host": "10.0.0.1", "target": "/img/2.jpg"}, "timestamp": future})
+	waitFor(t, func() bool { return stats.clockSkews.Load() == skews+2 })
+	if got := stats.latency.snapshot().Count; got != samples {
+		t.Errorf("latency recorded %d skewed samples, want none", got-samples)
+	}
+}
+
+// TestClockSkew 已知广播时间时按与之的差计算偏差，否则只计算超前于当前时间的部分
+func TestClockSkew(t *testing.T) {
+	now := time.Now()
+	for _, tc := range []struct {
+		echoed, sent time.Time
+		want         time.Duration
+	}{
+		{now.Add(-time.Minute), now.Add(-time.Minute), 0},
+		{now.Add(-time.Minute), now, -time.Minute},
+		{now.Add(-time.Hour), time.Time{}, 0},
+		{now.Add(time.Hour), time.Time{}, time.Hour},
+	} {
+		if got := clockSkew(tc.echoed, tc.sent, now); got != tc.want {
+			t.Errorf("clockSkew(%v, %v) = %v, want %v", tc.echoed, tc.sent, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ServerStats 保存服务运行期间的统计计数，所有字段均可被多个 goroutine 并发更新
+type ServerStats struct {
+	startTime time.Time
+	// 累计建立过的连接数
+	totalConnections atomic.Int64
+	// 当前在线连接数
+	currentConnections atomic.Int64
+	// Hub 累计执行的广播次数
+	totalBroadcasts atomic.Int64
+	// /tasks 累计收到的任务数
+	totalTasks atomic.Int64
+	// 客户端正常关闭（1000/1001）的次数
+	normalCloses atomic.Int64
+	// 以非预期关闭码断开的次数
+	unexpectedCloses atomic.Int64
+	// 未能送达客户端而被丢弃的消息数
+	droppedMessages atomic.Int64
+	// 结果处理队列已满而被丢弃的复判结果数
+	droppedResults atomic.Int64
+	// 发布队列已满而未能发布到 NATS 的复判结果数
+	droppedPublishes atomic.Int64
+	// ping 写入失败而关闭的连接数
+	pingFailures atomic.Int64
+	// 结果时间戳与服务端时钟偏差超过阈值的次数
+	clockSkews atomic.Int64
+	// 累计写给 WebSocket 客户端的字节数，包括帧头
+	bytesSent atomic.Int64
+	// 协商了压缩的连接压缩前的字节数和实际写入连接的字节数，用于计算压缩率
+	compressedPayloadBytes atomic.Int64
+	compressedWireBytes    atomic.Int64
+
+	// 按 protocol_id 统计收到的消息数
+	mu             sync.Mutex
+	protocolCounts map[int64]int64
+	// 按关闭码统计的断开次数，与 protocolCounts 共用 mu
+	closeCodes map[int]int64
+
+	// 复判往返耗时
+	latency *latencyRecorder
+}
+
+// StatsSnapshot 是 /stats 接口返回的 JSON 结构
+type StatsSnapshot struct {
+	UptimeSeconds      float64 `json:"uptime_seconds"`
+	TotalConnections   int64   `json:"total_connections"`
+	CurrentConnections int64   `json:"current_connections"`
+	TotalBroadcasts    int64   `json:"total_broadcasts"`
+	TotalTasks         int64   `json:"total_tasks"`
+	NormalCloses       int64   `json:"normal_closes"`
+	UnexpectedCloses   int64   `json:"unexpected_closes"`
+	DroppedMessages    int64   `json:"dropped_messages"`
+	DroppedResults     int64   `json:"dropped_results"`
+	DroppedPublishes   int64   `json:"dropped_publishes"`
+	PingFailures       int64   `json:"ping_failures"`
+	ClockSkews         int64   `json:"clock_skews"`
+	BytesSent          int64   `json:"bytes_sent"`
+	// 协商了压缩的连接实际发出与压缩前字节数之比，小于 1 说明压缩有效，没有数据时为 0
+	CompressionRatio float64          `json:"compression_ratio"`
+	ProtocolMessages map[string]int64 `json:"protocol_messages"`
+	CloseCodes       map[string]int64 `json:"close_codes"`
+	ReviewLatency    LatencySnapshot  `json:"review_latency"`
+	WebhookBreaker   string           `json:"webhook_breaker"`
+}
+
+var stats = newServerStats()
+
+// newServerStats 创建统计实例，并以当前时间作为启动时间
+func newServerStats() *ServerStats {
+	return &ServerStats{
+		startTime:      time.Now(),
+		protocolCounts: make(map[int64]int64),
+		closeCodes:     make(map[int]int64),
+		latency:        newLatencyRecorder(latencySamples),
+	}
+}
+
+// countProtocol 记录一条收到的指定协议消息
+func (s *ServerStats) countProtocol(protocolID int64) {
+	s.mu.Lock()
+	s.protocolCounts[protocolID]++
+	s.mu.Unlock()
+}
+
+// countClose 记录一次以指定关闭码断开的连接
+func (s *ServerStats) countClose(code int) {
+	s.mu.Lock()
+	s.closeCodes[code]++
+	s.mu.Unlock()
+}
+
+// snapshot 生成当前统计数据的快照
+func (s *ServerStats) snapshot() StatsSnapshot {
+	snap := StatsSnapshot{
+		UptimeSeconds:      time.Since(s.startTime).Seconds(),
+		TotalConnections:   s.totalConnections.Load(),
+		CurrentConnections: s.currentConnections.Load(),
+		TotalBroadcasts:    s.totalBroadcasts.Load(),
+		TotalTasks:         s.totalTasks.Load(),
+		NormalCloses:       s.normalCloses.Load(),
+		UnexpectedCloses:   s.unexpectedCloses.Load(),
+		DroppedMessages:    s.droppedMessages.Load(),
+		DroppedResults:     s.droppedResults.Load(),
+		DroppedPublishes:   s.droppedPublishes.Load(),
+		PingFailures:       s.pingFailures.Load(),
+		ClockSkews:         s.clockSkews.Load(),
+		BytesSent:          s.bytesSent.Load(),
+		CompressionRatio:   compressionRatio(s.compressedWireBytes.Load(), s.compressedPayloadBytes.Load()),
+		ProtocolMessages:   make(map[string]int64),
+		CloseCodes:         make(map[string]int64),
+	}
+	s.mu.Lock()
+	for id, n := range s.protocolCounts {
+		snap.ProtocolMessages[strconv.FormatInt(id, 10)] = n
+	}
+	for code, n := range s.closeCodes {
+		snap.CloseCodes[strconv.Itoa(code)] = n
+	}
+	s.mu.Unlock()
+	snap.ReviewLatency = s.latency.snapshot()
+	snap.WebhookBreaker = webhookBreaker.currentState()
+	return snap
+}
+
+// 用于计算分位数的最近样本数
+const latencySamples = 1024
+
+// latencyRecorder 记录复判往返耗时，保留最近的样本用于计算分位数
+type latencyRecorder struct {
+	mu      sync.Mutex
+	count   int64
+	total   time.Duration
+	samples []time.Duration
+	next    int
+}
+
+// LatencySnapshot 是往返耗时统计的快照，单位为毫秒
+type LatencySnapshot struct {
+	Count int64   `json:"count"`
+	AvgMs float64 `json:"avg_ms"`
+	P50Ms float64 `json:"p50_ms"`
+	P90Ms float64 `json:"p90_ms"`
+	P99Ms float64 `json:"p99_ms"`
+}
+
+func newLatencyRecorder(size int) *latencyRecorder {
+	return &latencyRecorder{samples: make([]time.Duration, 0, size)}
+}
+
+// record 记录一次往返耗时，样本满后覆盖最旧的记录
+func (l *latencyRecorder) record(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.count++
+	l.total += d
+	if len(l.samples) < cap(l.samples) {
+		l.samples = append(l.samples, d)
+		return
+	}
+	l.samples[l.next] = d
+	l.next = (l.next + 1) % len(l.samples)
+}
+
+func (l *latencyRecorder) snapshot() LatencySnapshot {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	snap := LatencySnapshot{Count: l.count}
+	if l.count == 0 {
+		return snap
+	}
+	snap.AvgMs = durationMs(l.total / time.Duration(l.count))
+	sorted := append([]time.Duration(nil), l.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	percentile := func(p float64) float64 {
+		return durationMs(sorted[int(p*float64(len(sorted)-1))])
+	}
+	snap.P50Ms = percentile(0.50)
+	snap.P90Ms = percentile(0.90)
+	snap.P99Ms = percentile(0.99)
+	return snap
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	ip, port, err := splitRemoteAddr(r.RemoteAddr)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Cannot resolve client address")
+		return
+	}
+	logRequest(r, ip, port)
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(stats.snapshot()); err != nil {
+		errorf("JSON encoding error: %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+)
+
+// TestStatsEndpoint /stats 返回全部计数字段，连接、任务和收到的消息之后相应递增
+func TestStatsEndpoint(t *testing.T) {
+	srv := startTestServer(t)
+	var fields map[string]any
+	getJSON(t, srv, "/stats", &fields)
+	for _, name := range []string{
+		"uptime_seconds", "total_connections", "current_connections", "total_broadcasts", "total_tasks",
+		"normal_closes", "unexpected_closes", "dropped_messages", "bytes_sent", "protocol_messages", "close_codes", "review_latency",
+	} {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("/stats is missing %s", name)
+		}
+	}
+
+	var before, after StatsSnapshot
+	getJSON(t, srv, "/stats", &before)
+	client := dialTestClient(t, srv, "")
+	waitClients(t, 1)
+	postTask(t, srv, "m1")
+	client.RecvProtocol(1)
+	client.Send(1, map[string]any{"msg": "hi"})
+	client.RecvProtocol(2)
+	getJSON(t, srv, "/stats", &after)
+
+	if after.TotalConnections != before.TotalConnections+1 || after.CurrentConnections != before.CurrentConnections+1 {
+		t.Errorf("connections %d/%d -> %d/%d, want both +1", before.TotalConnections, before.CurrentConnections, after.TotalConnections, after.CurrentConnections)
+	}
+	if after.TotalTasks != before.TotalTasks+1 || after.TotalBroadcasts != before.TotalBroadcasts+1 {
+		t.Errorf("tasks %d, broadcasts %d -> %d, %d, want both +1", before.TotalTasks, before.TotalBroadcasts, after.TotalTasks, after.TotalBroadcasts)
+	}
+	if after.ProtocolMessages["1"] != before.ProtocolMessages["1"]+1 {
+		t.Errorf("protocol_messages[1] %d -> %d, want +1", before.ProtocolMessages["1"], after.ProtocolMessages["1"])
+	}
+	if after.BytesSent <= before.BytesSent || after.UptimeSeconds <= 0 {
+		t.Errorf("bytes_sent %d -> %d, uptime %v", before.BytesSent, after.BytesSent, after.UptimeSeconds)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// subscriptionSet 是客户端订阅的型号集合，为空时接收所有广播
+type subscriptionSet map[string]bool
+
+// 单个客户端最多订阅的型号数（房间数），0 表示不限制，由 -max-rooms-per-client 配置
+var maxRoomsPerClient = 0
+
+// RoomInfo 是 /rooms 接口中单个房间的描述，房间即订阅了同一型号的客户端
+type RoomInfo struct {
+	Model   string `json:"model"`
+	Members int    `json:"members"`
+}
+
+// parseSubscribe 解析订阅消息的 data：{"models": ["A", "B"]}，空数组表示取消订阅、接收全部。
+// 去重后的型号数超过 maxRoomsPerClient 时整条订阅被拒绝，原有订阅保持不变
+func parseSubscribe(data map[string]interface{}) (subscriptionSet, error) {
+	raw, ok := data["models"]
+	if !ok {
+		return nil, fmt.Errorf("missing models field")
+	}
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("models must be an array, got %T", raw)
+	}
+	set := make(subscriptionSet, len(list))
+	for i, item := range list {
+		model, ok := item.(string)
+		if !ok || model == "" {
+			return nil, fmt.Errorf("models[%d] must be a non-empty string", i)
+		}
+		set[model] = true
+	}
+	if maxRoomsPerClient > 0 && len(set) > maxRoomsPerClient {
+		return nil, fmt.Errorf("subscribing to %d models, limit is %d", len(set), maxRoomsPerClient)
+	}
+	return set, nil
+}
+
+// setSubscriptions 更新客户端的订阅，经由 run() 执行以避免与广播并发访问
+func (h *Hub) setSubscriptions(client *Client, set subscriptionSet) {
+	h.query(func() {
+		h.joinRooms(client, set)
+	})
+}
+
+// joinRooms 将客户端的订阅替换为 set，并同步更新房间成员，只能在 run() 中调用。
+// 已被移除的客户端不再加入任何房间
+func (h *Hub) joinRooms(client *Client, set subscriptionSet) {
+	h.leaveRooms(client)
+	if client.closed {
+		return
+	}
+	client.subscriptions = set
+	for model := range set {
+		members := h.rooms[model]
+		if members == nil {
+			members = make(map[*Client]bool)
+			h.rooms[model] = members
+		}
+		members[client] = true
+	}
+}
+
+// leaveRooms 将客户端移出其订阅的所有房间，最后一个成员离开的房间随即删除，只能在 run() 中调用
+func (h *Hub) leaveRooms(client *Client) {
+	for model := range client.subscriptions {
+		members := h.rooms[model]
+		delete(members, client)
+		if len(members) == 0 {
+			delete(h.rooms, model)
+		}
+	}
+	client.subscriptions = nil
+}
+
+// listRooms 返回当前所有房间及其成员数，按型号排序，分片时合并各分片中同一型号的房间
+func (h *Hub) listRooms() []RoomInfo {
+	counts := make(map[string]int)
+	for _, member := range h.members() {
+		member.query(func() {
+			for model, members := range member.rooms {
+				counts[model] += len(members)
+			}
+		})
+	}
+	rooms := make([]RoomInfo, 0, len(counts))
+	for model, n := range counts {
+		rooms = append(rooms, RoomInfo{Model: model, Members: n})
+	}
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].Model < rooms[j].Model })
+	return rooms
+}
+
+// roomsHandler 处理 GET /rooms，返回各型号的订阅人数，便于发现无人订阅的型号
+func roomsHandler(w http.ResponseWriter, r *http.Request) {
+	ip, port, err := splitRemoteAddr(r.RemoteAddr)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Cannot resolve client address")
+		return
+	}
+	logRequest(r, ip, port)
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(hub.listRooms()); err != nil {
+		errorf("JSON encoding error: %v", err)
+	}
+}
+
+// wants 判断客户端是否应收到包含这些任务的广播，只能在 run() 中调用。
+// 订阅和能力声明都满足时才投递；不含型号信息的广播发给所有客户端
+func (c *Client) wants(tasks []taskKey) bool {
+	if len(tasks) == 0 {
+		return true
+	}
+	return c.subscribedTo(tasks) && c.capableOf(tasks)
+}
+
+// subscribedTo 判断任一任务的型号是否在订阅中，未订阅任何型号视为全部订阅
+func (c *Client) subscribedTo(tasks []taskKey) bool {
+	if len(c.subscriptions) == 0 {
+		return true
+	}
+	for _, task := range tasks {
+		if c.subscriptions[task.Model] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// roomsOf 通过 /rooms 返回各房间的成员数
+func roomsOf(t *testing.T, srvURL string) map[string]int {
+	t.Helper()
+	resp, err := http.Get(srvURL + "/rooms")
+	if err != nil {
+		t.Fatalf("get rooms: %v", err)
+	}
+	defer resp.Body.Close()
+	var list []RoomInfo
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatalf("decode rooms: %v", err)
+	}
+	rooms := make(map[string]int, len(list))
+	for _, room := range list {
+		rooms[room.Model] = room.Members
+	}
+	return rooms
+}
+
+// waitRooms 等待房间成员数变为 want
+func waitRooms(t *testing.T, srvURL string, want map[string]int) {
+	t.Helper()
+	var got map[string]int
+	waitFor(t, func() bool {
+		got = roomsOf(t, srvURL)
+		return reflect.DeepEqual(got, want)
+	})
+}
+
+// TestMaxRoomsPerClient 超过上限的订阅被拒绝并回复错误，原有订阅和房间保持不变
+func TestMaxRoomsPerClient(t *testing.T) {
+	maxRoomsPerClient = 2
+	defer func() { maxRoomsPerClient = 0 }()
+	srv := startTestServer(t)
+	client := dialTestClient(t, srv, "")
+
+	client.Send(protocolSubscribe, map[string]any{"models": []string{"a", "b"}})
+	waitRooms(t, srv.URL, map[string]int{"a": 1, "b": 1})
+
+	client.SendRaw(map[string]any{"protocol_id": protocolSubscribe, "id": "over", "data": map[string]any{"models": []string{"a", "b", "c"}}})
+	reply := client.RecvProtocol(protocolError)
+	if reply.ID != "over" || reply.Data["protocol_id"] != json.Number("3") {
+		t.Fatalf("unexpected error reply %+v", reply)
+	}
+	waitRooms(t, srv.URL, map[string]int{"a": 1, "b": 1})
+}
+
+// TestRoomsCleanup 最后一个成员取消订阅或断开后房间被删除
+func TestRoomsCleanup(t *testing.T) {
+	srv := startTestServer(t)
+	first := dialTestClient(t, srv, "client_id=first")
+	second := dialTestClient(t, srv, "client_id=second")
+
+	first.Send(protocolSubscribe, map[string]any{"models": []string{"a", "b"}})
+	second.Send(protocolSubscribe, map[string]any{"models": []string{"b"}})
+	waitRooms(t, srv.URL, map[string]int{"a": 1, "b": 2})
+
+	// 改订其他型号时离开原来的房间
+	first.Send(protocolSubscribe, map[string]any{"models": []string{"c"}})
+	waitRooms(t, srv.URL, map[string]int{"b": 1, "c": 1})
+
+	// 空数组取消订阅
+	first.Send(protocolSubscribe, map[string]any{"models": []string{}})
+	waitRooms(t, srv.URL, map[string]int{"b": 1})
+
+	second.conn.Close()
+	waitRooms(t, srv.URL, map[string]int{})
+}
+
+// TestSubscriptionFilter 订阅了型号的客户端只收到该型号的任务，未订阅的客户端收到全部，取消订阅后恢复接收全部
+func TestSubscriptionFilter(t *testing.T) {
+	srv := startTestServer(t)
+	m1 := dialTestClient(t, srv, "client_id=m1")
+	m2 := dialTestClient(t, srv, "client_id=m2")
+	all := dialTestClient(t, srv, "client_id=all")
+	m1.Send(protocolSubscribe, map[string]any{"models": []string{"m1"}})
+	m2.Send(protocolSubscribe, map[string]any{"models": []string{"m2", "m3"}})
+	waitRooms(t, srv.URL, map[string]int{"m1": 1, "m2": 1, "m3": 1})
+
+	for _, model := range []string{"m1", "m2", "m3", "m1"} {
+		postTask(t, srv, model)
+	}
+	expect := func(client *testClient, models ...string) {
+		t.Helper()
+		for _, model := range models {
+			if env := client.RecvProtocol(1); env.Data["model"] != model {
+				t.Fatalf("received %v, want model %s", env.Data, model)
+			}
+		}
+	}
+	expect(all, "m1", "m2", "m3", "m1")
+	expect(m2, "m2", "m3")
+	expect(m1, "m1", "m1")
+
+	// 空数组取消订阅；m2 之前的任务已全部取出，下一条收到的就是新广播
+	m2.Send(protocolSubscribe, map[string]any{"models": []string{}})
+	waitRooms(t, srv.URL, map[string]int{"m1": 1})
+	postTask(t, srv, "m4")
+	expect(m2, "m4")
+	expect(all, "m4")
+	postTask(t, srv, "m1")
+	// m1 没有收到 m4
+	expect(m1, "m1")
+}
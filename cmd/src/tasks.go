@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 默认保留的最近任务数
+const defaultTaskHistory = 4096
+
+// 同一任务收到多个结果时的处理方式
+const (
+	// 只采纳第一个结果，之后的结果记录警告后丢弃
+	resultFirst = "first"
+	// 后到的结果覆盖之前的结果
+	resultLast = "last"
+)
+
+// 当前的重复结果处理方式，由 -duplicate-result 配置
+var resultPolicy = resultFirst
+
+var (
+	errUnknownTask     = errors.New("unknown task")
+	errDuplicateResult = errors.New("task already has a result")
+)
+
+// parseResultPolicy 校验 -duplicate-result 参数
+func parseResultPolicy(policy string) (string, error) {
+	switch policy {
+	case resultFirst, resultLast:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid duplicate result policy %q, expected %s or %s", policy, resultFirst, resultLast)
+}
+
+// 任务状态
+const (
+	taskPending = "pending"
+	// 复判端已确认收到，尚未回传结果
+	taskAcknowledged = "acknowledged"
+	taskCompleted    = "completed"
+)
+
+// taskRecord 记录一个已广播任务的状态，复判端确认收到后标记为已确认，报告进度后标记为处理中，
+// 在结果中带回 task_id 后标记为完成
+type taskRecord struct {
+	ID          string          `json:"task_id"`
+	Status      string          `json:"status"`
+	CreatedAt   time.Time       `json:"created_at"`
+	AckedAt     *time.Time      `json:"acked_at,omitempty"`
+	CompletedAt *time.Time      `json:"completed_at,omitempty"`
+	Reviewer    string          `json:"reviewer,omitempty"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	// 复判端报告的进度，按时间顺序排列
+	Progress []progressUpdate `json:"progress,omitempty"`
+	// 首次广播之后 Hub 又将该任务投递出去的次数，随记录一起淘汰
+	Retries int `json:"retries,omitempty"`
+	// 启用追踪时任务对应的 span
+	Span *taskSpan `json:"span,omitempty"`
+}
+
+// taskStore 以互斥锁保护最近的任务记录，超出容量时淘汰最早创建的任务
+type taskStore struct {
+	mu      sync.Mutex
+	size    int
+	records map[string]*taskRecord
+	// 按创建顺序排列的任务 id，用于淘汰
+	order []string
+}
+
+var tasks = newTaskStore(defaultTaskHistory)
+
+func newTaskStore(size int) *taskStore {
+	return &taskStore{size: size, records: make(map[string]*taskRecord)}
+}
+
+// newTaskID 生成任务 id
+func newTaskID() string {
+	return randomHex(8)
+}
+
+// add 登记一个新广播的任务。超出容量时淘汰最早创建的任务，尚未完成的任务的 span 以错误状态结束
+func (s *taskStore) add(id string, now time.Time) {
+	s.mu.Lock()
+	if s.size <= 0 {
+		s.mu.Unlock()
+		return
+	}
+	var evicted []*taskRecord
+	for len(s.order) >= s.size {
+		evicted = append(evicted, s.records[s.order[0]])
+		delete(s.records, s.order[0])
+		s.order = s.order[1:]
+	}
+	s.records[id] = &taskRecord{ID: id, Status: taskPending, CreatedAt: now}
+	s.order = append(s.order, id)
+	s.mu.Unlock()
+	// 导出 span 可能较慢，在锁外进行
+	for _, record := range evicted {
+		if record.Status != taskCompleted {
+			abortTaskSpan(record.ID, record.Span, "task evicted before a result arrived")
+		}
+	}
+}
+
+// remove 撤销未能广播的任务的登记并以错误状态结束其 span，未知的 id 直接忽略
+func (s *taskStore) remove(ids ...string) {
+	s.mu.Lock()
+	var removed []*taskRecord
+	for _, id := range ids {
+		record, ok := s.records[id]
+		if !ok {
+			continue
+		}
+		removed = append(removed, record)
+		delete(s.records, id)
+		for i, existing := range s.order {
+			if existing == id {
+				s.order = append(s.order[:i], s.order[i+1:]...)
+				break
+			}
+		}
+	}
+	s.mu.Unlock()
+	for _, record := range removed {
+		abortTaskSpan(record.ID, record.Span, "task was not broadcast")
+	}
+}
+
+// setSpan 关联任务的追踪 span，span 为 nil 时不做任何事
+func (s *taskStore) setSpan(id string, span *taskSpan) {
+	if span == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if record, ok := s.records[id]; ok {
+		record.Span = span
+	}
+}
+
+// complete 记录任务的复判结果并返回更新后的记录副本。任务未知（未登记或已淘汰）时返回 errUnknownTask；
+// 任务已有结果且 resultPolicy 为 first 时返回 errDuplicateResult，记录保持不变
+func (s *taskStore) complete(id, reviewer string, result []byte, now time.Time) (taskRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[id]
+	if !ok {
+		return taskRecord{}, errUnknownTask
+	}
+	if record.Status == taskCompleted && resultPolicy == resultFirst {
+		return *record, errDuplicateResult
+	}
+	record.Status = taskCompleted
+	record.CompletedAt = &now
+	record.Reviewer = reviewer
+	record.Result = json.RawMessage(result)
+	return *record, nil
+}
+
+// get 返回任务记录的副本
+func (s *taskStore) get(id string) (taskRecord, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[id]
+	if !ok {
+		return taskRecord{}, false
+	}
+	return *record, true
+}
+
+// taskLocation 返回任务结果的查询地址，与 /tasks 使用相同的路由前缀
+func taskLocation(r *http.Request, id string) string {
+	prefix := strings.TrimSuffix(strings.TrimSuffix(r.URL.Path, "/batch"), "/tasks")
+	return prefix + "/results/" + id
+}
+
+// resultsHandler 处理 GET /results/{task_id}，返回任务状态，完成时附带复判结果
+func resultsHandler(w http.ResponseWriter, r *http.Request) {
+	ip, port, err := splitRemoteAddr(r.RemoteAddr)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Cannot resolve client address")
+		return
+	}
+	logRequest(r, ip, port)
+
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	id := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	if id == "" {
+		writeError(w, http.StatusBadRequest, "Missing task id")
+		return
+	}
+	record, ok := tasks.get(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown task id")
+		return
+	}
+	writeJSON(w, http.StatusOK, record)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// 单个 IP 连接次数的默认统计窗口
+const defaultConnWindow = time.Minute
+
+// connThrottle 按来源 IP 统计一个固定窗口内的连接次数，超过上限的升级请求被拒绝
+type connThrottle struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	counts map[string]*ipCounter
+	// 上次清理过期计数的时间
+	lastSweep time.Time
+}
+
+// ipCounter 是单个 IP 在当前窗口内的连接次数
+type ipCounter struct {
+	start time.Time
+	count int
+}
+
+// 为 nil 时不限制，由 -max-conns-per-ip 配置
+var throttle *connThrottle
+
+func newConnThrottle(limit int, window time.Duration) *connThrottle {
+	return &connThrottle{limit: limit, window: window, counts: make(map[string]*ipCounter)}
+}
+
+// allow 记录一次来自 ip 的连接尝试，返回是否未超过上限
+func (t *connThrottle) allow(ip string, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// 每个窗口最多清理一次，删除已过期的计数，避免 map 随来源 IP 无限增长
+	if now.Sub(t.lastSweep) >= t.window {
+		for key, c := range t.counts {
+			if now.Sub(c.start) >= t.window {
+				delete(t.counts, key)
+			}
+		}
+		t.lastSweep = now
+	}
+	c, ok := t.counts[ip]
+	if !ok || now.Sub(c.start) >= t.window {
+		c = &ipCounter{start: now}
+		t.counts[ip] = c
+	}
+	c.count++
+	return c.count <= t.limit
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestConnThrottle 同一 IP 在窗口内超过上限的连接被拒绝，窗口过后重新计数，不同 IP 互不影响
+func TestConnThrottle(t *testing.T) {
+	throttle := newConnThrottle(3, time.Minute)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if !throttle.allow("10.0.0.1", now) {
+			t.Fatalf("attempt %d refused, want allowed", i+1)
+		}
+	}
+	if throttle.allow("10.0.0.1", now.Add(time.Second)) {
+		t.Fatal("4th attempt allowed, want refused")
+	}
+	if !throttle.allow("10.0.0.2", now.Add(time.Second)) {
+		t.Fatal("other IP refused, want allowed")
+	}
+	if !throttle.allow("10.0.0.1", now.Add(time.Minute)) {
+		t.Fatal("attempt after window refused, want allowed")
+	}
+	// 过期的计数在下一个窗口被清理
+	throttle.allow("10.0.0.3", now.Add(3*time.Minute))
+	throttle.mu.Lock()
+	defer throttle.mu.Unlock()
+	if len(throttle.counts) != 1 {
+		t.Fatalf("%d counters after sweep, want 1", len(throttle.counts))
+	}
+}
+
+// TestConnThrottleUpgrade 超过 -max-conns-per-ip 的升级请求得到 429
+func TestConnThrottleUpgrade(t *testing.T) {
+	t.Cleanup(func() { throttle = nil })
+	srv := startTestServer(t)
+	throttle = newConnThrottle(2, time.Minute)
+
+	dialTestClient(t, srv, "")
+	dialTestClient(t, srv, "")
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", nil)
+	if err == nil {
+		conn.Close()
+		t.Fatal("3rd connection accepted, want refused")
+	}
+	if resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("3rd connection: response %v, want status %d", resp, http.StatusTooManyRequests)
+	}
+}
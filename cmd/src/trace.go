@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 追踪数据的导出方式
+const (
+	traceExportNone = ""
+	// 结束的 span 以日志形式输出，可由日志采集转入追踪系统
+	traceExportLog = "log"
+	// 结束的 span 经 OTLP/HTTP 批量发送给采集端，地址等由标准的 OTEL_EXPORTER_OTLP_* 环境变量配置
+	traceExportOTLP = "otlp"
+)
+
+// span 的导出方式，由 -trace-export 配置，为空时不做追踪
+var traceExport = traceExportNone
+
+// 启用追踪时的 TracerProvider，未启用时为 nil。需在开始处理请求之前由 setupTracing 设置
+var tracerProvider *sdktrace.TracerProvider
+
+// 按 W3C Trace Context 从请求头中提取追踪上下文，并写入广播的 traceparent
+var tracePropagator = propagation.TraceContext{}
+
+// parseTraceExport 校验 -trace-export 的取值
+func parseTraceExport(export string) (string, error) {
+	switch export {
+	case traceExportNone, traceExportLog, traceExportOTLP:
+		return export, nil
+	}
+	return "", fmt.Errorf("unknown trace exporter %q, expected %s or %s", export, traceExportLog, traceExportOTLP)
+}
+
+// setupTracing 按导出方式创建 TracerProvider，export 为空时关闭追踪
+func setupTracing(export string) error {
+	var opt sdktrace.TracerProviderOption
+	switch export {
+	case traceExportNone:
+		tracerProvider = nil
+		return nil
+	case traceExportLog:
+		opt = sdktrace.WithSyncer(logSpanExporter{})
+	case traceExportOTLP:
+		exporter, err := otlptracehttp.New(context.Background())
+		if err != nil {
+			return fmt.Errorf("create OTLP exporter: %w", err)
+		}
+		opt = sdktrace.WithBatcher(exporter)
+	default:
+		return fmt.Errorf("unknown trace exporter %q", export)
+	}
+	tracerProvider = sdktrace.NewTracerProvider(opt,
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "review-server"))))
+	return nil
+}
+
+// shutdownTracing 导出尚未发送的 span 并关闭 TracerProvider，未启用追踪时不做任何事
+func shutdownTracing(ctx context.Context) {
+	if tracerProvider == nil {
+		return
+	}
+	if err := tracerProvider.Shutdown(ctx); err != nil {
+		errorf("Trace exporter shutdown error: %v", err)
+	}
+}
+
+// taskSpan 是一个任务从 /tasks 收到到复判结果返回的 span
+type taskSpan struct {
+	TraceID string `json:"trace_id"`
+	SpanID  string `json:"span_id"`
+	// 检测端请求中携带的上游 span，没有时为空
+	ParentID string `json:"parent_id,omitempty"`
+	// 以本 span 为父节点的 traceparent
+	traceparent string
+	span        trace.Span
+}
+
+// startTaskSpan 从请求的 traceparent 头中继承追踪上下文并开始新的 span，
+// 头不存在或格式不合法时开始新的追踪。未启用追踪时返回 nil
+func startTaskSpan(r *http.Request) *taskSpan {
+	if tracerProvider == nil {
+		return nil
+	}
+	ctx := tracePropagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	parent := trace.SpanContextFromContext(ctx)
+	ctx, span := tracerProvider.Tracer("review-server").Start(ctx, "review_task", trace.WithSpanKind(trace.SpanKindServer))
+	sc := span.SpanContext()
+	carrier := propagation.MapCarrier{}
+	tracePropagator.Inject(ctx, carrier)
+	result := &taskSpan{TraceID: sc.TraceID().String(), SpanID: sc.SpanID().String(), traceparent: carrier.Get("traceparent"), span: span}
+	if parent.IsValid() {
+		result.ParentID = parent.SpanID().String()
+	}
+	return result
+}
+
+// endTaskSpan 在任务完成时结束其 span 并导出
+func endTaskSpan(record taskRecord) {
+	if record.Span == nil || record.CompletedAt == nil {
+		return
+	}
+	span := record.Span.span
+	span.SetAttributes(attribute.String("task.id", record.ID), attribute.String("review.reviewer", record.Reviewer))
+	span.End(trace.WithTimestamp(*record.CompletedAt))
+}
+
+// abortTaskSpan 在任务没有结果就被撤销或淘汰时以错误状态结束其 span，span 为 nil 时不做任何事
+func abortTaskSpan(id string, span *taskSpan, reason string) {
+	if span == nil {
+		return
+	}
+	span.span.SetAttributes(attribute.String("task.id", id))
+	span.span.SetStatus(codes.Error, reason)
+	span.span.End()
+}
+
+// logSpanExporter 以日志形式输出结束的 span
+type logSpanExporter struct{}
+
+func (logSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	for _, span := range spans {
+		var taskID, reviewer string
+		for _, kv := range span.Attributes() {
+			switch kv.Key {
+			case "task.id":
+				taskID = kv.Value.AsString()
+			case "review.reviewer":
+				reviewer = kv.Value.AsString()
+			}
+		}
+		parentID := ""
+		if span.Parent().IsValid() {
+			parentID = span.Parent().SpanID().String()
+		}
+		infof("span name=%s trace_id=%s span_id=%s parent_id=%s task_id=%s reviewer=%s status=%s error=%q duration=%v",
+			span.Name(), span.SpanContext().TraceID(), span.SpanContext().SpanID(), parentID, taskID, reviewer,
+			span.Status().Code, span.Status().Description, span.EndTime().Sub(span.StartTime()))
+	}
+	return nil
+}
+
+func (logSpanExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// W3C Trace Context 的 traceparent 格式：version-trace_id-parent_id-flags
+var traceparentPattern = regexp.MustCompile(`^00-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+
+// postTracedTask 以 /tasks 广播一个任务，请求带有 traceparent 头（为空时不带）
+func postTracedTask(t *testing.T, srvURL, traceparent string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, srvURL+"/tasks?address=/img/1.jpg&model=m1&version=v1", nil)
+	if traceparent != "" {
+		req.Header.Set("traceparent", traceparent)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("post task: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("post task: status %d", resp.StatusCode)
+	}
+}
+
+// recvTraceparent 返回下一条任务广播的 traceparent 和任务数据
+func recvTraceparent(t *testing.T, client *testClient) (string, InspectorResult) {
+	t.Helper()
+	for {
+		var task struct {
+			ProtocolID  int64           `json:"protocol_id"`
+			Traceparent string          `json:"traceparent"`
+			Data        InspectorResult `json:"data"`
+		}
+		if err := json.Unmarshal(client.RecvRaw(), &task); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if task.ProtocolID == 1 {
+			return task.Traceparent, task.Data
+		}
+	}
+}
+
+// TestTraceparent 启用追踪时广播带有继承了请求 trace id 的 traceparent，结果返回时以日志导出 span；
+// 未启用时广播不带 traceparent
+func TestTraceparent(t *testing.T) {
+	srv := startTestServer(t)
+	client := dialTestClient(t, srv, "client_id=tracer")
+	waitClients(t, 1)
+
+	postTracedTask(t, srv.URL, "")
+	if traceparent, _ := recvTraceparent(t, client); traceparent != "" {
+		t.Fatalf("traceparent %q with tracing disabled", traceparent)
+	}
+
+	t.Cleanup(func() { setupTracing(traceExportNone) })
+	if err := setupTracing(traceExportLog); err != nil {
+		t.Fatalf("setup tracing: %v", err)
+	}
+	logs := captureLogs(t, "info")
+	const traceID, parentID = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	postTracedTask(t, srv.URL, "00-"+traceID+"-"+parentID+"-01")
+	traceparent, task := recvTraceparent(t, client)
+	m := traceparentPattern.FindStringSubmatch(traceparent)
+	if m == nil || m[1] != traceID || m[2] == parentID {
+		t.Fatalf("traceparent %q, want trace id %s with a new span id", traceparent, traceID)
+	}
+
+	client.Send(2, task)
+	waitFor(t, func() bool {
+		return logLine(logs, "span name=review_task", "trace_id="+traceID, "span_id="+m[2], "parent_id="+parentID, "task_id="+task.TaskID) != ""
+	})
+
+	// 不合法的 traceparent 开始新的追踪
+	postTracedTask(t, srv.URL, "00-"+strings.Repeat("0", 32)+"-"+parentID+"-01")
+	if traceparent, _ := recvTraceparent(t, client); !traceparentPattern.MatchString(traceparent) || strings.Contains(traceparent, parentID) {
+		t.Errorf("traceparent %q, want a new trace", traceparent)
+	}
+}
+
+// TestTraceOTLP 以 otlp 导出时，关闭追踪前结束的 span 经 OTLP/HTTP 发送给采集端
+func TestTraceOTLP(t *testing.T) {
+	received := make(chan []byte, 4)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path == "/v1/traces" {
+			received <- body
+		}
+	}))
+	defer collector.Close()
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", collector.URL)
+
+	srv := startTestServer(t)
+	client := dialTestClient(t, srv, "client_id=tracer")
+	waitClients(t, 1)
+	t.Cleanup(func() { setupTracing(traceExportNone) })
+	if err := setupTracing(traceExportOTLP); err != nil {
+		t.Fatalf("setup tracing: %v", err)
+	}
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	postTracedTask(t, srv.URL, "00-"+traceID+"-00f067aa0ba902b7-01")
+	_, task := recvTraceparent(t, client)
+	client.Send(2, task)
+	waitFor(t, func() bool {
+		record, ok := tasks.get(task.TaskID)
+		return ok && record.Status == taskCompleted
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), testRecvTimeout)
+	defer cancel()
+	shutdownTracing(ctx)
+	want, _ := hex.DecodeString(traceID)
+	select {
+	case body := <-received:
+		if !bytes.Contains(body, want) || !bytes.Contains(body, []byte(task.TaskID)) {
+			t.Fatalf("exported spans do not carry trace id %s and task %s", traceID, task.TaskID)
+		}
+	default:
+		t.Fatal("no spans exported to the collector")
+	}
+}
+
+// TestTaskSpanAborted 没有结果就被撤销或淘汰的任务，其 span 以错误状态结束并导出
+func TestTaskSpanAborted(t *testing.T) {
+	saved := tasks
+	t.Cleanup(func() { tasks = saved })
+	tasks = newTaskStore(1)
+	t.Cleanup(func() { setupTracing(traceExportNone) })
+	if err := setupTracing(traceExportLog); err != nil {
+		t.Fatalf("setup tracing: %v", err)
+	}
+	logs := captureLogs(t, "info")
+	req := httptest.NewRequest(http.MethodPost, "/tasks", nil)
+
+	tasks.add("removed", time.Now())
+	tasks.setSpan("removed", startTaskSpan(req))
+	tasks.remove("removed")
+	if logLine(logs, "span name=review_task", "task_id=removed", "status=Error", "not broadcast") == "" {
+		t.Errorf("no error span for the removed task:\n%s", logs)
+	}
+
+	tasks.add("evicted", time.Now())
+	tasks.setSpan("evicted", startTaskSpan(req))
+	tasks.add("next", time.Now())
+	if logLine(logs, "span name=review_task", "task_id=evicted", "status=Error", "evicted") == "" {
+		t.Errorf("no error span for the evicted task:\n%s", logs)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// TestBroadcastTransform 客户端收到变换后的广播，变换返回错误的广播被丢弃
+func TestBroadcastTransform(t *testing.T) {
+	srv := startTestServer(t)
+	// 在 run() 中安装变换，避免与正在运行的 Hub 竞争
+	hub.query(func() {
+		hub.BroadcastTransform = func(message []byte) ([]byte, error) {
+			if bytes.Contains(message, []byte(`"model":"secret"`)) {
+				return nil, errors.New("secret model")
+			}
+			return bytes.ReplaceAll(message, []byte("/img/"), []byte("/redacted/")), nil
+		}
+	})
+	client := dialTestClient(t, srv, "")
+	waitClients(t, 1)
+
+	postTask(t, srv, "secret")
+	postTask(t, srv, "m1")
+	// 被丢弃的广播不会下发，收到的第一条任务就是变换后的 m1
+	env := client.RecvProtocol(1)
+	if env.Data["model"] != "m1" || env.Data["target"] != "/redacted/1.jpg" {
+		t.Errorf("received %v, want model m1 with target /redacted/1.jpg", env.Data)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// postTaskTTL 以 /tasks 广播一个带有效期（毫秒）的任务
+func postTaskTTL(t *testing.T, srvURL, model, ttl string) {
+	t.Helper()
+	resp, err := http.Post(srvURL+"/tasks?address=/img/1.jpg&model="+model+"&version=v1&ttl="+ttl, "", nil)
+	if err != nil {
+		t.Fatalf("post task: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("post task with ttl %s: status %d", ttl, resp.StatusCode)
+	}
+}
+
+// TestTTLExpiredDropped 慢客户端缓冲中超过有效期的任务在写出前被丢弃，未过期的消息照常送达
+func TestTTLExpiredDropped(t *testing.T) {
+	srv := startTestServer(t)
+	client, ws := dialFaulty(t, srv)
+	server := hubClient(t)
+
+	// 写入被阻塞期间，后续的消息在发送缓冲中等待
+	ws.hold.Lock()
+	postTask(t, srv, "first")
+	waitFor(t, func() bool { return ws.waiting.Load() == 1 })
+	dropped := stats.droppedMessages.Load()
+	postTaskTTL(t, srv.URL, "stale", "20")
+	postTask(t, srv, "fresh")
+	time.Sleep(100 * time.Millisecond)
+	ws.hold.Unlock()
+
+	if env := client.RecvProtocol(1); env.Data["model"] != "first" {
+		t.Fatalf("received %v, want first", env.Data)
+	}
+	if env := client.RecvProtocol(1); env.Data["model"] != "fresh" {
+		t.Fatalf("received %v, want the expired task dropped and fresh delivered", env.Data)
+	}
+	if server.dropped.Load() != 1 || stats.droppedMessages.Load() != dropped+1 {
+		t.Errorf("dropped %d for the client, %d overall; want 1 each", server.dropped.Load(), stats.droppedMessages.Load()-dropped)
+	}
+
+	// 在有效期内写出的任务不受影响
+	postTaskTTL(t, srv.URL, "timely", "60000")
+	if env := client.RecvProtocol(1); env.Data["model"] != "timely" {
+		t.Errorf("received %v, want timely", env.Data)
+	}
+}
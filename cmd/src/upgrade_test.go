@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestMaxConcurrentUpgrades 升级名额被占满时，同时到达的升级请求全部以 503 拒绝并带 Retry-After，
+// 名额释放后恢复接受
+func TestMaxConcurrentUpgrades(t *testing.T) {
+	const slots, attempts = 3, 20
+	upgradeSlots = make(chan struct{}, slots)
+	defer func() { upgradeSlots = nil }()
+	srv := startTestServer(t)
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+
+	// 占满名额，模拟正在进行中的握手
+	for i := 0; i < slots; i++ {
+		upgradeSlots <- struct{}{}
+	}
+	var wg sync.WaitGroup
+	statuses := make([]int, attempts)
+	for i := range statuses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			conn, resp, err := websocket.DefaultDialer.Dial(url, nil)
+			if err == nil {
+				conn.Close()
+				return
+			}
+			if resp != nil && resp.Header.Get("Retry-After") != "" {
+				statuses[i] = resp.StatusCode
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i, status := range statuses {
+		if status != http.StatusServiceUnavailable {
+			t.Errorf("attempt %d: status %d, want 503 with Retry-After", i, status)
+		}
+	}
+	waitClients(t, 0)
+
+	// 释放一个名额后可以正常升级，完成后名额归还
+	<-upgradeSlots
+	dialTestClient(t, srv, "")
+	waitClients(t, 1)
+	if n := len(upgradeSlots); n != slots-1 {
+		t.Errorf("%d upgrade slots in use after the upgrade finished, want %d", n, slots-1)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// 任务可用的参数名
+var taskParamNames = []string{"address", "model", "version"}
+
+// 广播前必须非空的任务参数，可通过 -required-task-params 配置
+var requiredTaskParams = []string{"address", "model", "version"}
+
+// parseRequiredTaskParams 解析逗号分隔的必填参数列表，未知参数名返回错误，空串表示不校验
+func parseRequiredTaskParams(list string) ([]string, error) {
+	var params []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		known := false
+		for _, n := range taskParamNames {
+			if n == name {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown task param %q, expected one of %s", name, strings.Join(taskParamNames, ","))
+		}
+		params = append(params, name)
+	}
+	return params, nil
+}
+
+// validateTask 检查必填参数是否为空，返回描述缺失参数的错误
+func validateTask(values map[string]string) error {
+	var missing []string
+	for _, name := range requiredTaskParams {
+		if strings.TrimSpace(values[name]) == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required params: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// inspectorSource 返回任务的来源标识：优先使用 inspector_id 参数，未提供时使用检测端 IP。
+// 来源随任务广播下发，复判端在结果中原样带回，用于区分多个检测端
+func inspectorSource(r *http.Request, ip string) (string, error) {
+	id := r.URL.Query().Get("inspector_id")
+	if id == "" {
+		return ip, nil
+	}
+	if !clientIDPattern.MatchString(id) {
+		return "", fmt.Errorf("invalid inspector_id")
+	}
+	return id, nil
+}
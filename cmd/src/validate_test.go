@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestTaskValidation 缺少必填参数的任务返回 400 并列出缺失项，不会广播；必填参数可配置
+func TestTaskValidation(t *testing.T) {
+	defer func(saved []string) { requiredTaskParams = saved }(requiredTaskParams)
+	srv := startTestServer(t)
+	client := dialTestClient(t, srv, "")
+	waitClients(t, 1)
+
+	post := func(query string) (int, string) {
+		t.Helper()
+		resp, err := http.Post(srv.URL+"/tasks?"+query, "", nil)
+		if err != nil {
+			t.Fatalf("post task: %v", err)
+		}
+		defer resp.Body.Close()
+		var result map[string]any
+		json.NewDecoder(resp.Body).Decode(&result)
+		msg, _ := result["error"].(string)
+		return resp.StatusCode, msg
+	}
+	for query, missing := range map[string]string{
+		"address=/img/1.jpg&model=m1":             "version",
+		"address=/img/1.jpg&model=%20&version=v1": "model",
+		"address=/img/1.jpg":                      "model, version",
+	} {
+		if status, msg := post(query); status != http.StatusBadRequest || !strings.HasSuffix(msg, "missing required params: "+missing) {
+			t.Errorf("%s = %d %q, want 400 missing %s", query, status, msg, missing)
+		}
+	}
+
+	// 只要求 address 时，缺少型号和版本的任务也会广播
+	requiredTaskParams = []string{"address"}
+	if status, msg := post("address=/img/2.jpg"); status != http.StatusAccepted {
+		t.Fatalf("address only = %d %q, want 202", status, msg)
+	}
+	// 被拒绝的任务没有广播，收到的第一条任务就是这一条
+	if env := client.RecvProtocol(1); env.Data["target"] != "/img/2.jpg" {
+		t.Errorf("received %v, want target /img/2.jpg", env.Data)
+	}
+
+	if params, err := parseRequiredTaskParams(" model, address ,"); err != nil || !reflect.DeepEqual(params, []string{"model", "address"}) {
+		t.Errorf("parseRequiredTaskParams = %v, %v", params, err)
+	}
+	if params, err := parseRequiredTaskParams(""); err != nil || len(params) != 0 {
+		t.Errorf("empty list = %v, %v; want no required params", params, err)
+	}
+	if _, err := parseRequiredTaskParams("model,colour"); err == nil {
+		t.Error("unknown param accepted")
+	}
+}
+
+// TestInspectorSource 任务的 source 为 inspector_id，未指定时为检测端 IP；复判端带回的 source 随结果保存，
+// 不合法的 inspector_id 返回 400
+func TestInspectorSource(t *testing.T) {
+	srv := startTestServer(t)
+	client := dialTestClient(t, srv, "client_id=reviewer-1")
+	waitClients(t, 1)
+
+	post := func(query string) int {
+		t.Helper()
+		resp, err := http.Post(srv.URL+"/tasks?address=/img/1.jpg&model=m1&version=v1"+query, "", nil)
+		if err != nil {
+			t.Fatalf("post task: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	post("&inspector_id=line-a")
+	post("")
+	if status := post("&inspector_id=bad%20id"); status != http.StatusBadRequest {
+		t.Errorf("invalid inspector_id: status %d, want %d", status, http.StatusBadRequest)
+	}
+
+	for _, want := range []string{"line-a", "127.0.0.1"} {
+		var task InspectorResult
+		if err := client.RecvProtocol(1).decodeData(&task); err != nil {
+			t.Fatalf("decode task: %v", err)
+		}
+		if task.Source != want {
+			t.Fatalf("task source %q, want %q", task.Source, want)
+		}
+		client.Send(2, task)
+		waitFor(t, func() bool {
+			record, ok := tasks.get(task.TaskID)
+			return ok && record.Status == taskCompleted
+		})
+		record, _ := tasks.get(task.TaskID)
+		var result struct{ Data InspectorResult }
+		if err := json.Unmarshal(record.Result, &result); err != nil || result.Data.Source != want {
+			t.Errorf("result %s, want source %q", record.Result, want)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+)
+
+// 构建信息，发布时通过 -ldflags "-X main.version=... -X main.gitCommit=... -X main.buildTime=..." 注入
+var (
+	version   = "dev"
+	gitCommit = "dev"
+	buildTime = "dev"
+)
+
+// VersionInfo 是 /version 接口返回的构建信息
+type VersionInfo struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"git_commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+// versionHandler 返回当前运行的构建信息，便于确认部署的版本
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	ip, port, err := splitRemoteAddr(r.RemoteAddr)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Cannot resolve client address")
+		return
+	}
+	logRequest(r, ip, port)
+	writeJSON(w, http.StatusOK, VersionInfo{
+		Version:   version,
+		GitCommit: gitCommit,
+		BuildTime: buildTime,
+		GoVersion: runtime.Version(),
+	})
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"testing"
+)
+
+// TestVersion /version 返回构建时注入的版本、提交和构建时间，未注入时为 dev
+func TestVersion(t *testing.T) {
+	srv := startTestServer(t)
+	var defaults VersionInfo
+	if status := getJSON(t, srv, "/version", &defaults); status != http.StatusOK {
+		t.Fatalf("status %d", status)
+	}
+	if want := (VersionInfo{Version: "dev", GitCommit: "dev", BuildTime: "dev", GoVersion: runtime.Version()}); defaults != want {
+		t.Errorf("/version = %+v, want %+v", defaults, want)
+	}
+
+	defer func() { version, gitCommit, buildTime = "dev", "dev", "dev" }()
+	version, gitCommit, buildTime = "1.4.0", "0a1b2c3", "2024-06-01T00:00:00Z"
+	var injected VersionInfo
+	getJSON(t, srv, "/version", &injected)
+	if injected.Version != "1.4.0" || injected.GitCommit != "0a1b2c3" || injected.BuildTime != "2024-06-01T00:00:00Z" {
+		t.Errorf("/version = %+v, want the injected build info", injected)
+	}
+}
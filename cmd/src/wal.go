@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// WAL 记录类型
+const (
+	walKindBroadcast = "broadcast"
+	walKindResult    = "result"
+)
+
+// WALRecord 是写前日志中的一条记录，每条记录占一行 JSON
+type WALRecord struct {
+	Timestamp int64           `json:"ts"`
+	Kind      string          `json:"kind"`
+	Envelope  json.RawMessage `json:"envelope"`
+}
+
+// WAL 将广播和收到的复判结果追加写入文件，用于崩溃后恢复。
+// 写入由独立的 goroutine 完成，调用方不会被磁盘 IO 阻塞
+type WAL struct {
+	file    *os.File
+	records chan WALRecord
+	done    chan struct{}
+
+	// 保护 closed，避免关闭后继续向 records 写入
+	mu     sync.RWMutex
+	closed bool
+}
+
+// 写入队列长度，队列满时丢弃记录并打日志
+const walQueueSize = 1024
+
+// wal 为 nil 时表示未启用写前日志
+var wal *WAL
+
+// openWAL 以追加方式打开写前日志文件，并统计已有的记录数
+func openWAL(path string) (*WAL, error) {
+	existing, err := countWALRecords(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	infof("WAL opened: %s, existing records: %d", path, existing)
+
+	w := &WAL{
+		file:    file,
+		records: make(chan WALRecord, walQueueSize),
+		done:    make(chan struct{}),
+	}
+	go w.writeLoop()
+	return w, nil
+}
+
+// countWALRecords 统计文件中已有的记录数，文件不存在时返回 0
+func countWALRecords(path string) (int, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	n := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		n++
+	}
+	return n, scanner.Err()
+}
+
+// append 将一条消息加入写入队列，wal 未启用时不做任何事
+func (w *WAL) append(kind string, envelope []byte) {
+	if w == nil {
+		return
+	}
+	record := WALRecord{
+		Timestamp: time.Now().UnixMilli(),
+		Kind:      kind,
+		Envelope:  json.RawMessage(envelope),
+	}
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return
+	}
+	select {
+	case w.records <- record:
+	default:
+		warnf("WAL queue full, %s record dropped", kind)
+	}
+}
+
+// writeLoop 从队列中取出记录写入文件，队列暂时为空时刷新缓冲
+func (w *WAL) writeLoop() {
+	defer close(w.done)
+	writer := bufio.NewWriter(w.file)
+	enc := json.NewEncoder(writer)
+	for record := range w.records {
+		if err := enc.Encode(record); err != nil {
+			errorf("WAL write error: %v", err)
+		}
+		if len(w.records) == 0 {
+			if err := writer.Flush(); err != nil {
+				errorf("WAL flush error: %v", err)
+			}
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		errorf("WAL flush error: %v", err)
+	}
+}
+
+// Close 停止接收新记录，写完队列中剩余的记录后关闭文件
+func (w *WAL) Close() error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.records)
+	w.mu.Unlock()
+	<-w.done
+	return w.file.Close()
+}
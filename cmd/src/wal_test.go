@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestWAL 广播和收到的结果各写入一条带时间戳的记录，重新打开时能读出并统计已有记录
+func TestWAL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "review.wal")
+	w, err := openWAL(path)
+	if err != nil {
+		t.Fatalf("open wal: %v", err)
+	}
+	wal = w
+	// 在 Hub 停止之后才恢复，避免与仍在运行的 Hub 竞争
+	t.Cleanup(func() {
+		w.Close()
+		wal = nil
+	})
+	srv := startTestServer(t)
+	client := dialTestClient(t, srv, "")
+	waitClients(t, 1)
+
+	id := postTask(t, srv, "m1")
+	var data InspectorResult
+	if err := client.RecvProtocol(1).decodeData(&data); err != nil {
+		t.Fatalf("decode task: %v", err)
+	}
+	client.Send(2, data)
+	waitFor(t, func() bool {
+		n, err := countWALRecords(path)
+		return err == nil && n == 2
+	})
+	if err := w.Close(); err != nil {
+		t.Fatalf("close wal: %v", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	defer file.Close()
+	var kinds []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record WALRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("record %q: %v", scanner.Text(), err)
+		}
+		env, err := parseEnvelope(record.Envelope)
+		if err != nil {
+			t.Fatalf("record envelope %s: %v", record.Envelope, err)
+		}
+		if record.Timestamp <= 0 || env.Data["task_id"] != id {
+			t.Errorf("record %+v, want a timestamp and task_id %s", record, id)
+		}
+		kinds = append(kinds, record.Kind)
+	}
+	if len(kinds) != 2 || kinds[0] != walKindBroadcast || kinds[1] != walKindResult {
+		t.Errorf("record kinds %v, want [%s %s]", kinds, walKindBroadcast, walKindResult)
+	}
+
+	// 关闭后的追加被忽略，重新打开时接着已有记录追加
+	w.append(walKindResult, []byte(`{}`))
+	reopened, err := openWAL(path)
+	if err != nil {
+		t.Fatalf("reopen wal: %v", err)
+	}
+	reopened.append(walKindBroadcast, []byte(`{"protocol_id":1,"data":{}}`))
+	reopened.Close()
+	if n, err := countWALRecords(path); err != nil || n != 3 {
+		t.Errorf("%d records after reopening, want 3: %v", n, err)
+	}
+}
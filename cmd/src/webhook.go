@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 结果回调的默认参数
+const (
+	webhookTimeout         = 5 * time.Second
+	defaultWebhookFailures = 5
+	defaultWebhookCooldown = 30 * time.Second
+)
+
+// 熔断器状态，disabled 表示未配置回调
+const (
+	breakerStateClosed   = "closed"
+	breakerStateOpen     = "open"
+	breakerStateHalfOpen = "half-open"
+	breakerStateDisabled = "disabled"
+)
+
+// 复判结果的回调地址，由 -result-webhook 配置，为空时不回调
+var resultWebhook string
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// circuitBreaker 在连续失败达到阈值后熔断一段时间，期间直接跳过调用；
+// 冷却结束后放行一次探测调用（半开），成功则恢复，失败则重新熔断
+type circuitBreaker struct {
+	mu          sync.Mutex
+	maxFailures int
+	cooldown    time.Duration
+	failures    int
+	state       string
+	openedAt    time.Time
+}
+
+func newCircuitBreaker(maxFailures int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{maxFailures: maxFailures, cooldown: cooldown, state: breakerStateClosed}
+}
+
+// 结果回调的熔断器
+var webhookBreaker = newCircuitBreaker(defaultWebhookFailures, defaultWebhookCooldown)
+
+// allow 判断本次是否可以调用。熔断冷却结束后只放行一次探测，探测结果返回前其余调用仍被跳过
+func (b *circuitBreaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerStateOpen:
+		if now.Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerStateHalfOpen
+		infof("Webhook circuit half-open, probing")
+		return true
+	case breakerStateHalfOpen:
+		return false
+	}
+	return true
+}
+
+// record 记录一次调用结果
+func (b *circuitBreaker) record(err error, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		if b.state != breakerStateClosed {
+			infof("Webhook circuit closed, endpoint recovered")
+		}
+		b.state = breakerStateClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == breakerStateHalfOpen || b.failures >= b.maxFailures {
+		if b.state != breakerStateOpen {
+			warnf("Webhook circuit open after %d consecutive failures, pausing for %v: %v", b.failures, b.cooldown, err)
+		}
+		b.state = breakerStateOpen
+		b.openedAt = now
+	}
+}
+
+// currentState 返回熔断器状态，未配置回调时为 disabled
+func (b *circuitBreaker) currentState() string {
+	if resultWebhook == "" {
+		return breakerStateDisabled
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// postResult 将复判结果以 JSON 原样 POST 到回调地址，熔断期间直接跳过
+func postResult(message []byte) {
+	if resultWebhook == "" {
+		return
+	}
+	if !webhookBreaker.allow(time.Now()) {
+		debugf("Webhook skipped, circuit is open")
+		return
+	}
+	err := func() error {
+		resp, err := webhookClient.Post(resultWebhook, "application/json", bytes.NewReader(message))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("webhook returned %s", resp.Status)
+		}
+		return nil
+	}()
+	if err != nil {
+		errorf("Post result to webhook error: %v", err)
+	}
+	webhookBreaker.record(err, time.Now())
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestCircuitBreaker 连续失败达到阈值后熔断，冷却期内跳过调用；冷却结束只放行一次探测，成功恢复，失败重新熔断
+func TestCircuitBreaker(t *testing.T) {
+	b := newCircuitBreaker(2, time.Minute)
+	now := time.Now()
+	errDown := errors.New("down")
+	b.record(errDown, now)
+	if !b.allow(now) {
+		t.Fatal("breaker opened before reaching the failure threshold")
+	}
+	b.record(errDown, now)
+	if b.allow(now.Add(time.Second)) {
+		t.Fatal("open breaker allowed a call during cooldown")
+	}
+
+	probe := now.Add(time.Minute)
+	if !b.allow(probe) || b.allow(probe) {
+		t.Fatal("want exactly one probe after cooldown")
+	}
+	b.record(errDown, probe)
+	if b.allow(probe.Add(time.Second)) {
+		t.Fatal("failed probe did not reopen the breaker")
+	}
+
+	probe = probe.Add(time.Minute)
+	if !b.allow(probe) {
+		t.Fatal("no probe after the second cooldown")
+	}
+	b.record(nil, probe)
+	if !b.allow(probe) || b.state != breakerStateClosed || b.failures != 0 {
+		t.Fatalf("breaker %s with %d failures after a successful probe, want closed", b.state, b.failures)
+	}
+}
+
+// TestWebhookBreaker 回调持续失败时熔断并停止调用，/stats 显示 open；回调恢复后探测成功，熔断器关闭
+func TestWebhookBreaker(t *testing.T) {
+	saved := webhookBreaker
+	t.Cleanup(func() {
+		webhookBreaker = saved
+		resultWebhook = ""
+	})
+	var calls atomic.Int32
+	var healthy atomic.Bool
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer webhook.Close()
+	resultWebhook = webhook.URL
+	webhookBreaker = newCircuitBreaker(3, 50*time.Millisecond)
+	srv := startTestServer(t)
+	breakerState := func() string {
+		var snap StatsSnapshot
+		getJSON(t, srv, "/stats", &snap)
+		return snap.WebhookBreaker
+	}
+	if state := breakerState(); state != breakerStateClosed {
+		t.Fatalf("breaker %s, want closed", state)
+	}
+
+	for i := 0; i < 5; i++ {
+		postResult([]byte(`{"protocol_id":2,"data":{}}`))
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("webhook called %d times, want 3 before the breaker opened", n)
+	}
+	if state := breakerState(); state != breakerStateOpen {
+		t.Fatalf("breaker %s, want open", state)
+	}
+
+	healthy.Store(true)
+	time.Sleep(60 * time.Millisecond)
+	postResult([]byte(`{"protocol_id":2,"data":{}}`))
+	if n := calls.Load(); n != 4 {
+		t.Errorf("webhook called %d times, want one probe after cooldown", n)
+	}
+	if state := breakerState(); state != breakerStateClosed {
+		t.Fatalf("breaker %s after a successful probe, want closed", state)
+	}
+}
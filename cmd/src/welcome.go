@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// welcomeNotice 是客户端注册后收到的第一条消息（protocol_id = protocolWelcome）的 data
+type welcomeNotice struct {
+	// 服务端当前时间（Unix 毫秒），供客户端估算时钟偏差以计算延迟和有效期
+	ServerTime int64  `json:"server_time"`
+	ClientID   string `json:"client_id"`
+	ConnID     string `json:"conn_id"`
+	// 该连接生效的设置
+	Settings    Settings `json:"settings"`
+	Compression bool     `json:"compression"`
+}
+
+// sendWelcome 向刚注册的客户端发送欢迎消息，只能在 run() 中调用，且需在其他消息之前
+func (h *Hub) sendWelcome(client *Client) {
+	welcome, err := json.Marshal(map[string]interface{}{
+		"protocol_id": protocolWelcome,
+		"data": welcomeNotice{
+			ServerTime:  time.Now().UnixMilli(),
+			ClientID:    client.id,
+			ConnID:      client.connID,
+			Settings:    client.settings,
+			Compression: client.compression,
+		},
+	})
+	if err != nil {
+		client.errorf("Error encoding welcome message: %v", err)
+		return
+	}
+	client.send <- outMessage{data: welcome}
+}
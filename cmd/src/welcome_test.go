@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// TestWelcomeFirst 欢迎消息先于补发的积压任务到达，带有服务端时间、客户端标识和生效的设置
+func TestWelcomeFirst(t *testing.T) {
+	srv := startTestServer(t)
+	postTask(t, srv, "queued")
+
+	before := time.Now().UnixMilli()
+	client := dialTestClient(t, srv, "client_id=w1")
+	var welcome struct {
+		ProtocolID int64         `json:"protocol_id"`
+		Data       welcomeNotice `json:"data"`
+	}
+	if err := json.Unmarshal(client.RecvRaw(), &welcome); err != nil {
+		t.Fatalf("decode welcome: %v", err)
+	}
+	after := time.Now().UnixMilli()
+	if welcome.ProtocolID != protocolWelcome {
+		t.Fatalf("first message has protocol_id %d, want %d", welcome.ProtocolID, protocolWelcome)
+	}
+	data := welcome.Data
+	if data.ServerTime < before || data.ServerTime > after {
+		t.Errorf("server_time %d outside [%d, %d]", data.ServerTime, before, after)
+	}
+	if data.ClientID != "w1" || data.ConnID == "" || data.Settings.MaxMessageSize != maxMessageSize {
+		t.Errorf("welcome %+v, want client_id w1, a conn_id and the current settings", data)
+	}
+	if env := client.RecvProtocol(1); env.Data["model"] != "queued" {
+		t.Errorf("received %v, want the queued task after the welcome", env.Data)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"sync/atomic"
+)
+
+// countingConn 统计写入底层连接的字节数，即压缩后实际发出的字节数（含握手响应和控制帧）
+type countingConn struct {
+	net.Conn
+	written *atomic.Int64
+	// 协商了压缩的连接同时计入 stats.compressedWireBytes
+	compressed bool
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.written.Add(int64(n))
+	if c.compressed {
+		stats.compressedWireBytes.Add(int64(n))
+	}
+	return n, err
+}
+
+// wireCounter 包装 ResponseWriter，使升级时 Hijack 得到的连接带有写入计数
+type wireCounter struct {
+	http.ResponseWriter
+	written    *atomic.Int64
+	compressed bool
+}
+
+func (w *wireCounter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	return &countingConn{Conn: conn, written: w.written, compressed: w.compressed}, brw, nil
+}
+
+// compressionRatio 返回实际发出的字节数与压缩前字节数之比，小于 1 说明压缩有效；没有数据时为 0
+func compressionRatio(wire, payload int64) float64 {
+	if payload == 0 {
+		return 0
+	}
+	return float64(wire) / float64(payload)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// faultyConn 在 arm 之后的第 failAt 次写入时只写出一半数据并返回错误，模拟写到一半断开的连接；
+// hold 被锁住期间写入阻塞，模拟读取缓慢的客户端
+type faultyConn struct {
+	net.Conn
+	armed  atomic.Bool
+	writes atomic.Int32
+	failAt int32
+	hold   sync.Mutex
+	// 正在等待 hold 的写入数
+	waiting atomic.Int32
+}
+
+var errInjectedWrite = errors.New("injected write failure")
+
+func (c *faultyConn) Write(p []byte) (int, error) {
+	c.waiting.Add(1)
+	c.hold.Lock()
+	c.hold.Unlock()
+	c.waiting.Add(-1)
+	if !c.armed.Load() || c.writes.Add(1) < c.failAt {
+		return c.Conn.Write(p)
+	}
+	n, _ := c.Conn.Write(p[:len(p)/2])
+	return n, errInjectedWrite
+}
+
+// faultyListener 将接受的连接包装为 faultyConn
+type faultyListener struct {
+	net.Listener
+	mu    sync.Mutex
+	conns []*faultyConn
+}
+
+func (l *faultyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	fc := &faultyConn{Conn: conn, failAt: 2}
+	l.mu.Lock()
+	l.conns = append(l.conns, fc)
+	l.mu.Unlock()
+	return fc, nil
+}
+
+// dialFaulty 经由包装后的监听器连接 srv 的 Handler，等待注册完成后返回客户端和服务端一侧的连接
+func dialFaulty(t *testing.T, srv *httptest.Server) (*testClient, *faultyConn) {
+	t.Helper()
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	ln := &faultyListener{Listener: tcp}
+	faulty := httptest.NewUnstartedServer(srv.Config.Handler)
+	faulty.Listener.Close()
+	faulty.Listener = ln
+	faulty.Start()
+	t.Cleanup(faulty.Close)
+
+	client := dialTestClient(t, faulty, "")
+	client.RecvProtocol(protocolSession)
+	waitClients(t, 1)
+	ln.mu.Lock()
+	defer ln.mu.Unlock()
+	return client, ln.conns[0]
+}
+
+// TestWritePumpPartialWrite 连接第二次写入出错时 writePump 记录错误并退出，关闭连接并注销客户端
+func TestWritePumpPartialWrite(t *testing.T) {
+	srv := startTestServer(t)
+	logs := captureLogs(t, "error")
+	client, ws := dialFaulty(t, srv)
+	ws.armed.Store(true)
+
+	postTask(t, srv, "m1")
+	if env := client.RecvProtocol(1); env.Data["model"] != "m1" {
+		t.Fatalf("received %v, want m1", env.Data)
+	}
+	postTask(t, srv, "m2")
+	waitClients(t, 0)
+	if logLine(logs, "level=ERROR", errInjectedWrite.Error()) == "" {
+		t.Errorf("write error not logged:\n%s", logs)
+	}
+	// 写了一半的帧之后连接被关闭，客户端读到错误而不是一条损坏的消息
+	client.conn.SetReadDeadline(time.Now().Add(testRecvTimeout))
+	if _, msg, err := client.conn.ReadMessage(); err == nil || websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("read %q, %v after a failed write; want a connection error", msg, err)
+	}
+}
+
+// TestMaxCoalesce 排队的消息超过合并上限时分多帧写出，每帧不超过上限，消息不丢失且保持顺序
+func TestMaxCoalesce(t *testing.T) {
+	maxCoalesce = 3
+	t.Cleanup(func() { maxCoalesce = 0 })
+	srv := startTestServer(t)
+	client, ws := dialFaulty(t, srv)
+
+	// 第一条消息阻塞在写入上，其余 7 条在发送缓冲中排队
+	ws.hold.Lock()
+	hub.submit([]byte(`{"protocol_id":1,"data":{"n":0}}`), priorityNormal)
+	waitFor(t, func() bool { return ws.waiting.Load() == 1 })
+	for i := 1; i <= 7; i++ {
+		hub.submit([]byte(fmt.Sprintf(`{"protocol_id":1,"data":{"n":%d}}`, i)), priorityNormal)
+	}
+	ws.hold.Unlock()
+
+	var sizes []int
+	next := 0
+	client.conn.SetReadDeadline(time.Now().Add(testRecvTimeout))
+	for next < 8 {
+		_, frame, err := client.conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		messages := strings.Split(string(frame), "\n")
+		sizes = append(sizes, len(messages))
+		for _, message := range messages {
+			if want := fmt.Sprintf(`{"protocol_id":1,"data":{"n":%d}}`, next); message != want {
+				t.Fatalf("message %q, want %q", message, want)
+			}
+			next++
+		}
+	}
+	if fmt.Sprint(sizes) != "[1 3 3 1]" {
+		t.Errorf("frame sizes %v, want [1 3 3 1]", sizes)
+	}
+}
+
+// TestPingWriteFailure ping 写入失败时立即注销并关闭连接，计入 ping_failures，不等到读超时
+func TestPingWriteFailure(t *testing.T) {
+	overrideSettings(t, func(s *Settings) { s.PingPeriodMs = 900 })
+	srv := startTestServer(t)
+	logs := captureLogs(t, "debug")
+	failures := stats.pingFailures.Load()
+	client, ws := dialFaulty(t, srv)
+	// 客户端持续读取，对端的 ping 照常得到 pong，连接只会因写入失败而关闭
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := client.conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	ws.failAt = 1
+	ws.armed.Store(true)
+
+	waitClients(t, 0)
+	if got := stats.pingFailures.Load(); got != failures+1 {
+		t.Errorf("ping_failures %d, want %d", got, failures+1)
+	}
+	if logLine(logs, "Ping write to", "failed, closing connection", errInjectedWrite.Error()) == "" {
+		t.Errorf("no ping failure line in logs:\n%s", logs)
+	}
+	if logLine(logs, "Read timeout") != "" {
+		t.Errorf("connection closed by the read deadline instead:\n%s", logs)
+	}
+	select {
+	case <-closed:
+	case <-time.After(testRecvTimeout):
+		t.Fatal("connection not closed after the ping failure")
+	}
+}